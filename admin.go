@@ -0,0 +1,157 @@
+package quayd
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Admin is an http.Handler serving the authenticated /admin API, for
+// inspecting and replaying received webhooks, repairing image tags and
+// checking the GitHub rate limit.
+type Admin struct {
+	*Webhook
+
+	// Token is the bearer token that requests must present.
+	Token string
+
+	router *mux.Router
+}
+
+// NewAdmin returns an Admin for wh that requires token.
+func NewAdmin(wh *Webhook, token string) *Admin {
+	a := &Admin{Webhook: wh, Token: token}
+
+	m := mux.NewRouter()
+	m.HandleFunc("/admin/events", a.listEvents).Methods("GET")
+	m.HandleFunc("/admin/events/{id}", a.getEvent).Methods("GET")
+	m.HandleFunc("/admin/events/{id}/replay", a.replayEvent).Methods("POST")
+	m.HandleFunc("/admin/tags", a.loadImageTags).Methods("POST")
+	m.HandleFunc("/admin/ratelimit", a.rateLimit).Methods("GET")
+	m.HandleFunc("/admin/reconcile", a.lastReconcile).Methods("GET")
+	a.router = m
+
+	return a
+}
+
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, a.Token) {
+		unauthorized(w)
+		return
+	}
+
+	a.router.ServeHTTP(w, r)
+}
+
+// authorized checks the request's bearer token in constant time.
+func authorized(r *http.Request, token string) bool {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(h, "Bearer ")), []byte(token)) == 1
+}
+
+// unauthorized responds to a request without a valid bearer token.
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="quayd"`)
+	jsonError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+}
+
+func (a *Admin) listEvents(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	jsonResponse(w, http.StatusOK, a.events().List(limit))
+}
+
+func (a *Admin) rateLimit(w http.ResponseWriter, r *http.Request) {
+	limits := make(map[string]RateLimitSnapshot, len(a.GitHubBudgets))
+	for name, b := range a.GitHubBudgets {
+		limits[name] = b.Snapshot()
+	}
+	jsonResponse(w, http.StatusOK, limits)
+}
+
+func (a *Admin) lastReconcile(w http.ResponseWriter, r *http.Request) {
+	report := a.Reconciler.Last()
+	if report == nil {
+		jsonError(w, errors.New("no reconcile pass yet"), http.StatusNotFound)
+		return
+	}
+	jsonResponse(w, http.StatusOK, report)
+}
+
+func (a *Admin) getEvent(w http.ResponseWriter, r *http.Request) {
+	ev := a.events().Get(mux.Vars(r)["id"])
+	if ev == nil {
+		jsonError(w, errors.New("event not found"), http.StatusNotFound)
+		return
+	}
+	jsonResponse(w, http.StatusOK, ev)
+}
+
+func (a *Admin) replayEvent(w http.ResponseWriter, r *http.Request) {
+	ev := a.events().Get(mux.Vars(r)["id"])
+	if ev == nil {
+		jsonError(w, errors.New("event not found"), http.StatusNotFound)
+		return
+	}
+	jsonResponse(w, http.StatusOK, a.Replay(r.Context(), ev))
+}
+
+// LoadImageTagsForm is the request body for POST /admin/tags.
+type LoadImageTagsForm struct {
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+	Commit     string `json:"commit"`
+}
+
+func (a *Admin) loadImageTags(w http.ResponseWriter, r *http.Request) {
+	var form LoadImageTagsForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		jsonError(w, err, http.StatusBadRequest)
+		return
+	}
+	if form.Repository == "" || form.Tag == "" || form.Commit == "" {
+		jsonError(w, errors.New("repository, tag and commit are required"), http.StatusBadRequest)
+		return
+	}
+
+	l := a.logger().With("request_id", RequestID(r.Context()), "repo", form.Repository, "commit", form.Commit)
+	l.Info("loading image tags from admin api", "tag", form.Tag)
+
+	start := time.Now()
+	if err := a.WithLogger(l).LoadImageTags(r.Context(), form.Commit, form.Tag, form.Repository, ""); err != nil {
+		jsonError(w, err, http.StatusBadGateway)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"status":      "ok",
+		"duration_ns": time.Since(start),
+	})
+}
+
+func jsonResponse(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Encode before writing the status, so that a failure is a 500 rather
+	// than a truncated body.
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	w.WriteHeader(code)
+	buf.WriteTo(w)
+}
+
+func jsonError(w http.ResponseWriter, err error, code int) {
+	jsonResponse(w, code, map[string]string{"error": err.Error()})
+}
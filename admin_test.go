@@ -0,0 +1,197 @@
+package quayd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newAdminServer() *Server {
+	return NewServerWithOptions(nil, ServerOptions{AdminToken: "s3cr3t"})
+}
+
+func adminRequest(s http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	s.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestAdmin_Unauthorized(t *testing.T) {
+	s := newAdminServer()
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/admin/events", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	s.ServeHTTP(resp, req)
+
+	if got, want := resp.Code, http.StatusUnauthorized; got != want {
+		t.Fatalf("Status => %d; want %d", got, want)
+	}
+}
+
+func TestAdmin_Disabled(t *testing.T) {
+	s := NewServer(nil)
+
+	resp := adminRequest(s, "GET", "/admin/events", "")
+
+	if got, want := resp.Code, http.StatusNotFound; got != want {
+		t.Fatalf("Status => %d; want %d", got, want)
+	}
+}
+
+func TestAdmin_Events(t *testing.T) {
+	s := newAdminServer()
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/quay/pending", loadFixture("pending_build.manual", t))
+	s.ServeHTTP(resp, req)
+
+	resp = adminRequest(s, "GET", "/admin/events", "")
+	var events []*Event
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	ev := events[0]
+	if got, want := ev.Outcome, OutcomeSkipped; got != want {
+		t.Fatalf("Outcome => %s; want %s", got, want)
+	}
+	if got, want := ev.Form.BuildID, "29bee14a-6e79-4d43-8ee5-b130dcb2530a"; got != want {
+		t.Fatalf("BuildID => %s; want %s", got, want)
+	}
+
+	resp = adminRequest(s, "GET", "/admin/events/"+ev.ID, "")
+	if got, want := resp.Code, http.StatusOK; got != want {
+		t.Fatalf("Status => %d; want %d", got, want)
+	}
+
+	resp = adminRequest(s, "POST", "/admin/events/"+ev.ID+"/replay", "")
+	var replay Event
+	if err := json.NewDecoder(resp.Body).Decode(&replay); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := replay.ReplayOf, ev.ID; got != want {
+		t.Fatalf("ReplayOf => %s; want %s", got, want)
+	}
+
+	resp = adminRequest(s, "GET", "/admin/events/unknown", "")
+	if got, want := resp.Code, http.StatusNotFound; got != want {
+		t.Fatalf("Status => %d; want %d", got, want)
+	}
+}
+
+func TestAdmin_InvalidPayload(t *testing.T) {
+	s := newAdminServer()
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/quay/success", strings.NewReader("not json"))
+	s.ServeHTTP(resp, req)
+
+	resp = adminRequest(s, "GET", "/admin/events", "")
+	if got, want := resp.Code, http.StatusOK; got != want {
+		t.Fatalf("Status => %d; want %d", got, want)
+	}
+	var events []*Event
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := events[0].Outcome, OutcomeError; got != want {
+		t.Fatalf("Outcome => %s; want %s", got, want)
+	}
+	if events[0].Payload != nil {
+		t.Fatalf("Payload => %s; want none", events[0].Payload)
+	}
+}
+
+func TestJSONResponse_EncodeError(t *testing.T) {
+	resp := httptest.NewRecorder()
+	jsonResponse(resp, http.StatusOK, json.RawMessage("not json"))
+
+	if got, want := resp.Code, http.StatusInternalServerError; got != want {
+		t.Fatalf("Status => %d; want %d", got, want)
+	}
+}
+
+func TestAdmin_LoadImageTags(t *testing.T) {
+	s := newAdminServer()
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"repository":"ejholmes/docker-statsd","tag":"latest","commit":"6607c19d3fd492ec53439f4104b39e4c62ece179"}`, http.StatusOK},
+		{`{"repository":"ejholmes/docker-statsd"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		resp := adminRequest(s, "POST", "/admin/tags", tt.body)
+		if got, want := resp.Code, tt.code; got != want {
+			t.Fatalf("Status => %d; want %d: %s", got, want, resp.Body)
+		}
+	}
+}
+
+func TestAdmin_RateLimit(t *testing.T) {
+	b := new(GitHubBudget)
+	b.Update(rateResponse(42, time.Now().Add(time.Hour)))
+	q := &Quayd{GitHubBudgets: map[string]*GitHubBudget{"github": b}}
+	s := NewServerWithOptions(q, ServerOptions{AdminToken: "s3cr3t"})
+
+	resp := adminRequest(s, "GET", "/admin/ratelimit", "")
+	var limits map[string]RateLimitSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&limits); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := limits["github"].Remaining, 42; got != want {
+		t.Fatalf("Remaining => %d; want %d", got, want)
+	}
+}
+
+func TestAdmin_Reconcile(t *testing.T) {
+	r, _ := newTestReconciler()
+	s := NewServerWithOptions(&Quayd{Reconciler: r}, ServerOptions{AdminToken: "s3cr3t"})
+
+	resp := adminRequest(s, "GET", "/admin/reconcile", "")
+	if got, want := resp.Code, 404; got != want {
+		t.Fatalf("Code => %d; want %d", got, want)
+	}
+
+	r.Reconcile(context.Background())
+	resp = adminRequest(s, "GET", "/admin/reconcile", "")
+	var report ReconcileReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := report.Checked, 2; got != want {
+		t.Fatalf("Checked => %d; want %d", got, want)
+	}
+	if got, want := len(report.Fixed), 1; got != want {
+		t.Fatalf("Fixed => %d; want %d", got, want)
+	}
+}
+
+func TestEventLog(t *testing.T) {
+	l := NewEventLog(2)
+	for _, id := range []string{"a", "b", "c"} {
+		l.Add(&Event{ID: id})
+	}
+
+	events := l.List(0)
+	if got, want := len(events), 2; got != want {
+		t.Fatalf("Events => %d; want %d", got, want)
+	}
+	if got, want := events[0].ID, "c"; got != want {
+		t.Fatalf("Newest => %s; want %s", got, want)
+	}
+	if l.Get("a") != nil {
+		t.Fatal("Expected the oldest event to be evicted")
+	}
+}
@@ -0,0 +1,205 @@
+package quayd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ejholmes/go-github/github"
+	"github.com/gorilla/mux"
+)
+
+// API is an http.Handler serving the read only /api, for querying the
+// history of builds and looking up the image built for a commit.
+type API struct {
+	*Quayd
+
+	// Token, if set, is the bearer token that requests must present.
+	// Without it, images can only be looked up by full commit sha, so that
+	// anonymous requests can't spend the GitHub rate limit resolving short
+	// shas.
+	Token string
+
+	router *mux.Router
+}
+
+// NewAPI returns an API for q that requires token, if it's set. The builds
+// endpoint is only served if q has a BuildStore.
+func NewAPI(q *Quayd, token string) *API {
+	a := &API{Quayd: q, Token: token}
+
+	m := mux.NewRouter()
+	if q.Builds != nil {
+		m.HandleFunc("/api/builds", a.listBuilds).Methods("GET")
+	}
+	m.HandleFunc("/api/images/{owner}/{repo}/{sha}", a.getImage).Methods("GET")
+	a.router = m
+
+	return a
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.Token != "" && !authorized(r, a.Token) {
+		unauthorized(w)
+		return
+	}
+
+	a.router.ServeHTTP(w, r)
+}
+
+func (a *API) listBuilds(w http.ResponseWriter, r *http.Request) {
+	v := r.URL.Query()
+	limit, _ := strconv.Atoi(v.Get("limit"))
+
+	builds, err := a.Builds.Builds(r.Context(), BuildQuery{
+		Repository: v.Get("repo"),
+		Commit:     v.Get("commit"),
+		State:      v.Get("state"),
+		Limit:      limit,
+	})
+	if err != nil {
+		jsonError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if builds == nil {
+		builds = []*BuildRecord{}
+	}
+	jsonResponse(w, http.StatusOK, builds)
+}
+
+// Image is the image built for a commit, as returned by
+// GET /api/images/{owner}/{repo}/{sha}.
+type Image struct {
+	Repository string `json:"repository"`
+	Commit     string `json:"commit"`
+
+	// Image is the reference to the image tagged with the commit, e.g.
+	// quay.io/owner/name:sha.
+	Image string `json:"image,omitempty"`
+
+	// Digest identifies the image. The registry only knows images by id,
+	// so it's the image id.
+	Digest string `json:"digest,omitempty"`
+
+	// Status is the status of the commit's build: pending, success or
+	// failure. It's success if the image exists but the build wasn't
+	// recorded.
+	Status string `json:"status"`
+
+	BuildID  string `json:"build_id,omitempty"`
+	BuildURL string `json:"build_url,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// errShortSHA is returned for a short sha when the API doesn't require a
+// token.
+var errShortSHA = errors.New("a full commit sha is required without an API token")
+
+// getImage looks up the image built for a commit. The tag is checked in the
+// registry, so a 200 means the image can be pulled. If it can't, the response
+// is a 409 while the commit's build is pending, or a 404 if there's no build
+// or it failed.
+func (a *API) getImage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	repo := vars["owner"] + "/" + vars["repo"]
+	ctx := r.Context()
+	timeouts := a.timeouts()
+	l := a.logger().With("request_id", RequestID(ctx), "repo", repo, "ref", vars["sha"])
+
+	sha := vars["sha"]
+	if !IsFullSHA(sha) {
+		if a.Token == "" {
+			jsonError(w, errShortSHA, http.StatusBadRequest)
+			return
+		}
+		rctx, cancel := withTimeout(ctx, timeouts.CommitResolver)
+		resolved, err := a.commitResolver().Resolve(rctx, repo, sha)
+		cancel()
+		if err != nil {
+			l.Warn("commit resolution failed", "error", err)
+			jsonError(w, err, commitErrorStatus(err))
+			return
+		}
+		sha = resolved
+	}
+	img := &Image{Repository: repo, Commit: sha, Status: "success"}
+
+	build, err := a.lookupBuild(ctx, repo, sha)
+	if err != nil {
+		jsonError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if build != nil {
+		img.Status, img.BuildID, img.BuildURL = build.State, build.ID, build.URL
+	}
+
+	tctx, cancel := withTimeout(ctx, timeouts.TagResolver)
+	imageID, err := a.tagResolver().Resolve(tctx, repo, sha)
+	cancel()
+	switch {
+	case err == ErrTagNotFound:
+		if build == nil {
+			img.Status = ""
+			img.Error = "no image has been built for the commit"
+			jsonResponse(w, http.StatusNotFound, img)
+		} else if build.State == "pending" {
+			img.Error = "the commit's build is pending"
+			jsonResponse(w, http.StatusConflict, img)
+		} else {
+			img.Error = "the commit's build did not produce an image"
+			jsonResponse(w, http.StatusNotFound, img)
+		}
+		return
+	case err != nil:
+		l.Warn("tag resolution failed", "error", err)
+		jsonError(w, err, http.StatusBadGateway)
+		return
+	}
+
+	img.Image = a.registry() + "/" + repo + ":" + sha
+	img.Digest = imageID
+	jsonResponse(w, http.StatusOK, img)
+}
+
+// lookupBuild returns the commit's most recent successful build, or its most
+// recent build if none succeeded. It returns nil if there's no BuildStore or
+// the commit hasn't been built.
+func (a *API) lookupBuild(ctx context.Context, repo, sha string) (*BuildRecord, error) {
+	if a.Builds == nil {
+		return nil, nil
+	}
+
+	builds, err := a.Builds.Builds(ctx, BuildQuery{Repository: repo, Commit: sha})
+	if err != nil || len(builds) == 0 {
+		return nil, err
+	}
+	for _, b := range builds {
+		if b.State == "success" {
+			return b, nil
+		}
+	}
+	return builds[0], nil
+}
+
+// commitErrorStatus returns the http status for an error resolving a commit.
+func commitErrorStatus(err error) int {
+	if err == ErrAmbiguousCommit {
+		return http.StatusBadRequest
+	}
+	if err == ErrRateLimited {
+		return http.StatusServiceUnavailable
+	}
+	if r, ok := err.(*github.ErrorResponse); ok {
+		switch {
+		case isAmbiguousCommit(err):
+			return http.StatusBadRequest
+		case r.Response.StatusCode == http.StatusNotFound,
+			r.Response.StatusCode == http.StatusUnprocessableEntity && strings.Contains(r.Message, "No commit found"):
+			return http.StatusNotFound
+		}
+	}
+	return http.StatusBadGateway
+}
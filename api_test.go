@@ -0,0 +1,213 @@
+package quayd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ejholmes/go-github/github"
+)
+
+func TestAPI_Builds(t *testing.T) {
+	store := NewMemoryBuildStore()
+	s := NewServer(&Quayd{
+		Builds: store,
+		Hooks:  []NamedBuildHook{{"history", &BuildHistory{Store: store}}},
+	})
+
+	for _, tt := range []struct{ status, fixture string }{
+		{"pending", "pending_build"},
+		{"success", "success_build"},
+	} {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/quay/"+tt.status, loadFixture(tt.fixture, t))
+		s.ServeHTTP(resp, req)
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/builds?repo=ejholmes/docker-statsd&state=success", nil)
+	s.ServeHTTP(resp, req)
+
+	if got, want := resp.Code, http.StatusOK; got != want {
+		t.Fatalf("Status => %d; want %d", got, want)
+	}
+	var builds []*BuildRecord
+	if err := json.NewDecoder(resp.Body).Decode(&builds); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(builds), 1; got != want {
+		t.Fatalf("Builds => %d; want %d", got, want)
+	}
+	if got, want := builds[0].ID, "296ec063-5f86-4706-a469-f0a400bf9df2"; got != want {
+		t.Fatalf("ID => %s; want %s", got, want)
+	}
+
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/builds?commit=ffff", nil)
+	s.ServeHTTP(resp, req)
+
+	if got, want := resp.Body.String(), "[]\n"; got != want {
+		t.Fatalf("Body => %s; want %s", got, want)
+	}
+}
+
+func TestAPI_Disabled(t *testing.T) {
+	s := NewServer(nil)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/builds", nil)
+	s.ServeHTTP(resp, req)
+
+	if got, want := resp.Code, http.StatusNotFound; got != want {
+		t.Fatalf("Status => %d; want %d", got, want)
+	}
+}
+
+// imageTags is a TagResolver that resolves the tags of a single repository.
+type imageTags map[string]string
+
+func (t imageTags) Resolve(ctx context.Context, repo, tag string) (string, error) {
+	imageID, ok := t[tag]
+	if !ok {
+		return "", ErrTagNotFound
+	}
+	return imageID, nil
+}
+
+// commits is a CommitResolver that resolves short shas by prefix.
+type commits []string
+
+func (c commits) Resolve(ctx context.Context, repo, short string) (string, error) {
+	for _, sha := range c {
+		if strings.HasPrefix(sha, short) {
+			return sha, nil
+		}
+	}
+	req, _ := http.NewRequest("GET", "https://api.github.com/repos/"+repo+"/commits/"+short, nil)
+	return "", &github.ErrorResponse{
+		Response: &http.Response{StatusCode: http.StatusUnprocessableEntity, Request: req},
+		Message:  "No commit found for SHA: " + short,
+	}
+}
+
+func TestAPI_Images(t *testing.T) {
+	const (
+		built   = "6607c19d3fd492ec53439f4104b39e4c62ece179"
+		pending = "d2c3b4a5e6f708192a3b4c5d6e7f8091a2b3c4d5"
+		failed  = "a1b2c3d4e5f60718293a4b5c6d7e8f9012345678"
+		unbuilt = "ffffffffffffffffffffffffffffffffffffffff"
+	)
+
+	store := NewMemoryBuildStore()
+	ctx := context.Background()
+	store.RecordBuild(ctx, &Build{ID: "1", Status: "success", Repository: "acme/api", Commit: built, ImageID: "1234"})
+	store.RecordBuild(ctx, &Build{ID: "2", Status: "pending", Repository: "acme/api", Commit: pending})
+	store.RecordBuild(ctx, &Build{ID: "3", Status: "failure", Repository: "acme/api", Commit: failed})
+
+	s := NewServerWithOptions(&Quayd{
+		Builds:         store,
+		CommitResolver: commits{built, pending, failed, unbuilt},
+		TagResolver:    imageTags{built: "1234"},
+	}, ServerOptions{APIToken: "s3cret"})
+
+	tests := []struct {
+		sha    string
+		code   int
+		status string
+		image  string
+	}{
+		{built, http.StatusOK, "success", "quay.io/acme/api:" + built},
+		{"6607c19", http.StatusOK, "success", "quay.io/acme/api:" + built},
+		{pending, http.StatusConflict, "pending", ""},
+		{failed, http.StatusNotFound, "failure", ""},
+		{unbuilt, http.StatusNotFound, "", ""},
+		{"0000000", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/images/acme/api/"+tt.sha, nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		s.ServeHTTP(resp, req)
+
+		if got, want := resp.Code, tt.code; got != want {
+			t.Fatalf("%s: Status => %d; want %d", tt.sha, got, want)
+		}
+		var img Image
+		if err := json.NewDecoder(resp.Body).Decode(&img); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := img.Status, tt.status; got != want {
+			t.Fatalf("%s: Build status => %s; want %s", tt.sha, got, want)
+		}
+		if got, want := img.Image, tt.image; got != want {
+			t.Fatalf("%s: Image => %s; want %s", tt.sha, got, want)
+		}
+	}
+}
+
+func TestAPI_Images_WithoutHistory(t *testing.T) {
+	s := NewServer(&Quayd{TagResolver: imageTags{"6607c19d3fd492ec53439f4104b39e4c62ece179": "1234"}})
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/images/acme/api/6607c19d3fd492ec53439f4104b39e4c62ece179", nil)
+	s.ServeHTTP(resp, req)
+
+	if got, want := resp.Code, http.StatusOK; got != want {
+		t.Fatalf("Status => %d; want %d", got, want)
+	}
+	var img Image
+	json.NewDecoder(resp.Body).Decode(&img)
+	if got, want := img.Digest, "1234"; got != want {
+		t.Fatalf("Digest => %s; want %s", got, want)
+	}
+}
+
+func TestAPI_Token(t *testing.T) {
+	const built = "6607c19d3fd492ec53439f4104b39e4c62ece179"
+	q := &Quayd{CommitResolver: commits{built}, TagResolver: imageTags{built: "1234"}}
+
+	tests := []struct {
+		token string
+		auth  string
+		sha   string
+		code  int
+	}{
+		{"", "", built, http.StatusOK},
+		// Without a token, short shas aren't resolved.
+		{"", "", "6607c19", http.StatusBadRequest},
+		{"s3cret", "", built, http.StatusUnauthorized},
+		{"s3cret", "Bearer guess", built, http.StatusUnauthorized},
+		{"s3cret", "Bearer s3cret", "6607c19", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		s := NewServerWithOptions(q, ServerOptions{APIToken: tt.token})
+
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/images/acme/api/"+tt.sha, nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		s.ServeHTTP(resp, req)
+
+		if got, want := resp.Code, tt.code; got != want {
+			t.Fatalf("%q %s: Status => %d; want %d", tt.auth, tt.sha, got, want)
+		}
+	}
+}
+
+func TestDockerRegistryTagResolver_NotFound(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `"Tag not found"`, http.StatusNotFound)
+	}))
+	defer s.Close()
+
+	r := &DockerRegistryTagResolver{registry: strings.TrimPrefix(s.URL, "https://"), client: s.Client()}
+	if _, err := r.Resolve(context.Background(), "acme/api", "6607c19"); err != ErrTagNotFound {
+		t.Fatalf("err => %v; want %v", err, ErrTagNotFound)
+	}
+}
@@ -0,0 +1,144 @@
+package quayd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Build is a Quay build, as seen by the BuildHooks run for each of its
+// events.
+type Build struct {
+	// ID is Quay's build id. It's the same for every event of a build.
+	ID string `json:"id"`
+
+	// Status is the event's status: pending, success or failure.
+	Status string `json:"status"`
+
+	// Repository is the repository, as owner/name, on both GitHub and Quay.
+	Repository string `json:"repository"`
+
+	// Commit is the sha of the commit that was built. It's a full sha if
+	// Quay sent one.
+	Commit string `json:"commit"`
+
+	// Branch is the branch that the build was triggered from, if known.
+	Branch string `json:"branch,omitempty"`
+
+	// Image is the image repository, e.g. quay.io/owner/name.
+	Image string `json:"image"`
+
+	// ImageID is the id of the built image. It's only set on success.
+	ImageID string `json:"image_id,omitempty"`
+
+	// URL is the build's page on Quay.
+	URL string `json:"url"`
+
+	// Duration is how long the build took, from its pending event. It's
+	// only set on success or failure, when quayd saw the build start.
+	Duration time.Duration `json:"duration_ns,omitempty"`
+
+	// Slow is true if the build took longer than its repository's slow
+	// build threshold.
+	Slow bool `json:"slow,omitempty"`
+
+	// StatusError is why the commit status couldn't be written, if it
+	// wasn't.
+	StatusError string `json:"status_error,omitempty"`
+}
+
+// ImageRef returns the reference to the image tagged with the build's
+// commit, e.g. quay.io/owner/name:sha.
+func (b *Build) ImageRef() string {
+	return b.Image + ":" + b.Commit
+}
+
+// newBuild returns the Build described by a webhook.
+func newBuild(status string, form *WebhookForm) *Build {
+	b := &Build{
+		ID:         form.BuildID,
+		Status:     status,
+		Repository: form.Repository,
+		Commit:     form.Ref(),
+		Image:      form.DockerURL,
+		URL:        form.BuildURL,
+	}
+	if commit, _ := form.TriggerMetadata["commit"].(string); commit != "" {
+		b.Commit = commit
+	}
+	if ref, _ := form.TriggerMetadata["ref"].(string); strings.HasPrefix(ref, "refs/heads/") {
+		b.Branch = strings.TrimPrefix(ref, "refs/heads/")
+	}
+	if b.Image == "" {
+		b.Image = DefaultRegistryHost + "/" + form.Repository
+	}
+	return b
+}
+
+// BuildHook is an optional action run for every event of a build that quayd
+// processes. On success, it runs after the image has been tagged.
+type BuildHook interface {
+	BuildEvent(ctx context.Context, b *Build) error
+}
+
+// BuildHookFunc is a function that implements the BuildHook interface.
+type BuildHookFunc func(context.Context, *Build) error
+
+// BuildEvent implements BuildHook BuildEvent.
+func (fn BuildHookFunc) BuildEvent(ctx context.Context, b *Build) error {
+	return fn(ctx, b)
+}
+
+// NamedBuildHook is a BuildHook and the name it's logged and counted by.
+type NamedBuildHook struct {
+	Name string
+	BuildHook
+}
+
+// DispatchedBuildHook is a BuildHook that runs another hook in the background
+// with a Dispatcher, retrying it if it fails, so that hooks calling slow APIs
+// such as GitHub's never hold up the webhook.
+type DispatchedBuildHook struct {
+	BuildHook
+
+	// Sink names the hook in the Dispatcher's logs and metrics.
+	Sink string
+
+	// Dispatcher runs the hook. Defaults to DefaultDispatcher.
+	Dispatcher *Dispatcher
+}
+
+// BuildEvent implements BuildHook BuildEvent.
+func (h *DispatchedBuildHook) BuildEvent(ctx context.Context, b *Build) error {
+	d := h.Dispatcher
+	if d == nil {
+		d = DefaultDispatcher
+	}
+	if !d.Go(h.Sink, func(ctx context.Context) error {
+		return h.BuildHook.BuildEvent(ctx, b)
+	}) {
+		return errors.New("delivery queue full")
+	}
+	return nil
+}
+
+// runHooks runs every hook for the build, in order. Hooks are optional, so a
+// failing hook is logged and counted rather than failing the webhook.
+func (q *Quayd) runHooks(ctx context.Context, b *Build) {
+	l := q.logger()
+	for _, h := range q.Hooks {
+		name := h.Name
+		start := time.Now()
+		hctx, cancel := withTimeout(ctx, q.timeouts().Hooks)
+		err := h.BuildEvent(hctx, b)
+		cancel()
+		if err != nil {
+			buildHooksTotal.Inc(name, "error")
+			l.Error("build hook failed", "hook", name, "duration", time.Since(start), "error", err)
+			continue
+		}
+		buildHooksTotal.Inc(name, "success")
+		l.Debug("ran build hook", "hook", name, "duration", time.Since(start))
+	}
+}
@@ -0,0 +1,57 @@
+package quayd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunHooks_Order(t *testing.T) {
+	var ran []string
+	hook := func(name string) NamedBuildHook {
+		return NamedBuildHook{name, BuildHookFunc(func(ctx context.Context, b *Build) error {
+			ran = append(ran, name)
+			return nil
+		})}
+	}
+	q := &Quayd{Hooks: []NamedBuildHook{hook("reaper"), hook("deployments"), hook("history"), hook("event_bus")}}
+
+	for i := 0; i < 10; i++ {
+		ran = nil
+		q.runHooks(context.Background(), &Build{ID: "1", Status: "success"})
+		if got, want := strings.Join(ran, ","), "reaper,deployments,history,event_bus"; got != want {
+			t.Fatalf("Hooks => %s; want %s", got, want)
+		}
+	}
+}
+
+func TestDispatchedBuildHook(t *testing.T) {
+	d := &Dispatcher{Backoff: time.Millisecond}
+	attempts := 0
+	h := &DispatchedBuildHook{
+		BuildHook: BuildHookFunc(func(ctx context.Context, b *Build) error {
+			attempts++
+			if attempts == 1 {
+				return errors.New("boom")
+			}
+			return nil
+		}),
+		Sink:       "hook:test",
+		Dispatcher: d,
+	}
+
+	before := deliveriesTotal.Value("hook:test", "success")
+	if err := h.BuildEvent(context.Background(), &Build{ID: "1", Status: "success"}); err != nil {
+		t.Fatal(err)
+	}
+	d.Wait()
+
+	if got, want := attempts, 2; got != want {
+		t.Fatalf("Attempts => %d; want %d", got, want)
+	}
+	if got, want := deliveriesTotal.Value("hook:test", "success"), before+1; got != want {
+		t.Fatalf("Deliveries => %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,104 @@
+package quayd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEventBus(t *testing.T) {
+	p := new(publisher)
+	d := &Dispatcher{Backoff: time.Millisecond}
+	bus := &EventBus{Publishers: map[string]Publisher{"fake": p}, Dispatcher: d}
+
+	b := &Build{ID: "1", Status: "success", Repository: "ejholmes/docker-statsd", Commit: "6607c19"}
+	if err := bus.BuildEvent(context.Background(), b); err != nil {
+		t.Fatal(err)
+	}
+	d.Wait()
+
+	if got, want := len(p.messages), 1; got != want {
+		t.Fatalf("Messages => %d; want %d", got, want)
+	}
+	m := p.messages[0]
+	if got, want := m.Topic, "quayd.build.success"; got != want {
+		t.Fatalf("Topic => %s; want %s", got, want)
+	}
+	if got, want := m.Key, "ejholmes/docker-statsd"; got != want {
+		t.Fatalf("Key => %s; want %s", got, want)
+	}
+
+	var msg map[string]interface{}
+	if err := json.Unmarshal(m.Data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := msg["commit"], "6607c19"; got != want {
+		t.Fatalf("Commit => %v; want %v", got, want)
+	}
+	if _, ok := msg["time"]; !ok {
+		t.Fatal("Expected a time")
+	}
+}
+
+func TestWriterPublisher(t *testing.T) {
+	var buf bytes.Buffer
+	p := &WriterPublisher{W: &buf}
+
+	if err := p.Publish(context.Background(), "quayd.build.failure", "acme/api", []byte(`{"id":"1"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := buf.String(), `{"topic":"quayd.build.failure","key":"acme/api","data":{"id":"1"}}`+"\n"; got != want {
+		t.Fatalf("Output => %s; want %s", got, want)
+	}
+}
+
+func TestParsePublishers(t *testing.T) {
+	publishers, err := ParsePublishers("nats://token@nats.example.com:4222, stdout, file:builds.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(publishers), 3; got != want {
+		t.Fatalf("Publishers => %d; want %d", got, want)
+	}
+	if _, ok := publishers["nats:nats.example.com:4222"].(*NATSPublisher); !ok {
+		t.Fatalf("Expected a nats publisher named by host: %v", publishers)
+	}
+
+	for _, in := range []string{"file:", "kafka://kafka.example.com", "nats://"} {
+		if _, err := ParsePublishers(in); err == nil {
+			t.Fatalf("ParsePublishers(%q): expected an error", in)
+		}
+	}
+}
+
+func TestWebhook_EventBus(t *testing.T) {
+	s := newNATSServer(t, "")
+	defer s.Close()
+
+	p := &NATSPublisher{URL: s.URL()}
+	defer p.Close()
+
+	d := &Dispatcher{Backoff: time.Millisecond}
+	q := &Quayd{Hooks: []NamedBuildHook{
+		{"event_bus", &EventBus{Publishers: map[string]Publisher{"nats": p}, Dispatcher: d}},
+	}}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/quay/success", loadFixture("success_build", t))
+	NewServer(q).ServeHTTP(resp, req)
+	d.Wait()
+
+	messages := s.published()
+	if got, want := len(messages), 1; got != want {
+		t.Fatalf("Messages => %d; want %d", got, want)
+	}
+	if got, want := messages[0].Topic, "quayd.build.success.ejholmes.docker-statsd"; got != want {
+		t.Fatalf("Subject => %s; want %s", got, want)
+	}
+}
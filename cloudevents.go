@@ -0,0 +1,226 @@
+package quayd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CloudEvent types, one for each stage of processing a build.
+const (
+	// EventStatusReported is emitted when a commit status is created.
+	EventStatusReported = "com.github.timchunght.quayd.status.reported"
+
+	// EventTagsApplied is emitted when an image has been tagged with the
+	// commit sha and its image id.
+	EventTagsApplied = "com.github.timchunght.quayd.tags.applied"
+
+	// EventImagePromoted is emitted once a successful build has been
+	// fully processed, after its hooks have run.
+	EventImagePromoted = "com.github.timchunght.quayd.image.promoted"
+)
+
+// DefaultCloudEventSource is the source of the CloudEvents that quayd emits.
+const DefaultCloudEventSource = "/quayd"
+
+// cloudEventsContentType is the content type of a structured mode CloudEvent.
+const cloudEventsContentType = "application/cloudevents+json"
+
+// CloudEvent is a CloudEvents 1.0 event in the structured JSON format.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            *CloudEventData `json:"data"`
+}
+
+// CloudEventData is the data of the CloudEvents that quayd emits.
+type CloudEventData struct {
+	Repository string `json:"repository"`
+	Commit     string `json:"commit"`
+
+	// Tags are the tags applied to the image.
+	Tags []string `json:"tags,omitempty"`
+
+	// Digest identifies the image. The registry only knows images by id,
+	// so it's the image id.
+	Digest string `json:"digest,omitempty"`
+
+	// State is the commit status state, for EventStatusReported.
+	State string `json:"state,omitempty"`
+
+	Image   string `json:"image,omitempty"`
+	Branch  string `json:"branch,omitempty"`
+	BuildID string `json:"build_id,omitempty"`
+	URL     string `json:"url,omitempty"`
+}
+
+// CloudEventSink represents something that can receive CloudEvents.
+type CloudEventSink interface {
+	Send(context.Context, *CloudEvent) error
+}
+
+// cloudEventSink is a fake implementation of the CloudEventSink interface.
+type cloudEventSink struct {
+	sync.Mutex
+	events []*CloudEvent
+}
+
+func (s *cloudEventSink) Send(ctx context.Context, ev *CloudEvent) error {
+	s.Lock()
+	defer s.Unlock()
+	s.events = append(s.events, ev)
+	return nil
+}
+
+// HTTPCloudEventSink POSTs CloudEvents to a url in the structured content
+// mode.
+type HTTPCloudEventSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// Send implements CloudEventSink Send.
+func (s *HTTPCloudEventSink) Send(ctx context.Context, ev *CloudEvent) error {
+	return postJSON(ctx, s.Client, s.URL, cloudEventsContentType, ev)
+}
+
+// WriterCloudEventSink writes CloudEvents to an io.Writer, one JSON event per
+// line.
+type WriterCloudEventSink struct {
+	W io.Writer
+
+	mu sync.Mutex
+}
+
+// Send implements CloudEventSink Send.
+func (s *WriterCloudEventSink) Send(ctx context.Context, ev *CloudEvent) error {
+	raw, err := json.Marshal(ev)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.W.Write(append(raw, '\n'))
+	return err
+}
+
+// FileCloudEventSink appends CloudEvents to a file, one JSON event per line.
+// The file is created on the first event.
+type FileCloudEventSink struct {
+	Path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// Send implements CloudEventSink Send.
+func (s *FileCloudEventSink) Send(ctx context.Context, ev *CloudEvent) error {
+	raw, err := json.Marshal(ev)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		if s.f, err = os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644); err != nil {
+			return err
+		}
+	}
+	_, err = s.f.Write(append(raw, '\n'))
+	return err
+}
+
+// ParseCloudEventSinks parses a comma separated list of sinks, by name. A sink
+// is an http(s) url, "stdout" or file:path. For example:
+//
+//	https://events.example.com/quayd,file:/var/log/quayd/events.json
+func ParseCloudEventSinks(s string, client *http.Client) (map[string]CloudEventSink, error) {
+	sinks := make(map[string]CloudEventSink)
+	for _, spec := range strings.Split(s, ",") {
+		spec = strings.TrimSpace(spec)
+		switch {
+		case spec == "":
+			continue
+		case spec == "stdout":
+			sinks[spec] = &WriterCloudEventSink{W: os.Stdout}
+		case strings.HasPrefix(spec, "file:"):
+			path := strings.TrimPrefix(spec, "file:")
+			if path == "" {
+				return nil, fmt.Errorf("invalid cloudevents sink %q: missing path", spec)
+			}
+			sinks[spec] = &FileCloudEventSink{Path: path}
+		default:
+			u, err := url.Parse(spec)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("invalid cloudevents sink %q: expected an http(s) url, stdout or file:path", spec)
+			}
+			// Name the sink by host, so that tokens in the url don't end
+			// up in logs and metrics.
+			sinks[u.Host] = &HTTPCloudEventSink{URL: spec, Client: client}
+		}
+	}
+	return sinks, nil
+}
+
+// CloudEventEmitter emits CloudEvents to every sink. Events are delivered in
+// the background by the Dispatcher, so a slow or broken sink never holds up
+// processing a build.
+type CloudEventEmitter struct {
+	// Source is the source of the events. Defaults to
+	// DefaultCloudEventSource.
+	Source string
+
+	// Sinks receive every event, by name.
+	Sinks map[string]CloudEventSink
+
+	// Dispatcher delivers the events. Defaults to DefaultDispatcher.
+	Dispatcher *Dispatcher
+}
+
+// Emit sends an event of the given type to every sink. It's safe to call with
+// a nil emitter.
+func (e *CloudEventEmitter) Emit(typ string, data *CloudEventData) {
+	if e == nil || len(e.Sinks) == 0 {
+		return
+	}
+
+	source := e.Source
+	if source == "" {
+		source = DefaultCloudEventSource
+	}
+	ev := &CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              newRequestID() + newRequestID(),
+		Source:          source,
+		Type:            typ,
+		Subject:         data.Repository + "@" + data.Commit,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	}
+
+	d := e.Dispatcher
+	if d == nil {
+		d = DefaultDispatcher
+	}
+	for name, sink := range e.Sinks {
+		sink := sink
+		d.Go("cloudevents:"+name, func(ctx context.Context) error {
+			return sink.Send(ctx, ev)
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package quayd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCloudEventEmitter(t *testing.T) {
+	sink := new(cloudEventSink)
+	d := &Dispatcher{Backoff: time.Millisecond}
+	e := &CloudEventEmitter{Sinks: map[string]CloudEventSink{"fake": sink}, Dispatcher: d}
+
+	e.Emit(EventTagsApplied, &CloudEventData{Repository: "ejholmes/docker-statsd", Commit: "6607c19", Tags: []string{"6607c19", "1234"}, Digest: "1234"})
+	d.Wait()
+
+	if got, want := len(sink.events), 1; got != want {
+		t.Fatalf("Events => %d; want %d", got, want)
+	}
+	ev := sink.events[0]
+	if got, want := ev.SpecVersion, "1.0"; got != want {
+		t.Fatalf("SpecVersion => %s; want %s", got, want)
+	}
+	if got, want := ev.Source, DefaultCloudEventSource; got != want {
+		t.Fatalf("Source => %s; want %s", got, want)
+	}
+	if got, want := ev.Subject, "ejholmes/docker-statsd@6607c19"; got != want {
+		t.Fatalf("Subject => %s; want %s", got, want)
+	}
+	if ev.ID == "" {
+		t.Fatal("Expected an id")
+	}
+
+	// A nil emitter does nothing.
+	var nilEmitter *CloudEventEmitter
+	nilEmitter.Emit(EventTagsApplied, &CloudEventData{})
+}
+
+func TestHTTPCloudEventSink(t *testing.T) {
+	var (
+		contentType string
+		ev          CloudEvent
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&ev)
+	}))
+	defer s.Close()
+
+	sink := &HTTPCloudEventSink{URL: s.URL}
+	err := sink.Send(context.Background(), &CloudEvent{
+		SpecVersion: "1.0",
+		ID:          "1",
+		Type:        EventImagePromoted,
+		Data:        &CloudEventData{Repository: "ejholmes/docker-statsd", Digest: "1234"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := contentType, "application/cloudevents+json"; got != want {
+		t.Fatalf("Content-Type => %s; want %s", got, want)
+	}
+	if got, want := ev.Data.Digest, "1234"; got != want {
+		t.Fatalf("Digest => %s; want %s", got, want)
+	}
+}
+
+func TestWriterCloudEventSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := &WriterCloudEventSink{W: &buf}
+
+	for _, typ := range []string{EventTagsApplied, EventImagePromoted} {
+		if err := sink.Send(context.Background(), &CloudEvent{Type: typ}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if got, want := len(lines), 2; got != want {
+		t.Fatalf("Lines => %d; want %d", got, want)
+	}
+}
+
+func TestFileCloudEventSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quayd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink := &FileCloudEventSink{Path: filepath.Join(dir, "events.json")}
+	if err := sink.Send(context.Background(), &CloudEvent{Type: EventTagsApplied}); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ioutil.ReadFile(sink.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), EventTagsApplied) {
+		t.Fatalf("File => %s", raw)
+	}
+}
+
+func TestParseCloudEventSinks(t *testing.T) {
+	sinks, err := ParseCloudEventSinks("https://events.example.com/quayd?token=secret, stdout,file:events.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := sinks["events.example.com"].(*HTTPCloudEventSink); !ok {
+		t.Fatalf("Expected an http sink named by host: %v", sinks)
+	}
+	if _, ok := sinks["stdout"].(*WriterCloudEventSink); !ok {
+		t.Fatalf("Expected a stdout sink: %v", sinks)
+	}
+	if got, want := sinks["file:events.json"].(*FileCloudEventSink).Path, "events.json"; got != want {
+		t.Fatalf("Path => %s; want %s", got, want)
+	}
+
+	for _, in := range []string{"file:", "events.example.com", "ftp://events.example.com"} {
+		if _, err := ParseCloudEventSinks(in, nil); err == nil {
+			t.Fatalf("ParseCloudEventSinks(%q): expected an error", in)
+		}
+	}
+}
+
+func TestWebhook_CloudEvents(t *testing.T) {
+	sink := new(cloudEventSink)
+	d := &Dispatcher{Backoff: time.Millisecond}
+	q := &Quayd{
+		StatusesRepository: new(statusesRepository),
+		CloudEvents:        &CloudEventEmitter{Sinks: map[string]CloudEventSink{"fake": sink}, Dispatcher: d},
+	}
+	s := NewServer(q)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/quay/success", loadFixture("success_build", t))
+	s.ServeHTTP(resp, req)
+	d.Wait()
+
+	types := map[string]*CloudEvent{}
+	for _, ev := range sink.events {
+		types[ev.Type] = ev
+	}
+	if got, want := len(sink.events), 3; got != want {
+		t.Fatalf("Events => %d; want %d", got, want)
+	}
+
+	promoted := types[EventImagePromoted]
+	if promoted == nil {
+		t.Fatalf("Expected an %s event", EventImagePromoted)
+	}
+	if got, want := promoted.Data.Commit, "6607c19d3fd492ec53439f4104b39e4c62ece179"; got != want {
+		t.Fatalf("Commit => %s; want %s", got, want)
+	}
+	if got, want := promoted.Data.Branch, "master"; got != want {
+		t.Fatalf("Branch => %s; want %s", got, want)
+	}
+	if types[EventTagsApplied] == nil {
+		t.Fatalf("Expected an %s event", EventTagsApplied)
+	}
+
+	reported := types[EventStatusReported]
+	if reported == nil {
+		t.Fatalf("Expected an %s event", EventStatusReported)
+	}
+	if got, want := reported.Data.State, "success"; got != want {
+		t.Fatalf("State => %s; want %s", got, want)
+	}
+	if got, want := reported.Data.Commit, "6607c19d3fd492ec53439f4104b39e4c62ece179"; got != want {
+		t.Fatalf("Commit => %s; want %s", got, want)
+	}
+}
+
+func TestHandle_CloudEvents(t *testing.T) {
+	sink := new(cloudEventSink)
+	d := &Dispatcher{Backoff: time.Millisecond}
+	q := &Quayd{
+		StatusesRepository: new(statusesRepository),
+		CommitResolver:     new(commitResolver),
+		CloudEvents:        &CloudEventEmitter{Sinks: map[string]CloudEventSink{"fake": sink}, Dispatcher: d},
+	}
+
+	if err := q.Handle(context.Background(), "ejholmes/docker-statsd", "6607c19", "http://quay.io", "success"); err != nil {
+		t.Fatal(err)
+	}
+	d.Wait()
+
+	if got, want := len(sink.events), 1; got != want {
+		t.Fatalf("Events => %d; want %d", got, want)
+	}
+	if got, want := sink.events[0].Data.State, "success"; got != want {
+		t.Fatalf("State => %s; want %s", got, want)
+	}
+}
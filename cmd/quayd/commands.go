@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/timchunght/quayd"
+)
+
+// env is the environment a command runs in.
+type env struct {
+	*config
+	Logger      *quayd.Logger
+	Credentials *quayd.Credentials
+	Quayd       *quayd.Quayd
+	Stdout      io.Writer
+
+	closeTracing func()
+}
+
+// newEnv builds the Quayd for a command. The server logs to stdout, while
+// one-off commands log to stderr so that their output stays parseable.
+func newEnv(c *config, server bool) (*env, error) {
+	w := os.Stderr
+	if server {
+		w = os.Stdout
+	}
+
+	l, err := c.logger(w)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := quayd.NewCredentials(c.token, c.auth)
+	if err != nil {
+		return nil, err
+	}
+	creds.UpdateWebhookSecret(c.webhookSecret)
+
+	// Only the server records builds, so that one-off commands can run
+	// alongside it.
+	var builds quayd.BuildStore
+	if server && c.historyFile != "" {
+		s, err := quayd.OpenFileBuildStore(c.historyFile, c.historySize)
+		if err != nil {
+			return nil, err
+		}
+		builds = s
+	}
+
+	closeTracing, err := c.setupTracing()
+	if err != nil {
+		return nil, err
+	}
+
+	return &env{
+		config:       c,
+		Logger:       l,
+		Credentials:  creds,
+		Quayd:        c.quayd(l, creds, builds),
+		Stdout:       os.Stdout,
+		closeTracing: closeTracing,
+	}, nil
+}
+
+// Close waits for background deliveries and hooks to finish, closes the build
+// history and message bus connections, and flushes any buffered trace spans.
+func (e *env) Close() {
+	if e.Quayd.Dispatcher != nil {
+		e.Quayd.Dispatcher.Wait()
+	}
+	if c, ok := e.Quayd.Builds.(io.Closer); ok {
+		c.Close()
+	}
+	for _, p := range e.Quayd.Publishers {
+		if c, ok := p.(io.Closer); ok {
+			c.Close()
+		}
+	}
+	e.closeTracing()
+}
+
+// print writes v as JSON if -json was given, otherwise it writes the
+// formatted human readable message.
+func (e *env) print(v interface{}, format string, args ...interface{}) error {
+	if e.json {
+		enc := json.NewEncoder(e.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	_, err := fmt.Fprintf(e.Stdout, format+"\n", args...)
+	return err
+}
+
+var (
+	port       string
+	adminToken string
+	apiToken   string
+)
+
+var cmdServe = &command{
+	Usage:   "",
+	Short:   "Start the webhook server.",
+	MaxArgs: 0,
+
+	RequiresCredentials: true,
+	Flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&port, "port", "8080", "The port to run the server on.")
+		fs.StringVar(&adminToken, "admin-token", "", "The bearer token for the /admin API. The admin API is disabled if empty.")
+		fs.StringVar(&apiToken, "api-token", "", "The bearer token for the /api. If empty, the /api is open but only looks up images by full commit sha.")
+	},
+	Run: func(e *env, args []string) error {
+		e.Logger.Redact(adminToken, apiToken)
+		s := quayd.NewServerWithOptions(e.Quayd, quayd.ServerOptions{
+			AdminToken:  adminToken,
+			APIToken:    apiToken,
+			Credentials: e.Credentials,
+		})
+
+		go e.watchSecrets(context.Background())
+		if e.Quayd.Reaper != nil {
+			go e.Quayd.Reaper.Run(context.Background())
+		}
+		if e.Quayd.Reconciler != nil {
+			go e.Quayd.Reconciler.Run(context.Background())
+		}
+
+		e.Logger.Info("starting server", "port", port)
+		return http.ListenAndServe(":"+port, s)
+	},
+}
+
+var cmdTag = &command{
+	Usage:   "<repo> <tag> <commit>",
+	Short:   "Tag the image for <repo>:<tag> with the commit sha and its image id.",
+	MinArgs: 3,
+	MaxArgs: 3,
+
+	RequiresCredentials: true,
+	Run: func(e *env, args []string) error {
+		repo, tag, commit := args[0], args[1], args[2]
+		if err := e.Quayd.LoadImageTags(context.Background(), commit, tag, repo, ""); err != nil {
+			return err
+		}
+		return e.print(map[string]string{
+			"repository": repo,
+			"tag":        tag,
+			"commit":     commit,
+		}, "Tagged %s:%s with %s", repo, tag, commit)
+	},
+}
+
+var cmdStatus = &command{
+	Usage:   "<repo> <ref> <state> [url]",
+	Short:   "Create a commit status for <ref>, resolving it to a full sha.",
+	MinArgs: 3,
+	MaxArgs: 4,
+
+	RequiresCredentials: true,
+	Run: func(e *env, args []string) error {
+		repo, ref, state := args[0], args[1], args[2]
+		var url string
+		if len(args) > 3 {
+			url = args[3]
+		}
+		if !quayd.ValidStatus(state) {
+			return fmt.Errorf("invalid state: %q", state)
+		}
+
+		if err := e.Quayd.Handle(context.Background(), repo, ref, url, state); err != nil {
+			return err
+		}
+		return e.print(map[string]string{
+			"repository": repo,
+			"ref":        ref,
+			"state":      state,
+			"url":        url,
+		}, "Set %s status on %s@%s", state, repo, ref)
+	},
+}
+
+var cmdResolve = &command{
+	Usage:   "<repo> <tag>",
+	Short:   "Resolve <repo>:<tag> to an image id.",
+	MinArgs: 2,
+	MaxArgs: 2,
+	Run: func(e *env, args []string) error {
+		repo, tag := args[0], args[1]
+		imageID, err := e.Quayd.ResolveTag(context.Background(), repo, tag)
+		if err != nil {
+			return err
+		}
+		return e.print(map[string]string{
+			"repository": repo,
+			"tag":        tag,
+			"image_id":   imageID,
+		}, "%s", imageID)
+	},
+}
+
+var cmdReplay = &command{
+	Usage:   "<payload.json> <status>",
+	Short:   "Process a saved Quay webhook payload as if it was received for <status>.",
+	MinArgs: 2,
+	MaxArgs: 2,
+	Run: func(e *env, args []string) error {
+		if !quayd.ValidStatus(args[1]) {
+			return fmt.Errorf("invalid status: %q", args[1])
+		}
+
+		payload, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		wh := &quayd.Webhook{Quayd: e.Quayd}
+		ev := wh.Receive(context.Background(), args[1], payload)
+		if err := e.print(ev, "%s: %s %s", ev.Outcome, ev.Form.Repository, ev.Form.BuildID); err != nil {
+			return err
+		}
+		if ev.Outcome == quayd.OutcomeError {
+			return fmt.Errorf("%s", ev.Error)
+		}
+		return nil
+	},
+}
+
+var (
+	provisionURL    string
+	provisionDryRun bool
+)
+
+var cmdProvision = &command{
+	Usage:   "<namespace|repo>...",
+	Short:   "Create or update the Quay notifications that send builds to quayd.",
+	MinArgs: 1,
+	MaxArgs: -1,
+	Flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&provisionURL, "quayd-url", "", "quayd's external url that the notifications post to (ex: https://quayd.example.com).")
+		fs.BoolVar(&provisionDryRun, "dry-run", false, "Print the changes without making them.")
+	},
+	Run: func(e *env, args []string) error {
+		if e.Quayd.Quay == nil {
+			return errors.New("-quay-token is required")
+		}
+		u, err := parseURL(provisionURL)
+		if err != nil {
+			return fmt.Errorf("-quayd-url: %v", err)
+		}
+		if u == nil {
+			return errors.New("-quayd-url is required")
+		}
+
+		p := &quayd.Provisioner{Quay: e.Quayd.Quay, URL: u, Secret: e.webhookSecret}
+		ctx := context.Background()
+
+		repos, err := p.Repositories(ctx, args)
+		if err != nil {
+			return err
+		}
+
+		all := []*quayd.NotificationChange{}
+		counts := map[string]int{}
+		for _, repo := range repos {
+			changes, err := p.Plan(ctx, repo)
+			if err != nil {
+				return fmt.Errorf("%s: %v", repo, err)
+			}
+			if !provisionDryRun {
+				if err := p.Apply(ctx, changes); err != nil {
+					return fmt.Errorf("%s: %v", repo, err)
+				}
+			}
+			for _, c := range changes {
+				counts[c.Action]++
+			}
+			all = append(all, changes...)
+		}
+
+		if e.json {
+			return e.print(all, "")
+		}
+		for _, c := range all {
+			switch c.Action {
+			case quayd.ActionCreate:
+				fmt.Fprintf(e.Stdout, "+ %s %s %s\n", c.Repository, c.Event, c.To)
+			case quayd.ActionUpdate:
+				fmt.Fprintf(e.Stdout, "~ %s %s %s -> %s\n", c.Repository, c.Event, c.From, c.To)
+			case quayd.ActionDelete:
+				fmt.Fprintf(e.Stdout, "- %s %s %s\n", c.Repository, c.Event, c.From)
+			}
+		}
+
+		summary := fmt.Sprintf("%d repositories: %d created, %d updated, %d deleted, %d unchanged",
+			len(repos), counts[quayd.ActionCreate], counts[quayd.ActionUpdate], counts[quayd.ActionDelete], counts[quayd.ActionUnchanged])
+		if provisionDryRun {
+			summary += " (dry run)"
+		}
+		_, err = fmt.Fprintln(e.Stdout, summary)
+		return err
+	},
+}
+
+var cmdReconcile = &command{
+	Usage:   "[repo]...",
+	Short:   "Tag the images of recent builds that are missing their commit sha tag.",
+	MaxArgs: -1,
+	Run: func(e *env, args []string) error {
+		if e.Quayd.Quay == nil {
+			return errors.New("-quay-token is required")
+		}
+		repos := args
+		if len(repos) == 0 {
+			repos = e.reconcileRepositories()
+		}
+		if len(repos) == 0 {
+			return errors.New("no repositories given: pass them as arguments or set -reconcile-repos")
+		}
+
+		r := &quayd.Reconciler{Quayd: e.Quayd, Repositories: repos}
+		report := r.Reconcile(context.Background())
+
+		if e.json {
+			if err := e.print(report, ""); err != nil {
+				return err
+			}
+		} else {
+			for _, t := range report.Fixed {
+				fmt.Fprintf(e.Stdout, "fixed %s@%s from %s:%s\n", t.Repository, t.Commit, t.Repository, t.Tag)
+			}
+			for _, t := range report.Failed {
+				name := t.Repository
+				if t.Commit != "" {
+					name += "@" + t.Commit
+				}
+				fmt.Fprintf(e.Stdout, "failed %s: %s\n", name, t.Error)
+			}
+			fmt.Fprintf(e.Stdout, "Checked %d commits in %d repositories: %d fixed, %d failed\n",
+				report.Checked, report.Repositories, len(report.Fixed), len(report.Failed))
+		}
+
+		if n := len(report.Failed); n > 0 {
+			return fmt.Errorf("%d failed", n)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/timchunght/quayd"
+)
+
+func TestEnv_Close(t *testing.T) {
+	d := &quayd.Dispatcher{}
+	e := &env{
+		Quayd:        &quayd.Quayd{Dispatcher: d},
+		closeTracing: func() {},
+	}
+
+	var delivered int32
+	d.Go("test", func(ctx context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		atomic.StoreInt32(&delivered, 1)
+		return nil
+	})
+	e.Close()
+
+	// Close waits for the delivery, so that a one-off command doesn't
+	// exit before it's made.
+	if got, want := atomic.LoadInt32(&delivered), int32(1); got != want {
+		t.Fatalf("Delivered => %d; want %d", got, want)
+	}
+}
@@ -0,0 +1,593 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/timchunght/quayd"
+)
+
+// config holds the settings shared by every subcommand.
+type config struct {
+	file string
+
+	token     string
+	auth      string
+	tokenFile string
+	authFile  string
+	appID     int64
+	appKey    string
+
+	githubURL       string
+	githubUploadURL string
+	caFile          string
+	gheURL          string
+	gheToken        string
+	gheRepos        string
+	quayURL         string
+	quayToken       string
+	webhookSecret   string
+	webhookFile     string
+
+	poll      time.Duration
+	logLevel  string
+	logFormat string
+
+	tracing   string
+	traceFile string
+	otlpURL   string
+
+	httpTimeout       time.Duration
+	resolveTimeout    time.Duration
+	statusTimeout     time.Duration
+	tagTimeout        time.Duration
+	tagResolveTimeout time.Duration
+	hookTimeout       time.Duration
+
+	commitCacheSize  int
+	commitCacheTTL   time.Duration
+	rateLimitReserve int
+	deployments      string
+	prComments       bool
+
+	notifications          string
+	notifyTemplateFailed   string
+	notifyTemplatePromoted string
+	notifyTemplateSlow     string
+	slowBuilds             string
+
+	cloudEvents       string
+	cloudEventsSource string
+	publish           string
+	historyFile       string
+	historySize       int
+	pendingTimeout    time.Duration
+	reconcileRepos    string
+	reconcileInterval time.Duration
+	topicPrefix       string
+
+	json bool
+}
+
+// register adds the shared flags to fs.
+func (c *config) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.file, "config", "", "A config file of flag names and values (key: value or key = value per line).")
+	fs.StringVar(&c.token, "github-token", "", "The GitHub API Token to use when creating commit statuses.")
+	fs.StringVar(&c.auth, "registry-auth", "", "The authorization (ex: Quay requires username:password)")
+	fs.StringVar(&c.tokenFile, "github-token-file", "", "A file containing the GitHub API token, e.g. a mounted secret. Reloaded on SIGHUP or when it changes.")
+	fs.StringVar(&c.authFile, "registry-auth-file", "", "A file containing the registry username:password. Reloaded on SIGHUP or when it changes.")
+	fs.Int64Var(&c.appID, "github-app-id", 0, "Authenticate to GitHub as this GitHub App's installations instead of with -github-token.")
+	fs.StringVar(&c.appKey, "github-app-private-key-file", "", "The PEM private key file of the GitHub App given by -github-app-id.")
+	fs.StringVar(&c.githubURL, "github-url", "", "The GitHub API url, for GitHub Enterprise Server (ex: https://github.example.com/api/v3/). Defaults to github.com.")
+	fs.StringVar(&c.githubUploadURL, "github-upload-url", "", "The GitHub uploads url. Defaults to the /api/uploads/ sibling of -github-url.")
+	fs.StringVar(&c.caFile, "ca-file", "", "A PEM file of extra certificate authorities to trust, e.g. for GitHub Enterprise Server.")
+	fs.StringVar(&c.gheURL, "ghe-url", "", "The API url of a GitHub Enterprise Server that serves -ghe-repos, alongside -github-url.")
+	fs.StringVar(&c.gheToken, "ghe-token", "", "The API token for -ghe-url.")
+	fs.StringVar(&c.gheRepos, "ghe-repos", "", "Comma separated owners or owner/repo names served by -ghe-url.")
+	fs.StringVar(&c.quayURL, "quay-url", quayd.DefaultQuayAPIURL, "The Quay API url, for a self-hosted Quay.")
+	fs.StringVar(&c.quayToken, "quay-token", "", "An OAuth access token for the Quay API. quayd only asks Quay about builds if it's set.")
+	fs.StringVar(&c.webhookSecret, "webhook-secret", "", "A secret that Quay's webhooks must send as the secret query parameter. Webhooks aren't checked if it's empty.")
+	fs.StringVar(&c.webhookFile, "webhook-secret-file", "", "A file containing the -webhook-secret. Reloaded on SIGHUP or when it changes.")
+	fs.DurationVar(&c.poll, "secrets-poll-interval", 30*time.Second, "How often to check the secret files for changes. 0 disables polling.")
+	fs.StringVar(&c.logLevel, "log-level", "info", "The minimum level to log (debug, info, warn, error).")
+	fs.StringVar(&c.logFormat, "log-format", quayd.FormatLogfmt, "The log format (logfmt or json).")
+
+	fs.StringVar(&c.tracing, "trace-exporter", "", "Where to export trace spans (stdout, file or otlp). Tracing is disabled if empty.")
+	fs.StringVar(&c.traceFile, "trace-file", "traces.json", "The file to write spans to when -trace-exporter=file.")
+	fs.StringVar(&c.otlpURL, "otlp-endpoint", "http://localhost:4318/v1/traces", "The OTLP/HTTP traces endpoint when -trace-exporter=otlp.")
+
+	fs.DurationVar(&c.httpTimeout, "http-timeout", 30*time.Second, "The overall timeout for requests to GitHub and the registry.")
+	fs.DurationVar(&c.resolveTimeout, "resolve-timeout", quayd.DefaultTimeout, "The timeout for resolving a short sha with GitHub.")
+	fs.DurationVar(&c.statusTimeout, "status-timeout", quayd.DefaultTimeout, "The timeout for creating a GitHub commit status.")
+	fs.DurationVar(&c.tagTimeout, "tag-timeout", quayd.DefaultTimeout, "The timeout for tagging an image in the registry.")
+	fs.DurationVar(&c.tagResolveTimeout, "tag-resolve-timeout", quayd.DefaultTimeout, "The timeout for resolving a tag to an image id in the registry.")
+	fs.DurationVar(&c.hookTimeout, "hook-timeout", quayd.DefaultTimeout, "The timeout for each action run for a build, such as creating a deployment.")
+
+	fs.IntVar(&c.commitCacheSize, "commit-cache-size", quayd.DefaultCommitCacheSize, "The number of resolved commits to cache.")
+	fs.DurationVar(&c.commitCacheTTL, "commit-cache-ttl", quayd.DefaultCommitCacheTTL, "How long to cache a resolved commit.")
+
+	fs.StringVar(&c.deployments, "deployments", "", "Create GitHub Deployments for successful builds, as comma separated repository:branch=environment rules (ex: acme/api:master=production).")
+	fs.BoolVar(&c.prComments, "pr-comments", false, "Keep a comment describing the built image on the open pull requests for each successful build.")
+	fs.StringVar(&c.notifications, "notifications", "", "Notify when builds fail or images are promoted, as comma separated [repository[@event]=]kind:url routes, where kind is slack, teams or webhook (ex: acme@build_failed=slack:https://hooks.slack.com/services/...#builds).")
+	fs.StringVar(&c.notifyTemplateFailed, "notify-template-build-failed", "", "A text/template for build_failed notifications, executed with the build.")
+	fs.StringVar(&c.notifyTemplatePromoted, "notify-template-image-promoted", "", "A text/template for image_promoted notifications, executed with the build.")
+	fs.StringVar(&c.notifyTemplateSlow, "notify-template-build-slow", "", "A text/template for build_slow notifications, executed with the build.")
+	fs.StringVar(&c.slowBuilds, "slow-build-thresholds", "", "Comma separated repository=duration thresholds (ex: acme/api=10m,*=30m). Builds that take longer are logged, counted and sent to -notifications as build_slow.")
+	fs.StringVar(&c.cloudEvents, "cloudevents", "", "Emit a CloudEvent for each stage of processing a build to these comma separated sinks: http(s) urls, stdout or file:path.")
+	fs.StringVar(&c.cloudEventsSource, "cloudevents-source", quayd.DefaultCloudEventSource, "The source of the emitted CloudEvents.")
+	fs.StringVar(&c.publish, "publish", "", "Publish every build event to these comma separated message buses: nats:// urls, stdout or file:path (newline delimited JSON).")
+	fs.StringVar(&c.topicPrefix, "topic-prefix", quayd.DefaultTopicPrefix, "The prefix of the topics that build events are published to, as <prefix>.build.<status>.")
+	fs.StringVar(&c.historyFile, "history-file", "", "Record the history of every build in this file, and serve it from /api/builds.")
+	fs.IntVar(&c.historySize, "history-size", quayd.DefaultBuildStoreSize, "The number of builds kept in -history-file, dropping the least recently updated.")
+	fs.DurationVar(&c.pendingTimeout, "pending-timeout", 0, "Flip a commit's pending status to error if Quay's webhook with the build's result doesn't arrive within this long, unless -quay-token is set and Quay says the build is still running. 0 disables the reaper.")
+	fs.StringVar(&c.reconcileRepos, "reconcile-repos", "", "Comma separated repositories whose recent builds are checked for images missing their commit sha tag, which are tagged again. Requires -quay-token.")
+	fs.DurationVar(&c.reconcileInterval, "reconcile-interval", quayd.DefaultReconcileInterval, "How often the server checks -reconcile-repos for missing commit sha tags.")
+	fs.IntVar(&c.rateLimitReserve, "rate-limit-reserve", quayd.DefaultRateLimitReserve, "Queue commit statuses until the GitHub rate limit resets once fewer than this many requests remain.")
+
+	fs.BoolVar(&c.json, "json", false, "Print command output as JSON.")
+}
+
+// noEnv are flags that can't be set from the environment or a config file.
+var noEnv = map[string]bool{
+	"config": true,
+	"json":   true,
+}
+
+// envName returns the environment variable for a flag, e.g. GITHUB_TOKEN for
+// -github-token.
+func envName(flag string) string {
+	return strings.ToUpper(strings.Replace(flag, "-", "_", -1))
+}
+
+// load fills in every flag that wasn't given on the command line, first from
+// the environment and then from the config file. The config file is named by
+// -config or the QUAYD_CONFIG environment variable.
+func load(fs *flag.FlagSet, getenv func(string) (string, bool)) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var file map[string]string
+	path := fs.Lookup("config").Value.String()
+	if path == "" {
+		path, _ = getenv("QUAYD_CONFIG")
+	}
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if file, err = parseConfigFile(f); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		for key := range file {
+			if fs.Lookup(key) == nil || noEnv[key] {
+				return fmt.Errorf("%s: unknown setting %q", path, key)
+			}
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] || noEnv[f.Name] {
+			return
+		}
+
+		source := "$" + envName(f.Name)
+		v, ok := getenv(envName(f.Name))
+		if !ok {
+			source = path
+			v, ok = file[f.Name]
+		}
+		if !ok {
+			return
+		}
+		if serr := f.Value.Set(v); serr != nil {
+			err = fmt.Errorf("invalid value %q for %s from %s: %v", v, f.Name, source, serr)
+		}
+	})
+	return err
+}
+
+// parseConfigFile parses a flat config file. Each line is a setting in either
+// YAML (key: value) or TOML (key = value) style, values may be quoted, and
+// lines starting with # are comments. Keys are flag names, with either dashes
+// or underscores.
+func parseConfigFile(r io.Reader) (map[string]string, error) {
+	settings := map[string]string{}
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+
+		i := strings.IndexAny(line, ":=")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: expected key: value or key = value", n)
+		}
+
+		key := strings.Replace(strings.TrimSpace(line[:i]), "_", "-", -1)
+		value := strings.TrimSpace(line[i+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			if value[0] == '"' {
+				v, err := strconv.Unquote(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", n, err)
+				}
+				value = v
+			} else {
+				value = value[1 : len(value)-1]
+			}
+		} else if j := strings.Index(value, " #"); j >= 0 {
+			value = strings.TrimSpace(value[:j])
+		}
+
+		settings[key] = value
+	}
+	return settings, s.Err()
+}
+
+// validate checks the config, returning an error that describes the first
+// problem found. Commands that talk to GitHub and the registry require
+// credentials.
+func (c *config) validate(requireCredentials bool) error {
+	if _, err := quayd.ParseLevel(c.logLevel); err != nil {
+		return err
+	}
+	if c.logFormat != quayd.FormatLogfmt && c.logFormat != quayd.FormatJSON {
+		return fmt.Errorf("unknown log format: %q", c.logFormat)
+	}
+	switch c.tracing {
+	case "", "stdout", "file", "otlp":
+	default:
+		return fmt.Errorf("unknown trace exporter: %q", c.tracing)
+	}
+
+	for name, d := range map[string]time.Duration{
+		"http-timeout":        c.httpTimeout,
+		"resolve-timeout":     c.resolveTimeout,
+		"status-timeout":      c.statusTimeout,
+		"tag-timeout":         c.tagTimeout,
+		"tag-resolve-timeout": c.tagResolveTimeout,
+		"hook-timeout":        c.hookTimeout,
+		"commit-cache-ttl":    c.commitCacheTTL,
+		"reconcile-interval":  c.reconcileInterval,
+	} {
+		if d < 0 {
+			return fmt.Errorf("-%s must not be negative", name)
+		}
+	}
+
+	if c.token != "" && c.tokenFile != "" {
+		return errors.New("set only one of -github-token and -github-token-file")
+	}
+	if c.auth != "" && c.authFile != "" {
+		return errors.New("set only one of -registry-auth and -registry-auth-file")
+	}
+	if c.webhookSecret != "" && c.webhookFile != "" {
+		return errors.New("set only one of -webhook-secret and -webhook-secret-file")
+	}
+	if err := c.readSecrets(); err != nil {
+		return err
+	}
+
+	for name, u := range map[string]string{
+		"github-url":        c.githubURL,
+		"github-upload-url": c.githubUploadURL,
+		"ghe-url":           c.gheURL,
+		"quay-url":          c.quayURL,
+	} {
+		if _, err := parseURL(u); err != nil {
+			return fmt.Errorf("-%s: %v", name, err)
+		}
+	}
+	if c.commitCacheSize < 0 {
+		return errors.New("-commit-cache-size must not be negative")
+	}
+	if c.historySize < 0 {
+		return errors.New("-history-size must not be negative")
+	}
+	if c.pendingTimeout < 0 {
+		return errors.New("-pending-timeout must not be negative")
+	}
+	if c.reconcileRepos != "" && c.quayToken == "" {
+		return errors.New("-reconcile-repos requires -quay-token")
+	}
+	if c.rateLimitReserve < 0 {
+		return errors.New("-rate-limit-reserve must not be negative")
+	}
+	if _, err := quayd.ParseDeploymentRules(c.deployments); err != nil {
+		return fmt.Errorf("-deployments: %v", err)
+	}
+	if _, err := quayd.ParseNotificationRoutes(c.notifications, nil); err != nil {
+		return fmt.Errorf("-notifications: %v", err)
+	}
+	if _, err := quayd.ParseNotificationTemplates(c.notificationTemplates()); err != nil {
+		return fmt.Errorf("-notify-template: %v", err)
+	}
+	if _, err := quayd.ParseSlowBuildThresholds(c.slowBuilds); err != nil {
+		return fmt.Errorf("-slow-build-thresholds: %v", err)
+	}
+	if _, err := quayd.ParseCloudEventSinks(c.cloudEvents, nil); err != nil {
+		return fmt.Errorf("-cloudevents: %v", err)
+	}
+	if _, err := quayd.ParsePublishers(c.publish); err != nil {
+		return fmt.Errorf("-publish: %v", err)
+	}
+
+	if (c.gheURL != "") != (c.gheRepos != "") {
+		return errors.New("-ghe-url and -ghe-repos must be set together")
+	}
+	if c.gheURL != "" && c.gheToken == "" {
+		return errors.New("-ghe-token is required with -ghe-url")
+	}
+	if c.caFile != "" {
+		if _, err := quayd.LoadRootCAs(c.caFile); err != nil {
+			return fmt.Errorf("-ca-file: %v", err)
+		}
+	}
+
+	if (c.appID != 0) != (c.appKey != "") {
+		return errors.New("-github-app-id and -github-app-private-key-file must be set together")
+	}
+	if c.appID != 0 {
+		if c.token != "" {
+			return errors.New("set only one of -github-token and -github-app-id")
+		}
+		if _, err := c.githubApp(); err != nil {
+			return fmt.Errorf("-github-app-private-key-file: %v", err)
+		}
+	}
+
+	if _, _, err := quayd.ParseRegistryAuth(c.auth); err != nil {
+		return fmt.Errorf("-registry-auth: %v", err)
+	}
+
+	if requireCredentials {
+		if c.token == "" && c.appID == 0 {
+			return errors.New("a GitHub token is required: set -github-token, -github-token-file or $GITHUB_TOKEN, or -github-app-id")
+		}
+		if c.auth == "" {
+			return errors.New("registry credentials are required: set -registry-auth, -registry-auth-file or $REGISTRY_AUTH")
+		}
+	}
+	return nil
+}
+
+// logger returns a Logger writing to w that redacts the configured secrets.
+func (c *config) logger(w io.Writer) (*quayd.Logger, error) {
+	level, err := quayd.ParseLevel(c.logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	l := quayd.NewLogger(w, c.logFormat, level)
+	l.Redact(c.token, c.auth, c.gheToken, c.quayToken, c.webhookSecret)
+	l.Redact(c.notificationURLs()...)
+	l.Redact(c.publisherSecrets()...)
+	if i := strings.Index(c.auth, ":"); i >= 0 {
+		l.Redact(c.auth[i+1:])
+	}
+	return l, nil
+}
+
+// notificationTemplates returns the configured notification templates by
+// event.
+func (c *config) notificationTemplates() map[string]string {
+	return map[string]string{
+		quayd.NotifyBuildFailed:   c.notifyTemplateFailed,
+		quayd.NotifyImagePromoted: c.notifyTemplatePromoted,
+		quayd.NotifyBuildSlow:     c.notifyTemplateSlow,
+	}
+}
+
+// notificationURLs returns the urls of the notification routes, which usually
+// embed a secret.
+func (c *config) notificationURLs() []string {
+	routes, _ := quayd.ParseNotificationRoutes(c.notifications, nil)
+
+	var urls []string
+	for _, r := range routes {
+		switch n := r.Notifier.(type) {
+		case *quayd.SlackNotifier:
+			urls = append(urls, n.URL)
+		case *quayd.TeamsNotifier:
+			urls = append(urls, n.URL)
+		case *quayd.WebhookNotifier:
+			urls = append(urls, n.URL)
+		}
+	}
+	return urls
+}
+
+// publisherSecrets returns the credentials in the publisher urls.
+func (c *config) publisherSecrets() []string {
+	publishers, _ := quayd.ParsePublishers(c.publish)
+
+	var secrets []string
+	for _, p := range publishers {
+		if n, ok := p.(*quayd.NATSPublisher); ok && n.URL.User != nil {
+			if pass, ok := n.URL.User.Password(); ok {
+				secrets = append(secrets, pass)
+			} else {
+				secrets = append(secrets, n.URL.User.Username())
+			}
+		}
+	}
+	return secrets
+}
+
+// reconcileRepositories returns the repositories to reconcile.
+func (c *config) reconcileRepositories() []string {
+	return strings.FieldsFunc(c.reconcileRepos, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// quay returns a client of the Quay API using client, or nil if no Quay token
+// is configured.
+func (c *config) quay(client *http.Client) *quayd.QuayClient {
+	if c.quayToken == "" {
+		return nil
+	}
+	u, _ := parseURL(c.quayURL)
+	return &quayd.QuayClient{BaseURL: u, Token: c.quayToken, Client: client}
+}
+
+// setupTracing configures the DefaultTracer's exporter. The returned func
+// flushes and closes the exporter. The exporter must have been validated.
+func (c *config) setupTracing() (func(), error) {
+	switch c.tracing {
+	case "":
+		return func() {}, nil
+	case "stdout":
+		quayd.DefaultTracer.Exporter = &quayd.WriterExporter{W: os.Stderr}
+		return func() {}, nil
+	case "file":
+		f, err := os.OpenFile(c.traceFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		quayd.DefaultTracer.Exporter = &quayd.WriterExporter{W: f}
+		return func() { f.Close() }, nil
+	default:
+		e := &quayd.OTLPExporter{Endpoint: c.otlpURL}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			e.Run(ctx, 5*time.Second)
+			close(done)
+		}()
+		quayd.DefaultTracer.Exporter = e
+		return func() { cancel(); <-done }, nil
+	}
+}
+
+// parseURL parses an absolute http(s) url. An empty string is nil.
+func parseURL(s string) (*url.URL, error) {
+	if s == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an http(s) url", s)
+	}
+	return u, nil
+}
+
+// githubApp returns the configured GitHub App, or nil if quayd authenticates
+// with a token.
+func (c *config) githubApp() (*quayd.GitHubApp, error) {
+	if c.appID == 0 {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(c.appKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := quayd.ParsePrivateKey(b)
+	if err != nil {
+		return nil, err
+	}
+	return &quayd.GitHubApp{ID: c.appID, PrivateKey: key}, nil
+}
+
+// quayd builds a Quayd from the config, using creds for authentication and
+// recording builds in builds, if it's not nil. The config must have been
+// validated.
+func (c *config) quayd(l *quayd.Logger, creds *quayd.Credentials, builds quayd.BuildStore) *quayd.Quayd {
+	app, _ := c.githubApp()
+	githubURL, _ := parseURL(c.githubURL)
+	githubUploadURL, _ := parseURL(c.githubUploadURL)
+
+	var hosts []quayd.GitHubHost
+	if c.gheURL != "" {
+		u, _ := parseURL(c.gheURL)
+		hosts = append(hosts, quayd.GitHubHost{
+			BaseURL: u,
+			Token:   c.gheToken,
+			Repos: strings.FieldsFunc(c.gheRepos, func(r rune) bool {
+				return r == ',' || r == ' '
+			}),
+		})
+	}
+
+	deployments, _ := quayd.ParseDeploymentRules(c.deployments)
+
+	var roots *x509.CertPool
+	if c.caFile != "" {
+		roots, _ = quayd.LoadRootCAs(c.caFile)
+	}
+
+	client := quayd.NewHTTPClientWithRootCAs(c.httpTimeout, roots)
+	notifications, _ := quayd.ParseNotificationRoutes(c.notifications, client)
+	templates, _ := quayd.ParseNotificationTemplates(c.notificationTemplates())
+	sinks, _ := quayd.ParseCloudEventSinks(c.cloudEvents, client)
+	publishers, _ := quayd.ParsePublishers(c.publish)
+	slowBuilds, _ := quayd.ParseSlowBuildThresholds(c.slowBuilds)
+
+	var quay quayd.QuayAPI
+	if qc := c.quay(client); qc != nil {
+		quay = qc
+	}
+
+	q := quayd.NewWithOptions(quayd.Options{
+		GitHubApp:             app,
+		GitHubBaseURL:         githubURL,
+		GitHubUploadURL:       githubUploadURL,
+		GitHubHosts:           hosts,
+		CommitCacheSize:       c.commitCacheSize,
+		CommitCacheTTL:        c.commitCacheTTL,
+		RateLimitReserve:      c.rateLimitReserve,
+		DeploymentRules:       deployments,
+		PullRequestComments:   c.prComments,
+		NotificationRoutes:    notifications,
+		NotificationTemplates: templates,
+		CloudEventSinks:       sinks,
+		CloudEventSource:      c.cloudEventsSource,
+		Publishers:            publishers,
+		BuildStore:            builds,
+		SlowBuildThresholds:   slowBuilds,
+		PendingTimeout:        c.pendingTimeout,
+		Quay:                  quay,
+		ReconcileRepositories: c.reconcileRepositories(),
+		ReconcileInterval:     c.reconcileInterval,
+		TopicPrefix:           c.topicPrefix,
+		Credentials:           creds,
+		HTTPClient:            client,
+		Dispatcher:            &quayd.Dispatcher{Logger: l},
+		Timeouts: &quayd.Timeouts{
+			CommitResolver:     c.resolveTimeout,
+			StatusesRepository: c.statusTimeout,
+			Tagger:             c.tagTimeout,
+			TagResolver:        c.tagResolveTimeout,
+			Hooks:              c.hookTimeout,
+		},
+	})
+	q.Logger = l
+	if q.Reaper != nil {
+		q.Reaper.Logger = l
+	}
+	for _, b := range q.GitHubBudgets {
+		b.Logger = l
+	}
+	return q
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/timchunght/quayd"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	settings, err := parseConfigFile(strings.NewReader(`
+# quayd settings
+github_token: "1234"
+registry-auth = 'user:pass'
+log-level: debug # verbose
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"github-token":  "1234",
+		"registry-auth": "user:pass",
+		"log-level":     "debug",
+	}
+	for k, v := range want {
+		if got := settings[k]; got != v {
+			t.Fatalf("%s => %q; want %q", k, got, v)
+		}
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	f, err := ioutil.TempFile("", "quayd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("github-token: file\nregistry-auth: file:file\nlog-level: warn\n")
+	f.Close()
+
+	var c config
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	c.register(fs)
+	fs.Parse([]string{"-config", f.Name(), "-github-token", "flag"})
+
+	env := map[string]string{
+		"GITHUB_TOKEN":  "env",
+		"REGISTRY_AUTH": "env:env",
+	}
+	getenv := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+	if err := load(fs, getenv); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := c.token, "flag"; got != want {
+		t.Fatalf("token => %s; want %s", got, want)
+	}
+	if got, want := c.auth, "env:env"; got != want {
+		t.Fatalf("auth => %s; want %s", got, want)
+	}
+	if got, want := c.logLevel, "warn"; got != want {
+		t.Fatalf("logLevel => %s; want %s", got, want)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	valid := config{token: "1234", auth: "user:pass", logLevel: "info", logFormat: "logfmt"}
+
+	tests := []struct {
+		change func(*config)
+		err    string
+	}{
+		{func(c *config) {}, ""},
+		{func(c *config) { c.auth = "user" }, "username:password"},
+		{func(c *config) { c.token = "" }, "GitHub token is required"},
+		{func(c *config) { c.logFormat = "xml" }, "unknown log format"},
+		{func(c *config) { c.tracing = "jaeger" }, "unknown trace exporter"},
+		{func(c *config) { c.webhookSecret, c.webhookFile = "s3cret", "secret" }, "only one of -webhook-secret and -webhook-secret-file"},
+		{func(c *config) { c.githubURL = "github.example.com" }, "-github-url"},
+		{func(c *config) { c.quayURL = "quay.example.com" }, "-quay-url"},
+		{func(c *config) { c.gheURL = "https://github.example.com/api/v3/" }, "-ghe-url and -ghe-repos"},
+		{func(c *config) { c.gheURL, c.gheRepos = "https://github.example.com/api/v3/", "acme" }, "-ghe-token is required"},
+		{func(c *config) { c.caFile = "missing.pem" }, "-ca-file"},
+		{func(c *config) { c.deployments = "acme/api=production" }, "-deployments"},
+		{func(c *config) { c.notifications = "irc:https://example.com" }, "-notifications"},
+		{func(c *config) { c.notifyTemplateFailed = "{{.Repository" }, "-notify-template"},
+		{func(c *config) { c.cloudEvents = "file:" }, "-cloudevents"},
+		{func(c *config) { c.slowBuilds = "acme/api=soon" }, "-slow-build-thresholds"},
+		{func(c *config) { c.pendingTimeout = -time.Minute }, "-pending-timeout"},
+		{func(c *config) { c.historySize = -1 }, "-history-size"},
+		{func(c *config) { c.reconcileInterval = -time.Minute }, "-reconcile-interval"},
+		{func(c *config) { c.reconcileRepos = "acme/api" }, "requires -quay-token"},
+		{func(c *config) { c.publish = "kafka://kafka.example.com" }, "-publish"},
+		{func(c *config) { c.appID = 1234 }, "must be set together"},
+		{func(c *config) { c.appID, c.appKey = 1234, "key.pem" }, "only one of -github-token and -github-app-id"},
+		{func(c *config) { c.token, c.appID, c.appKey = "", 1234, "missing.pem" }, "-github-app-private-key-file"},
+	}
+
+	for _, tt := range tests {
+		c := valid
+		tt.change(&c)
+
+		err := c.validate(true)
+		if tt.err == "" {
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("Err => %v; want %q", err, tt.err)
+		}
+	}
+}
+
+func TestConfig_Quayd_Logger(t *testing.T) {
+	c := &config{token: "1234", auth: "user:pass", logLevel: "info", logFormat: "logfmt", pendingTimeout: time.Hour}
+	creds, err := quayd.NewCredentials(c.token, c.auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := quayd.NewLogger(ioutil.Discard, quayd.FormatLogfmt, quayd.LevelInfo)
+
+	q := c.quayd(l, creds, nil)
+
+	if got, want := q.Dispatcher.Logger, l; got != want {
+		t.Fatalf("Dispatcher logger => %p; want %p", got, want)
+	}
+	if got, want := q.Reaper.Logger, l; got != want {
+		t.Fatalf("Reaper logger => %p; want %p", got, want)
+	}
+	if got, want := q.GitHubBudgets["github"].Logger, l; got != want {
+		t.Fatalf("GitHubBudget logger => %p; want %p", got, want)
+	}
+}
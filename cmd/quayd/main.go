@@ -2,21 +2,111 @@ package main
 
 import (
 	"flag"
-	"github.com/timchunght/quayd"
-	"log"
-	"net/http"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
 )
 
+// command is a quayd subcommand.
+type command struct {
+	// Usage is the command's argument synopsis.
+	Usage string
+
+	// Short is a one line description of the command.
+	Short string
+
+	// MinArgs and MaxArgs bound the number of positional arguments. A
+	// MaxArgs of -1 is unbounded.
+	MinArgs, MaxArgs int
+
+	// RequiresCredentials is true if the command can't run without a
+	// GitHub token and registry credentials.
+	RequiresCredentials bool
+
+	// Flags registers flags specific to the command.
+	Flags func(*flag.FlagSet)
+
+	// Run runs the command.
+	Run func(e *env, args []string) error
+}
+
+var commands = map[string]*command{
+	"serve":     cmdServe,
+	"tag":       cmdTag,
+	"status":    cmdStatus,
+	"resolve":   cmdResolve,
+	"replay":    cmdReplay,
+	"provision": cmdProvision,
+	"reconcile": cmdReconcile,
+}
+
 func main() {
-	var (
-		port  = flag.String("port", "8080", "The port to run the server on.")
-		token = flag.String("github-token", "", "The GitHub API Token to use when creating commit statuses.")
-		auth  = flag.String("registry-auth", "", "The authorization (ex: Quay requires username:password)")
-	)
-	flag.Parse()
+	args := os.Args[1:]
 
-	q := quayd.New(*token, *auth)
-	s := quayd.NewServer(q)
+	// With no subcommand, or only flags, quayd starts the server as it
+	// always has.
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "quayd: unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	if err := run(name, cmd, args); err != nil {
+		fmt.Fprintf(os.Stderr, "quayd %s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+func run(name string, cmd *command, args []string) error {
+	var c config
+	fs := flag.NewFlagSet("quayd "+name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: quayd %s [flags] %s\n\n%s\n\nFlags:\n", name, cmd.Usage, cmd.Short)
+		fs.PrintDefaults()
+	}
+	c.register(fs)
+	if cmd.Flags != nil {
+		cmd.Flags(fs)
+	}
+	fs.Parse(args)
+
+	if n := fs.NArg(); n < cmd.MinArgs || (cmd.MaxArgs >= 0 && n > cmd.MaxArgs) {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := load(fs, os.LookupEnv); err != nil {
+		return err
+	}
+	if err := c.validate(cmd.RequiresCredentials); err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	e, err := newEnv(&c, name == "serve")
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+
+	return cmd.Run(e, fs.Args())
+}
 
-	log.Fatal(http.ListenAndServe(":"+*port, s))
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: quayd <command> [flags] [args]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].Short)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'quayd <command> -h' for the command's flags.\n")
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// readSecret reads a secret from a file, trimming surrounding whitespace such
+// as the trailing newline most tools write.
+func readSecret(path string) (string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(raw)), nil
+}
+
+// secrets are the GitHub token, registry credentials and webhook secret.
+type secrets struct {
+	token, auth, webhookSecret string
+}
+
+// readSecrets reads the GitHub token, registry credentials and webhook secret
+// from their files, if configured.
+func (c *config) readSecrets() error {
+	s, err := c.readSecretFiles()
+	if err != nil {
+		return err
+	}
+	c.token, c.auth, c.webhookSecret = s.token, s.auth, s.webhookSecret
+	return nil
+}
+
+// readSecretFiles returns the secrets, read from their files if configured,
+// without changing the config.
+func (c *config) readSecretFiles() (secrets, error) {
+	s := secrets{token: c.token, auth: c.auth, webhookSecret: c.webhookSecret}
+	for _, f := range []struct {
+		path  string
+		value *string
+	}{
+		{c.tokenFile, &s.token},
+		{c.authFile, &s.auth},
+		{c.webhookFile, &s.webhookSecret},
+	} {
+		if f.path == "" {
+			continue
+		}
+		v, err := readSecret(f.path)
+		if err != nil {
+			return secrets{}, err
+		}
+		*f.value = v
+	}
+	return s, nil
+}
+
+// secretFiles returns the configured secret files.
+func (c *config) secretFiles() []string {
+	var files []string
+	for _, f := range []string{c.tokenFile, c.authFile, c.webhookFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// watchSecrets reloads the credentials from their files when the process
+// receives SIGHUP, or when a file's modification time changes. It returns when
+// ctx is done.
+func (e *env) watchSecrets(ctx context.Context) {
+	files := e.secretFiles()
+	if len(files) == 0 {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if e.poll > 0 {
+		t := time.NewTicker(e.poll)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	modTimes := func() map[string]time.Time {
+		m := make(map[string]time.Time)
+		for _, f := range files {
+			if fi, err := os.Stat(f); err == nil {
+				m[f] = fi.ModTime()
+			}
+		}
+		return m
+	}
+	last := modTimes()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			e.Logger.Info("received SIGHUP, reloading credentials")
+		case <-tick:
+			current := modTimes()
+			changed := false
+			for _, f := range files {
+				changed = changed || !current[f].Equal(last[f])
+			}
+			if !changed {
+				continue
+			}
+			e.Logger.Info("secret files changed, reloading credentials")
+		}
+
+		last = modTimes()
+		if err := e.reloadSecrets(); err != nil {
+			e.Logger.Error("reloading credentials failed, keeping the current credentials", "error", err)
+			continue
+		}
+		e.Logger.Info("reloaded credentials")
+	}
+}
+
+// reloadSecrets reads the secret files and swaps the new credentials into the
+// running Quayd and server. If any can't be read or are invalid, none are
+// changed.
+func (e *env) reloadSecrets() error {
+	s, err := e.readSecretFiles()
+	if err != nil {
+		return err
+	}
+
+	e.Logger.Redact(s.token, s.auth, s.webhookSecret)
+	if i := strings.Index(s.auth, ":"); i >= 0 {
+		e.Logger.Redact(s.auth[i+1:])
+	}
+
+	if err := e.Credentials.Update(s.token, s.auth); err != nil {
+		return err
+	}
+	e.Credentials.UpdateWebhookSecret(s.webhookSecret)
+	e.token, e.auth, e.webhookSecret = s.token, s.auth, s.webhookSecret
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/timchunght/quayd"
+)
+
+func TestReloadSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quayd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "token")
+	authFile := filepath.Join(dir, "auth")
+	webhookFile := filepath.Join(dir, "webhook")
+	ioutil.WriteFile(tokenFile, []byte("1234\n"), 0600)
+	ioutil.WriteFile(authFile, []byte("user:pass\n"), 0600)
+	ioutil.WriteFile(webhookFile, []byte("s3cret\n"), 0600)
+
+	c := &config{tokenFile: tokenFile, authFile: authFile, webhookFile: webhookFile}
+	if err := c.readSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.token, "1234"; got != want {
+		t.Fatalf("token => %q; want %q", got, want)
+	}
+
+	if got, want := c.webhookSecret, "s3cret"; got != want {
+		t.Fatalf("webhookSecret => %q; want %q", got, want)
+	}
+
+	creds, _ := quayd.NewCredentials(c.token, c.auth)
+	e := &env{config: c, Logger: quayd.NewLogger(ioutil.Discard, quayd.FormatLogfmt, quayd.LevelInfo), Credentials: creds}
+
+	ioutil.WriteFile(tokenFile, []byte("5678\n"), 0600)
+	ioutil.WriteFile(webhookFile, []byte("rotated\n"), 0600)
+	if err := e.reloadSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := creds.GitHubToken(), "5678"; got != want {
+		t.Fatalf("GitHubToken => %q; want %q", got, want)
+	}
+	if got, want := creds.WebhookSecret(), "rotated"; got != want {
+		t.Fatalf("WebhookSecret => %q; want %q", got, want)
+	}
+
+	// Invalid credentials are rejected and the old ones kept.
+	ioutil.WriteFile(authFile, []byte("nopassword\n"), 0600)
+	if err := e.reloadSecrets(); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if _, password := creds.Registry(); password != "pass" {
+		t.Fatalf("Password => %q; want pass", password)
+	}
+	if got, want := c.auth, "user:pass"; got != want {
+		t.Fatalf("auth => %q; want %q", got, want)
+	}
+
+	// So is the webhook secret that was read alongside them.
+	ioutil.WriteFile(webhookFile, []byte("ignored\n"), 0600)
+	if err := e.reloadSecrets(); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if got, want := creds.WebhookSecret(), "rotated"; got != want {
+		t.Fatalf("WebhookSecret => %q; want %q", got, want)
+	}
+	if got, want := c.webhookSecret, "rotated"; got != want {
+		t.Fatalf("webhookSecret => %q; want %q", got, want)
+	}
+}
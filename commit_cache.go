@@ -0,0 +1,156 @@
+package quayd
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for a CachedCommitResolver.
+const (
+	DefaultCommitCacheSize = 1024
+	DefaultCommitCacheTTL  = time.Hour
+)
+
+// minShortSHALength is the shortest abbreviation git will resolve.
+const minShortSHALength = 4
+
+// ErrAmbiguousCommit is returned when a short sha matches more than one
+// commit, or is too short to identify one.
+var ErrAmbiguousCommit = errors.New("short sha is ambiguous")
+
+// IsFullSHA returns true if s is a full, 40 character, git commit sha.
+func IsFullSHA(s string) bool {
+	return len(s) == 40 && isHex(s)
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// CachedCommitResolver is a CommitResolver that caches the commits it
+// resolves, so that the several hooks Quay sends for a build only cost one
+// request. Full shas are returned without a lookup.
+type CachedCommitResolver struct {
+	CommitResolver
+
+	// Size is the most commits to cache, evicting the least recently used.
+	// Defaults to DefaultCommitCacheSize.
+	Size int
+
+	// TTL is how long a resolved commit is cached. Defaults to
+	// DefaultCommitCacheTTL.
+	TTL time.Duration
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+
+	// now returns the current time. It's replaced in tests.
+	now func() time.Time
+}
+
+type commitCacheEntry struct {
+	key     string
+	sha     string
+	expires time.Time
+}
+
+// Resolve implements CommitResolver Resolve.
+func (cr *CachedCommitResolver) Resolve(ctx context.Context, repo, short string) (string, error) {
+	if IsFullSHA(short) {
+		commitCacheTotal.Inc("full_sha")
+		return strings.ToLower(short), nil
+	}
+
+	key := strings.ToLower(repo + "@" + short)
+	if sha, ok := cr.get(key); ok {
+		commitCacheTotal.Inc("hit")
+		return sha, nil
+	}
+	commitCacheTotal.Inc("miss")
+
+	sha, err := cr.CommitResolver.Resolve(ctx, repo, short)
+	if err != nil {
+		return "", err
+	}
+	cr.add(key, sha)
+	return sha, nil
+}
+
+func (cr *CachedCommitResolver) get(key string) (string, bool) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	el, ok := cr.items[key]
+	if !ok {
+		return "", false
+	}
+	e := el.Value.(*commitCacheEntry)
+	if cr.clock().After(e.expires) {
+		cr.ll.Remove(el)
+		delete(cr.items, key)
+		return "", false
+	}
+	cr.ll.MoveToFront(el)
+	return e.sha, true
+}
+
+func (cr *CachedCommitResolver) add(key, sha string) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if cr.ll == nil {
+		cr.ll = list.New()
+		cr.items = make(map[string]*list.Element)
+	}
+
+	ttl := cr.TTL
+	if ttl == 0 {
+		ttl = DefaultCommitCacheTTL
+	}
+	expires := cr.clock().Add(ttl)
+
+	if el, ok := cr.items[key]; ok {
+		e := el.Value.(*commitCacheEntry)
+		e.sha, e.expires = sha, expires
+		cr.ll.MoveToFront(el)
+		return
+	}
+	cr.items[key] = cr.ll.PushFront(&commitCacheEntry{key: key, sha: sha, expires: expires})
+
+	size := cr.Size
+	if size == 0 {
+		size = DefaultCommitCacheSize
+	}
+	for cr.ll.Len() > size {
+		el := cr.ll.Back()
+		cr.ll.Remove(el)
+		delete(cr.items, el.Value.(*commitCacheEntry).key)
+	}
+}
+
+// Len returns the number of cached commits.
+func (cr *CachedCommitResolver) Len() int {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if cr.ll == nil {
+		return 0
+	}
+	return cr.ll.Len()
+}
+
+func (cr *CachedCommitResolver) clock() time.Time {
+	if cr.now == nil {
+		return time.Now()
+	}
+	return cr.now()
+}
@@ -0,0 +1,122 @@
+package quayd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ejholmes/go-github/github"
+)
+
+// countingCommitResolver counts the calls made to it.
+type countingCommitResolver struct {
+	calls int
+	err   error
+}
+
+func (cr *countingCommitResolver) Resolve(ctx context.Context, repo, short string) (string, error) {
+	cr.calls++
+	if cr.err != nil {
+		return "", cr.err
+	}
+	return short + "-long", nil
+}
+
+func TestCachedCommitResolver(t *testing.T) {
+	r := new(countingCommitResolver)
+	now := time.Now()
+	cr := &CachedCommitResolver{CommitResolver: r, Size: 2, TTL: time.Minute, now: func() time.Time { return now }}
+	ctx := context.Background()
+
+	tests := []struct {
+		repo, short string
+		calls       int
+	}{
+		{"remind101/r101-api", "abcd", 1},
+		{"remind101/r101-api", "abcd", 1},
+		{"remind101/r101-api", "ABCD", 1},
+		{"remind101/acme-inc", "abcd", 2},
+		{"remind101/r101-api", "1234", 3},
+
+		// The least recently used entry was evicted.
+		{"remind101/r101-api", "abcd", 4},
+		{"remind101/r101-api", "1234", 4},
+
+		// Full shas never need a lookup.
+		{"remind101/r101-api", "9bd5d28d5f5b1a0bd8d9d6a43dd7f5b4e22b4ac7", 4},
+	}
+
+	for _, tt := range tests {
+		if _, err := cr.Resolve(ctx, tt.repo, tt.short); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := r.calls, tt.calls; got != want {
+			t.Fatalf("Resolve(%s, %s) => %d calls; want %d", tt.repo, tt.short, got, want)
+		}
+	}
+
+	if got, want := cr.Len(), 2; got != want {
+		t.Fatalf("Len => %d; want %d", got, want)
+	}
+
+	// Entries expire after the TTL.
+	now = now.Add(2 * time.Minute)
+	cr.Resolve(ctx, "remind101/r101-api", "1234")
+	if got, want := r.calls, 5; got != want {
+		t.Fatalf("Calls after expiry => %d; want %d", got, want)
+	}
+}
+
+func TestCachedCommitResolver_Error(t *testing.T) {
+	r := &countingCommitResolver{err: errors.New("boom")}
+	cr := &CachedCommitResolver{CommitResolver: r}
+
+	for i := 0; i < 2; i++ {
+		if _, err := cr.Resolve(context.Background(), "remind101/r101-api", "abcd"); err != r.err {
+			t.Fatalf("Err => %v; want %v", err, r.err)
+		}
+	}
+	if got, want := r.calls, 2; got != want {
+		t.Fatalf("Errors should not be cached: %d calls; want %d", got, want)
+	}
+}
+
+func TestGitHubCommitResolver_Ambiguous(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"message": "Commit SHA ab12 is ambiguous"}`))
+	}))
+	defer s.Close()
+
+	g := github.NewClient(nil)
+	g.BaseURL, _ = url.Parse(s.URL + "/")
+	cr := &GitHubCommitResolver{Client: g}
+
+	for _, short := range []string{"ab12", "ab1"} {
+		if _, err := cr.Resolve(context.Background(), "remind101/r101-api", short); err != ErrAmbiguousCommit {
+			t.Fatalf("Resolve(%s) err => %v; want %v", short, err, ErrAmbiguousCommit)
+		}
+	}
+}
+
+func TestWebhookForm_Ref(t *testing.T) {
+	sha := "9bd5d28d5f5b1a0bd8d9d6a43dd7f5b4e22b4ac7"
+	tests := []struct {
+		form WebhookForm
+		ref  string
+	}{
+		{WebhookForm{BuildName: "9bd5d28", TriggerMetadata: map[string]interface{}{"commit": sha}}, sha},
+		{WebhookForm{BuildName: "9bd5d28", TriggerMetadata: map[string]interface{}{"commit": "9bd5d28"}}, "9bd5d28"},
+		{WebhookForm{BuildName: "9bd5d28"}, "9bd5d28"},
+	}
+
+	for _, tt := range tests {
+		if got, want := tt.form.Ref(), tt.ref; got != want {
+			t.Fatalf("Ref => %s; want %s", got, want)
+		}
+	}
+}
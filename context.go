@@ -0,0 +1,155 @@
+package quayd
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultTimeout is the default timeout applied to each backend call.
+const DefaultTimeout = 10 * time.Second
+
+// DefaultTimeouts are the Timeouts used when a Quayd has none configured.
+var DefaultTimeouts = Timeouts{
+	CommitResolver:     DefaultTimeout,
+	StatusesRepository: DefaultTimeout,
+	Tagger:             DefaultTimeout,
+	TagResolver:        DefaultTimeout,
+	Hooks:              DefaultTimeout,
+}
+
+// Timeouts bounds how long each backend call may take. A zero value means the
+// call is only bounded by the caller's context.
+type Timeouts struct {
+	CommitResolver     time.Duration
+	StatusesRepository time.Duration
+	Tagger             time.Duration
+	TagResolver        time.Duration
+
+	// Hooks bounds each BuildHook.
+	Hooks time.Duration
+}
+
+// withTimeout returns a context that's cancelled after d, or ctx itself if d
+// is zero.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// BasicStatusesRepository is the StatusesRepository interface as it was
+// before calls took a context. Use AdaptStatusesRepository to use an
+// implementation of it as a StatusesRepository.
+type BasicStatusesRepository interface {
+	Create(*Status) error
+}
+
+// BasicCommitResolver is the CommitResolver interface as it was before calls
+// took a context.
+type BasicCommitResolver interface {
+	Resolve(repo, short string) (string, error)
+}
+
+// BasicTagger is the Tagger interface as it was before calls took a context.
+type BasicTagger interface {
+	Tag(repo, imageID, tag string) error
+}
+
+// BasicTagResolver is the TagResolver interface as it was before calls took a
+// context.
+type BasicTagResolver interface {
+	Resolve(repo, tag string) (string, error)
+}
+
+// AdaptStatusesRepository returns a StatusesRepository that calls r. If the
+// context is done before r returns, the call is abandoned and the context's
+// error is returned.
+func AdaptStatusesRepository(r BasicStatusesRepository) StatusesRepository {
+	return &statusesRepositoryAdapter{r}
+}
+
+type statusesRepositoryAdapter struct {
+	r BasicStatusesRepository
+}
+
+func (a *statusesRepositoryAdapter) Create(ctx context.Context, status *Status) error {
+	_, err := await(ctx, func() (string, error) {
+		return "", a.r.Create(status)
+	})
+	return err
+}
+
+// AdaptCommitResolver returns a CommitResolver that calls cr, abandoning the
+// call if the context is done first.
+func AdaptCommitResolver(cr BasicCommitResolver) CommitResolver {
+	return &commitResolverAdapter{cr}
+}
+
+type commitResolverAdapter struct {
+	cr BasicCommitResolver
+}
+
+func (a *commitResolverAdapter) Resolve(ctx context.Context, repo, short string) (string, error) {
+	return await(ctx, func() (string, error) {
+		return a.cr.Resolve(repo, short)
+	})
+}
+
+// AdaptTagger returns a Tagger that calls t, abandoning the call if the
+// context is done first.
+func AdaptTagger(t BasicTagger) Tagger {
+	return &taggerAdapter{t}
+}
+
+type taggerAdapter struct {
+	t BasicTagger
+}
+
+func (a *taggerAdapter) Tag(ctx context.Context, repo, imageID, tag string) error {
+	_, err := await(ctx, func() (string, error) {
+		return "", a.t.Tag(repo, imageID, tag)
+	})
+	return err
+}
+
+// AdaptTagResolver returns a TagResolver that calls r, abandoning the call if
+// the context is done first.
+func AdaptTagResolver(r BasicTagResolver) TagResolver {
+	return &tagResolverAdapter{r}
+}
+
+type tagResolverAdapter struct {
+	r BasicTagResolver
+}
+
+func (a *tagResolverAdapter) Resolve(ctx context.Context, repo, tag string) (string, error) {
+	return await(ctx, func() (string, error) {
+		return a.r.Resolve(repo, tag)
+	})
+}
+
+// await runs fn in a goroutine and waits for it to return or for ctx to be
+// done, whichever happens first.
+func await(ctx context.Context, fn func() (string, error)) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	type result struct {
+		s   string
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		s, err := fn()
+		ch <- result{s, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.s, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
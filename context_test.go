@@ -0,0 +1,57 @@
+package quayd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// slowCommitResolver is a BasicCommitResolver that takes d to resolve.
+type slowCommitResolver struct {
+	d time.Duration
+}
+
+func (cr *slowCommitResolver) Resolve(repo, short string) (string, error) {
+	time.Sleep(cr.d)
+	return "long-" + short, nil
+}
+
+func TestAdaptCommitResolver(t *testing.T) {
+	cr := AdaptCommitResolver(&slowCommitResolver{})
+
+	sha, err := cr.Resolve(context.Background(), "ejholmes/docker-statsd", "6607c19")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := sha, "long-6607c19"; got != want {
+		t.Fatalf("Sha => %s; want %s", got, want)
+	}
+}
+
+func TestAdaptCommitResolver_Timeout(t *testing.T) {
+	cr := AdaptCommitResolver(&slowCommitResolver{d: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := cr.Resolve(ctx, "ejholmes/docker-statsd", "6607c19"); err != context.DeadlineExceeded {
+		t.Fatalf("Err => %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestQuayd_HandleTimeout(t *testing.T) {
+	q := &Quayd{
+		CommitResolver: AdaptCommitResolver(&slowCommitResolver{d: time.Second}),
+		Timeouts:       &Timeouts{CommitResolver: 10 * time.Millisecond},
+	}
+
+	start := time.Now()
+	if err := q.Handle(context.Background(), "ejholmes/docker-statsd", "6607c19", "", "pending"); err != context.DeadlineExceeded {
+		t.Fatalf("Err => %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("Handle took %s; want it to time out", d)
+	}
+}
@@ -0,0 +1,80 @@
+package quayd
+
+import (
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// Credentials holds the GitHub token and registry credentials used by the
+// backends, and the secret that webhooks must send. They're read on every
+// request, so calling Update or UpdateWebhookSecret rotates them without a
+// restart. Requests already in flight finish with the credentials they
+// started with.
+type Credentials struct {
+	mu            sync.RWMutex
+	githubToken   string
+	username      string
+	password      string
+	webhookSecret string
+}
+
+// NewCredentials returns Credentials for a GitHub token and registry
+// credentials in the form username:password.
+func NewCredentials(githubToken, registryAuth string) (*Credentials, error) {
+	c := &Credentials{}
+	if err := c.Update(githubToken, registryAuth); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Update replaces the credentials. If registryAuth is invalid, nothing is
+// changed.
+func (c *Credentials) Update(githubToken, registryAuth string) error {
+	username, password, err := ParseRegistryAuth(registryAuth)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.githubToken = githubToken
+	c.username = username
+	c.password = password
+	return nil
+}
+
+// UpdateWebhookSecret replaces the webhook secret.
+func (c *Credentials) UpdateWebhookSecret(secret string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.webhookSecret = secret
+}
+
+// WebhookSecret returns the current webhook secret.
+func (c *Credentials) WebhookSecret() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.webhookSecret
+}
+
+// GitHubToken returns the current GitHub token.
+func (c *Credentials) GitHubToken() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.githubToken
+}
+
+// Registry returns the current registry username and password.
+func (c *Credentials) Registry() (username, password string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.username, c.password
+}
+
+// Token implements oauth2.TokenSource. Tokens are deliberately not cached by
+// an oauth2.ReuseTokenSource, so that rotated tokens are used straight away.
+func (c *Credentials) Token() (*oauth2.Token, error) {
+	return &oauth2.Token{AccessToken: c.GitHubToken()}, nil
+}
@@ -0,0 +1,63 @@
+package quayd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCredentials_Update(t *testing.T) {
+	c, err := NewCredentials("1234", "user:pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Update("5678", "user"); err != ErrInvalidRegistryAuth {
+		t.Fatalf("Err => %v; want %v", err, ErrInvalidRegistryAuth)
+	}
+	if got, want := c.GitHubToken(), "1234"; got != want {
+		t.Fatalf("Token => %s; want %s", got, want)
+	}
+
+	if err := c.Update("5678", "user:rotated"); err != nil {
+		t.Fatal(err)
+	}
+	token, _ := c.Token()
+	if got, want := token.AccessToken, "5678"; got != want {
+		t.Fatalf("Token => %s; want %s", got, want)
+	}
+	if _, password := c.Registry(); password != "rotated" {
+		t.Fatalf("Password => %s; want rotated", password)
+	}
+}
+
+func TestNewWithOptions_RotatesCredentials(t *testing.T) {
+	var auths []string
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, p, _ := r.BasicAuth()
+		auths = append(auths, p)
+	}))
+	defer s.Close()
+
+	creds, _ := NewCredentials("1234", "user:old")
+	q := NewWithOptions(Options{
+		Credentials: creds,
+		Registry:    strings.TrimPrefix(s.URL, "https://"),
+		HTTPClient:  s.Client(),
+	})
+
+	ctx := context.Background()
+	if err := q.Tagger.Tag(ctx, "ejholmes/docker-statsd", "abc", "latest"); err != nil {
+		t.Fatal(err)
+	}
+	creds.Update("1234", "user:new")
+	if err := q.Tagger.Tag(ctx, "ejholmes/docker-statsd", "abc", "latest"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(auths, ","), "old,new"; got != want {
+		t.Fatalf("Passwords => %s; want %s", got, want)
+	}
+}
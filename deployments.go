@@ -0,0 +1,289 @@
+package quayd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ejholmes/go-github/github"
+)
+
+// DefaultDeploymentTrackerSize is the number of builds whose deployments a
+// Deployer remembers.
+const DefaultDeploymentTrackerSize = 500
+
+// Deployment is a GitHub Deployment of a commit's image.
+type Deployment struct {
+	// Ref is the commit sha to deploy.
+	Ref         string
+	Environment string
+	Description string
+	Payload     DeploymentPayload
+}
+
+// DeploymentPayload is the payload of a Deployment, telling the CD system
+// which image to deploy.
+type DeploymentPayload struct {
+	// Image is the image repository, e.g. quay.io/owner/name.
+	Image string `json:"image"`
+
+	// Digest identifies the built image. The registry only knows images by
+	// id, so it's the image id.
+	Digest string `json:"digest"`
+
+	// Tag is the image tag for the commit, which is the commit sha.
+	Tag string `json:"tag"`
+
+	// BuildID is Quay's build id.
+	BuildID string `json:"build_id"`
+}
+
+// DeploymentStatus is a status of a GitHub Deployment.
+type DeploymentStatus struct {
+	// State is one of pending, queued, in_progress, success, failure, error
+	// or inactive.
+	State       string
+	TargetURL   string
+	Description string
+}
+
+// DeploymentsRepository represents something that can create GitHub
+// Deployments and their statuses.
+type DeploymentsRepository interface {
+	// CreateDeployment creates a deployment, returning its id.
+	CreateDeployment(ctx context.Context, repo string, d *Deployment) (int64, error)
+
+	// CreateDeploymentStatus creates a status for the deployment.
+	CreateDeploymentStatus(ctx context.Context, repo string, id int64, s *DeploymentStatus) error
+}
+
+// deploymentsRepository is a fake implementation of the
+// DeploymentsRepository interface.
+type deploymentsRepository struct {
+	sync.Mutex
+	deployments []*Deployment
+	statuses    map[int64][]*DeploymentStatus
+
+	// unavailable is an environment whose deployments fail.
+	unavailable string
+}
+
+func (r *deploymentsRepository) CreateDeployment(ctx context.Context, repo string, d *Deployment) (int64, error) {
+	r.Lock()
+	defer r.Unlock()
+	if d.Environment == r.unavailable {
+		return 0, fmt.Errorf("%s is unavailable", d.Environment)
+	}
+	r.deployments = append(r.deployments, d)
+	return int64(len(r.deployments)), nil
+}
+
+func (r *deploymentsRepository) CreateDeploymentStatus(ctx context.Context, repo string, id int64, s *DeploymentStatus) error {
+	r.Lock()
+	defer r.Unlock()
+	if r.statuses == nil {
+		r.statuses = make(map[int64][]*DeploymentStatus)
+	}
+	r.statuses[id] = append(r.statuses[id], s)
+	return nil
+}
+
+// GitHubDeploymentsRepository is an implementation of the
+// DeploymentsRepository interface backed by GitHub.
+type GitHubDeploymentsRepository struct {
+	Client *github.Client
+
+	// Budget, if set, tracks the rate limit reported by GitHub.
+	Budget *GitHubBudget
+}
+
+// deploymentsPreview enables the queued and in_progress deployment states.
+const deploymentsPreview = "application/vnd.github.flash-preview+json, application/vnd.github.ant-man-preview+json"
+
+// CreateDeployment implements DeploymentsRepository CreateDeployment.
+func (r *GitHubDeploymentsRepository) CreateDeployment(ctx context.Context, repo string, d *Deployment) (int64, error) {
+	body := map[string]interface{}{
+		"ref":         d.Ref,
+		"environment": d.Environment,
+		"description": d.Description,
+		"payload":     d.Payload,
+		// The image exists, so there's nothing to merge, and the commit's
+		// statuses were already checked by building it.
+		"auto_merge":        false,
+		"required_contexts": []string{},
+	}
+
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	resp, err := githubDoAccept(ctx, r.Client, "POST", fmt.Sprintf("repos/%s/deployments", repo), deploymentsPreview, body, &created)
+	r.Budget.Update(resp)
+	return created.ID, err
+}
+
+// CreateDeploymentStatus implements DeploymentsRepository
+// CreateDeploymentStatus.
+func (r *GitHubDeploymentsRepository) CreateDeploymentStatus(ctx context.Context, repo string, id int64, s *DeploymentStatus) error {
+	body := map[string]string{
+		"state":       s.State,
+		"log_url":     s.TargetURL,
+		"target_url":  s.TargetURL,
+		"description": s.Description,
+	}
+	resp, err := githubDoAccept(ctx, r.Client, "POST", fmt.Sprintf("repos/%s/deployments/%d/statuses", repo, id), deploymentsPreview, body, nil)
+	r.Budget.Update(resp)
+	return err
+}
+
+// DeploymentRule deploys builds of a branch of some repositories to an
+// environment.
+type DeploymentRule struct {
+	// Repository is an owner ("acme") or repository ("acme/api").
+	Repository string
+
+	// Branch is the deployable branch.
+	Branch string
+
+	// Environment is the environment to deploy to.
+	Environment string
+}
+
+// matches returns true if the rule deploys builds of branch of repo.
+func (r DeploymentRule) matches(repo, branch string) bool {
+	return matchRepo(r.Repository, repo) && r.Branch == branch
+}
+
+// ParseDeploymentRules parses a comma separated list of rules of the form
+// repository:branch=environment, e.g.
+// "acme/api:master=production,acme:develop=staging".
+func ParseDeploymentRules(s string) ([]DeploymentRule, error) {
+	var rules []DeploymentRule
+	for _, spec := range strings.Split(s, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		i, j := strings.Index(spec, ":"), strings.Index(spec, "=")
+		if i <= 0 || j <= i+1 || j == len(spec)-1 {
+			return nil, fmt.Errorf("invalid deployment rule %q: expected repository:branch=environment", spec)
+		}
+		rules = append(rules, DeploymentRule{
+			Repository:  spec[:i],
+			Branch:      spec[i+1 : j],
+			Environment: spec[j+1:],
+		})
+	}
+	return rules, nil
+}
+
+// Deployer is a BuildHook that creates a GitHub Deployment for each
+// environment that a successful build is deployable to, and marks it queued
+// for the CD system. The deployments are tracked by build and environment, so
+// a redelivered or retried event only creates the ones that are missing.
+type Deployer struct {
+	Deployments DeploymentsRepository
+	Rules       []DeploymentRule
+
+	// Size is the number of builds to track. Defaults to
+	// DefaultDeploymentTrackerSize.
+	Size int
+
+	mu     sync.Mutex
+	builds map[string]map[string]int64
+	order  []string
+}
+
+// BuildEvent implements BuildHook BuildEvent. Success is the last event Quay
+// sends for a build, so a deployment is only ever queued by quayd; the CD
+// system reports its progress from there.
+func (d *Deployer) BuildEvent(ctx context.Context, b *Build) error {
+	if b.Status != "success" {
+		return nil
+	}
+
+	ids, err := d.deploy(ctx, b)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		err := d.Deployments.CreateDeploymentStatus(ctx, b.Repository, id, &DeploymentStatus{
+			State:       "queued",
+			TargetURL:   b.URL,
+			Description: Statuses[b.Status],
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deploy creates a deployment for every environment the build is deployable
+// to that doesn't have one yet, and returns the ids of all of the build's
+// deployments. Each deployment is tracked as soon as it's created, so that it
+// isn't duplicated if a later one fails and the event is retried.
+func (d *Deployer) deploy(ctx context.Context, b *Build) ([]int64, error) {
+	var ids []int64
+	seen := make(map[string]bool)
+	for _, rule := range d.Rules {
+		if !rule.matches(b.Repository, b.Branch) || seen[rule.Environment] {
+			continue
+		}
+		seen[rule.Environment] = true
+
+		if id, ok := d.tracked(b.ID, rule.Environment); ok {
+			ids = append(ids, id)
+			continue
+		}
+
+		id, err := d.Deployments.CreateDeployment(ctx, b.Repository, &Deployment{
+			Ref:         b.Commit,
+			Environment: rule.Environment,
+			Description: fmt.Sprintf("Deploy %s to %s", b.ImageRef(), rule.Environment),
+			Payload: DeploymentPayload{
+				Image:   b.Image,
+				Digest:  b.ImageID,
+				Tag:     b.Commit,
+				BuildID: b.ID,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		d.track(b.ID, rule.Environment, id)
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (d *Deployer) tracked(buildID, environment string) (int64, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	id, ok := d.builds[buildID][environment]
+	return id, ok
+}
+
+func (d *Deployer) track(buildID, environment string, id int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.builds == nil {
+		d.builds = make(map[string]map[string]int64)
+	}
+	if d.builds[buildID] == nil {
+		d.builds[buildID] = make(map[string]int64)
+		d.order = append(d.order, buildID)
+	}
+	d.builds[buildID][environment] = id
+
+	size := d.Size
+	if size == 0 {
+		size = DefaultDeploymentTrackerSize
+	}
+	for len(d.order) > size {
+		delete(d.builds, d.order[0])
+		d.order = d.order[1:]
+	}
+}
@@ -0,0 +1,170 @@
+package quayd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ejholmes/go-github/github"
+)
+
+func TestParseDeploymentRules(t *testing.T) {
+	rules, err := ParseDeploymentRules("ejholmes/docker-statsd:master=production, ejholmes:develop=staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []DeploymentRule{
+		{"ejholmes/docker-statsd", "master", "production"},
+		{"ejholmes", "develop", "staging"},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("Rules => %v; want %v", rules, want)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Fatalf("Rules => %v; want %v", rules, want)
+		}
+	}
+
+	for _, in := range []string{"ejholmes/docker-statsd", "ejholmes:master", "ejholmes:=production", ":master=production"} {
+		if _, err := ParseDeploymentRules(in); err == nil {
+			t.Fatalf("ParseDeploymentRules(%q): expected an error", in)
+		}
+	}
+}
+
+func TestDeployer(t *testing.T) {
+	r := new(deploymentsRepository)
+	d := &Deployer{Deployments: r, Rules: []DeploymentRule{
+		{"ejholmes", "master", "staging"},
+		{"ejholmes/docker-statsd", "master", "production"},
+		{"ejholmes/docker-statsd", "develop", "qa"},
+	}}
+	ctx := context.Background()
+
+	b := &Build{ID: "1", Repository: "ejholmes/docker-statsd", Commit: "6607c19d3fd492ec53439f4104b39e4c62ece179", Branch: "master", Image: "quay.io/ejholmes/docker-statsd", ImageID: "abcd"}
+
+	// Nothing is deployed until the build succeeds.
+	b.Status = "pending"
+	if err := d.BuildEvent(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(r.deployments), 0; got != want {
+		t.Fatalf("Deployments => %d; want %d", got, want)
+	}
+
+	// A redelivered success doesn't create more deployments.
+	b.Status = "success"
+	for i := 0; i < 2; i++ {
+		if err := d.BuildEvent(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := len(r.deployments), 2; got != want {
+		t.Fatalf("Deployments => %d; want %d", got, want)
+	}
+	if got, want := r.deployments[1].Environment, "production"; got != want {
+		t.Fatalf("Environment => %s; want %s", got, want)
+	}
+	if got, want := r.deployments[1].Payload, (DeploymentPayload{Image: "quay.io/ejholmes/docker-statsd", Digest: "abcd", Tag: b.Commit, BuildID: "1"}); got != want {
+		t.Fatalf("Payload => %v; want %v", got, want)
+	}
+
+	if got, want := r.statuses[1][0].State, "queued"; got != want {
+		t.Fatalf("State => %s; want %s", got, want)
+	}
+}
+
+func TestDeployer_PartialFailure(t *testing.T) {
+	r := &deploymentsRepository{unavailable: "production"}
+	d := &Deployer{Deployments: r, Rules: []DeploymentRule{
+		{"ejholmes", "master", "staging"},
+		{"ejholmes/docker-statsd", "master", "production"},
+	}}
+	ctx := context.Background()
+
+	b := &Build{ID: "1", Status: "success", Repository: "ejholmes/docker-statsd", Commit: "6607c19d3fd492ec53439f4104b39e4c62ece179", Branch: "master"}
+	if err := d.BuildEvent(ctx, b); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	// A retry only creates the deployment that's missing.
+	r.unavailable = ""
+	if err := d.BuildEvent(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(r.deployments), 2; got != want {
+		t.Fatalf("Deployments => %d; want %d", got, want)
+	}
+	for i, want := range []string{"staging", "production"} {
+		if got := r.deployments[i].Environment; got != want {
+			t.Fatalf("Environment %d => %s; want %s", i, got, want)
+		}
+	}
+}
+
+func TestWebhook_Deployments(t *testing.T) {
+	r := new(deploymentsRepository)
+	q := &Quayd{Hooks: []NamedBuildHook{
+		{"deployments", &Deployer{Deployments: r, Rules: []DeploymentRule{{"ejholmes/docker-statsd", "master", "production"}}}},
+	}}
+	s := NewServer(q)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/quay/success", loadFixture("success_build", t))
+	s.ServeHTTP(resp, req)
+
+	if got, want := len(r.deployments), 1; got != want {
+		t.Fatalf("Deployments => %d; want %d", got, want)
+	}
+	if got, want := r.deployments[0].Ref, "6607c19d3fd492ec53439f4104b39e4c62ece179"; got != want {
+		t.Fatalf("Ref => %s; want %s", got, want)
+	}
+	if got, want := r.deployments[0].Payload.Image, "quay.io/ejholmes/docker-statsd"; got != want {
+		t.Fatalf("Image => %s; want %s", got, want)
+	}
+}
+
+func TestGitHubDeploymentsRepository(t *testing.T) {
+	var body map[string]interface{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/repos/ejholmes/docker-statsd/deployments":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 42}`))
+		case "/repos/ejholmes/docker-statsd/deployments/42/statuses":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	g := github.NewClient(nil)
+	g.BaseURL, _ = url.Parse(s.URL + "/")
+	r := &GitHubDeploymentsRepository{Client: g}
+
+	id, err := r.CreateDeployment(context.Background(), "ejholmes/docker-statsd", &Deployment{Ref: "6607c19", Environment: "production", Payload: DeploymentPayload{Tag: "6607c19"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := id, int64(42); got != want {
+		t.Fatalf("ID => %d; want %d", got, want)
+	}
+	if got, want := body["payload"].(map[string]interface{})["tag"], "6607c19"; got != want {
+		t.Fatalf("Payload tag => %v; want %v", got, want)
+	}
+
+	if err := r.CreateDeploymentStatus(context.Background(), "ejholmes/docker-statsd", id, &DeploymentStatus{State: "queued"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := body["state"], "queued"; got != want {
+		t.Fatalf("State => %v; want %v", got, want)
+	}
+}
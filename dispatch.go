@@ -0,0 +1,229 @@
+package quayd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+)
+
+// Defaults for a Dispatcher.
+const (
+	DefaultDeliveryAttempts = 5
+	DefaultDeliveryBackoff  = time.Second
+	DefaultMaxBackoff       = time.Minute
+	DefaultDeliveryQueue    = 1000
+	DefaultDeliveryWorkers  = 4
+)
+
+// DefaultDispatcher is the Dispatcher used for notifications and events when
+// no other is configured.
+var DefaultDispatcher = &Dispatcher{}
+
+// Dispatcher delivers notifications and events in the background, retrying
+// failed deliveries with exponential backoff, so that slow or broken
+// receivers never hold up webhooks or tagging.
+type Dispatcher struct {
+	// Attempts is the most times a delivery is tried. Defaults to
+	// DefaultDeliveryAttempts.
+	Attempts int
+
+	// Backoff is the wait before the first retry, doubling on each retry
+	// up to MaxBackoff. They default to DefaultDeliveryBackoff and
+	// DefaultMaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Timeout bounds each attempt. Defaults to DefaultTimeout.
+	Timeout time.Duration
+
+	// QueueSize is the most deliveries waiting for a worker. Deliveries
+	// beyond it are dropped. Defaults to DefaultDeliveryQueue.
+	QueueSize int
+
+	// Workers is the number of concurrent deliveries. Defaults to
+	// DefaultDeliveryWorkers.
+	Workers int
+
+	// Logger logs failed deliveries. Defaults to DefaultLogger.
+	Logger *Logger
+
+	once  sync.Once
+	queue chan *delivery
+	wg    sync.WaitGroup
+}
+
+type delivery struct {
+	sink string
+	fn   func(context.Context) error
+}
+
+// Go queues fn for delivery to sink, which names the receiver in logs and
+// metrics. It returns false if the queue is full and the delivery was
+// dropped.
+func (d *Dispatcher) Go(sink string, fn func(context.Context) error) bool {
+	d.once.Do(d.start)
+
+	d.wg.Add(1)
+	select {
+	case d.queue <- &delivery{sink: sink, fn: fn}:
+		return true
+	default:
+		d.wg.Done()
+		deliveriesTotal.Inc(sink, "dropped")
+		d.logger().Error("delivery queue full, dropping delivery", "sink", sink)
+		return false
+	}
+}
+
+// Wait blocks until every queued delivery has succeeded or given up.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) start() {
+	size := d.QueueSize
+	if size == 0 {
+		size = DefaultDeliveryQueue
+	}
+	d.queue = make(chan *delivery, size)
+
+	workers := d.Workers
+	if workers == 0 {
+		workers = DefaultDeliveryWorkers
+	}
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+}
+
+func (d *Dispatcher) work() {
+	for dl := range d.queue {
+		d.deliver(dl)
+		d.wg.Done()
+	}
+}
+
+// deliver tries a delivery until it succeeds, fails permanently, or runs out
+// of attempts.
+func (d *Dispatcher) deliver(dl *delivery) {
+	attempts := d.Attempts
+	if attempts == 0 {
+		attempts = DefaultDeliveryAttempts
+	}
+	timeout := d.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err = dl.fn(ctx)
+		cancel()
+		if err == nil {
+			deliveriesTotal.Inc(dl.sink, "success")
+			return
+		}
+		if _, ok := err.(*permanentError); ok || attempt == attempts {
+			break
+		}
+
+		deliveriesTotal.Inc(dl.sink, "retry")
+		d.logger().Warn("delivery failed, retrying", "sink", dl.sink, "attempt", attempt, "error", err)
+		time.Sleep(d.backoff(attempt))
+	}
+
+	deliveriesTotal.Inc(dl.sink, "failed")
+	d.logger().Error("delivery failed", "sink", dl.sink, "error", err)
+}
+
+// backoff returns the wait after the given failed attempt.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	b, max := d.Backoff, d.MaxBackoff
+	if b == 0 {
+		b = DefaultDeliveryBackoff
+	}
+	if max == 0 {
+		max = DefaultMaxBackoff
+	}
+	for i := 1; i < attempt && b < max; i++ {
+		b *= 2
+	}
+	if b > max {
+		b = max
+	}
+	return b
+}
+
+func (d *Dispatcher) logger() *Logger {
+	if d.Logger == nil {
+		return DefaultLogger
+	}
+	return d.Logger
+}
+
+// unwrapURLError returns the cause of a *url.Error, which would otherwise
+// include the full url.
+func unwrapURLError(err error) error {
+	if uerr, ok := err.(*neturl.Error); ok {
+		return uerr.Err
+	}
+	return err
+}
+
+// permanentError is an error that retrying won't fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+// postJSON POSTs v as JSON to url. Client errors, other than 429 Too Many
+// Requests, are permanent.
+func postJSON(ctx context.Context, c *http.Client, url, contentType string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return Permanent(err)
+	}
+	return post(ctx, c, url, contentType, body)
+}
+
+// post POSTs body to url. Client errors, other than 429 Too Many Requests,
+// are permanent.
+func post(ctx context.Context, c *http.Client, url, contentType string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := httpClient(c).Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("POST %s: %v", req.URL.Host, unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		// Only the host is reported, since webhook urls are often
+		// secrets.
+		err := fmt.Errorf("POST %s: %s %s", req.URL.Host, resp.Status, bytes.TrimSpace(msg))
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
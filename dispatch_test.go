@@ -0,0 +1,97 @@
+package quayd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_Retry(t *testing.T) {
+	d := &Dispatcher{Backoff: time.Millisecond}
+
+	var calls int32
+	d.Go("test", func(ctx context.Context) error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	d.Wait()
+
+	if got, want := atomic.LoadInt32(&calls), int32(3); got != want {
+		t.Fatalf("Calls => %d; want %d", got, want)
+	}
+}
+
+func TestDispatcher_Permanent(t *testing.T) {
+	d := &Dispatcher{Backoff: time.Millisecond}
+
+	var calls int32
+	d.Go("test", func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return Permanent(errors.New("bad request"))
+	})
+	d.Wait()
+
+	if got, want := atomic.LoadInt32(&calls), int32(1); got != want {
+		t.Fatalf("Calls => %d; want %d", got, want)
+	}
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	d := &Dispatcher{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	tests := []struct {
+		attempt int
+		backoff time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{10, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got, want := d.backoff(tt.attempt), tt.backoff; got != want {
+			t.Fatalf("backoff(%d) => %v; want %v", tt.attempt, got, want)
+		}
+	}
+}
+
+func TestPost(t *testing.T) {
+	tests := []struct {
+		code      int
+		err       bool
+		permanent bool
+	}{
+		{http.StatusOK, false, false},
+		{http.StatusBadRequest, true, true},
+		{http.StatusTooManyRequests, true, false},
+		{http.StatusBadGateway, true, false},
+	}
+
+	for _, tt := range tests {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.code)
+		}))
+
+		err := post(context.Background(), nil, s.URL+"/secret", "application/json", []byte(`{}`))
+		s.Close()
+
+		if got, want := err != nil, tt.err; got != want {
+			t.Fatalf("%d: err => %v", tt.code, err)
+		}
+		if _, ok := err.(*permanentError); ok != tt.permanent {
+			t.Fatalf("%d: permanent => %v; want %v", tt.code, ok, tt.permanent)
+		}
+		if err != nil && strings.Contains(err.Error(), "secret") {
+			t.Fatalf("%d: err %q contains the url path", tt.code, err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package quayd
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuildTimerSize is the number of pending builds that a BuildTimer
+// remembers.
+const DefaultBuildTimerSize = 1000
+
+// SlowBuildThreshold is how long builds of some repositories can take before
+// they're slow.
+type SlowBuildThreshold struct {
+	// Repository is an owner ("acme"), repository ("acme/api") or "*".
+	Repository string
+
+	Threshold time.Duration
+}
+
+// ParseSlowBuildThresholds parses a comma separated list of thresholds of the
+// form repository=duration, e.g. "acme/api=10m,acme=20m,*=30m".
+func ParseSlowBuildThresholds(s string) ([]SlowBuildThreshold, error) {
+	var thresholds []SlowBuildThreshold
+	for _, spec := range strings.Split(s, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		i := strings.Index(spec, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid slow build threshold %q: expected repository=duration", spec)
+		}
+		d, err := time.ParseDuration(spec[i+1:])
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid slow build threshold %q: expected a positive duration", spec)
+		}
+		thresholds = append(thresholds, SlowBuildThreshold{Repository: spec[:i], Threshold: d})
+	}
+	return thresholds, nil
+}
+
+// BuildTimer measures how long builds take, from their pending webhook to
+// their success or failure webhook, by correlating the webhooks by build id.
+type BuildTimer struct {
+	// Thresholds are how long builds can take before they're slow. The
+	// most specific threshold for a repository applies.
+	Thresholds []SlowBuildThreshold
+
+	// Size is the number of pending builds to remember. Defaults to
+	// DefaultBuildTimerSize.
+	Size int
+
+	mu     sync.Mutex
+	starts map[string]time.Time
+	order  []string
+
+	// now returns the current time. It's replaced in tests.
+	now func() time.Time
+}
+
+// Track records a build event. When a build finishes, its Duration is set,
+// the duration is recorded, and Slow is set if it took longer than its
+// threshold. It's safe to call with a nil timer.
+func (t *BuildTimer) Track(b *Build) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clock()
+	if b.Status == "pending" {
+		// A replayed pending webhook doesn't restart the timer.
+		if _, ok := t.starts[b.ID]; !ok {
+			t.start(b.ID, now)
+		}
+		return
+	}
+
+	start, ok := t.starts[b.ID]
+	if !ok {
+		// quayd didn't see the build start, e.g. it restarted.
+		return
+	}
+	t.forget(b.ID)
+
+	b.Duration = now.Sub(start)
+	buildDuration.Observe(b.Duration.Seconds(), b.Repository, b.Status)
+
+	if threshold, ok := t.threshold(b.Repository); ok && b.Duration > threshold {
+		b.Slow = true
+		slowBuildsTotal.Inc(b.Repository)
+	}
+}
+
+// start records when a build started, forgetting the oldest build if too
+// many are pending. t.mu must be held.
+func (t *BuildTimer) start(id string, at time.Time) {
+	if t.starts == nil {
+		t.starts = make(map[string]time.Time)
+	}
+	t.starts[id] = at
+	t.order = append(t.order, id)
+
+	size := t.Size
+	if size == 0 {
+		size = DefaultBuildTimerSize
+	}
+	for len(t.order) > size {
+		delete(t.starts, t.order[0])
+		t.order = t.order[1:]
+	}
+}
+
+// forget stops tracking a build. t.mu must be held.
+func (t *BuildTimer) forget(id string) {
+	delete(t.starts, id)
+	for i, o := range t.order {
+		if o == id {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// threshold returns the most specific threshold for a repository: its own,
+// then its owner's, then "*".
+func (t *BuildTimer) threshold(repo string) (time.Duration, bool) {
+	var (
+		best        time.Duration
+		specificity = -1
+	)
+	for _, th := range t.Thresholds {
+		if !matchRepo(th.Repository, repo) {
+			continue
+		}
+		s := 0
+		if th.Repository != "*" {
+			s = 1 + strings.Count(th.Repository, "/")
+		}
+		if s > specificity {
+			best, specificity = th.Threshold, s
+		}
+	}
+	return best, specificity >= 0
+}
+
+// Pending returns the number of builds that have started but not finished.
+func (t *BuildTimer) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.starts)
+}
+
+func (t *BuildTimer) clock() time.Time {
+	if t.now == nil {
+		return time.Now()
+	}
+	return t.now()
+}
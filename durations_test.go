@@ -0,0 +1,126 @@
+package quayd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// failingTagResolver is a TagResolver that can't reach the registry.
+type failingTagResolver struct{}
+
+func (failingTagResolver) Resolve(ctx context.Context, repo, tag string) (string, error) {
+	return "", errors.New("registry is down")
+}
+
+func TestBuildTimer(t *testing.T) {
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	timer := &BuildTimer{
+		Thresholds: []SlowBuildThreshold{
+			{"*", 30 * time.Minute},
+			{"acme", 20 * time.Minute},
+			{"acme/api", 10 * time.Minute},
+		},
+		now: func() time.Time { return now },
+	}
+
+	tests := []struct {
+		after    time.Duration
+		build    Build
+		duration time.Duration
+		slow     bool
+	}{
+		{0, Build{ID: "1", Status: "pending", Repository: "acme/api"}, 0, false},
+		{0, Build{ID: "2", Status: "pending", Repository: "acme/web"}, 0, false},
+		{0, Build{ID: "3", Status: "pending", Repository: "remind101/r101-api"}, 0, false},
+		// A replayed pending webhook doesn't restart the timer.
+		{5 * time.Minute, Build{ID: "1", Status: "pending", Repository: "acme/api"}, 0, false},
+		{10 * time.Minute, Build{ID: "1", Status: "success", Repository: "acme/api"}, 15 * time.Minute, true},
+		{0, Build{ID: "2", Status: "failure", Repository: "acme/web"}, 15 * time.Minute, false},
+		{0, Build{ID: "3", Status: "success", Repository: "remind101/r101-api"}, 15 * time.Minute, false},
+		// The build was already finished.
+		{0, Build{ID: "1", Status: "success", Repository: "acme/api"}, 0, false},
+		// quayd didn't see the build start.
+		{0, Build{ID: "4", Status: "success", Repository: "acme/api"}, 0, false},
+	}
+
+	for i, tt := range tests {
+		now = now.Add(tt.after)
+		b := tt.build
+		timer.Track(&b)
+
+		if got, want := b.Duration, tt.duration; got != want {
+			t.Fatalf("#%d: Duration => %v; want %v", i, got, want)
+		}
+		if got, want := b.Slow, tt.slow; got != want {
+			t.Fatalf("#%d: Slow => %v; want %v", i, got, want)
+		}
+	}
+
+	if got, want := timer.Pending(), 0; got != want {
+		t.Fatalf("Pending => %d; want %d", got, want)
+	}
+	if got, want := buildDuration.Quantile(0.5, "acme/api", "success"), (15 * time.Minute).Seconds(); got != want {
+		t.Fatalf("Quantile => %v; want %v", got, want)
+	}
+}
+
+func TestBuildTimer_Size(t *testing.T) {
+	timer := &BuildTimer{Size: 2}
+	for _, id := range []string{"1", "2", "3"} {
+		timer.Track(&Build{ID: id, Status: "pending"})
+	}
+
+	if got, want := timer.Pending(), 2; got != want {
+		t.Fatalf("Pending => %d; want %d", got, want)
+	}
+
+	b := &Build{ID: "1", Status: "success"}
+	timer.Track(b)
+	if b.Duration != 0 {
+		t.Fatal("Expected the oldest build to be forgotten")
+	}
+}
+
+func TestWebhook_BuildTimerTaggingFailed(t *testing.T) {
+	timer := &BuildTimer{}
+	s := NewServer(&Quayd{
+		StatusesRepository: new(statusesRepository),
+		Timer:              timer,
+		TagResolver:        failingTagResolver{},
+	})
+
+	for _, status := range []string{"pending", "success"} {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/quay/"+status, loadFixture("success_build", t))
+		s.ServeHTTP(resp, req)
+	}
+
+	// The build finished, even though its image couldn't be tagged.
+	if got, want := timer.Pending(), 0; got != want {
+		t.Fatalf("Pending => %d; want %d", got, want)
+	}
+}
+
+func TestParseSlowBuildThresholds(t *testing.T) {
+	thresholds, err := ParseSlowBuildThresholds("acme/api=10m, *=1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(thresholds), 2; got != want {
+		t.Fatalf("Thresholds => %d; want %d", got, want)
+	}
+	if got, want := thresholds[0], (SlowBuildThreshold{"acme/api", 10 * time.Minute}); got != want {
+		t.Fatalf("Threshold => %v; want %v", got, want)
+	}
+
+	for _, in := range []string{"acme/api", "=10m", "acme=soon", "acme=-1m"} {
+		if _, err := ParseSlowBuildThresholds(in); err == nil {
+			t.Fatalf("ParseSlowBuildThresholds(%q): expected an error", in)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package quayd
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// DefaultEventLogSize is the number of events kept by the server's EventLog.
+const DefaultEventLogSize = 500
+
+// Event is a record of a webhook received from Quay and how it was handled.
+type Event struct {
+	ID        string `json:"id"`
+	RequestID string `json:"request_id,omitempty"`
+
+	// ReplayOf is the id of the event that this event replayed, if any.
+	ReplayOf string `json:"replay_of,omitempty"`
+
+	// Status is the build status from the webhook url.
+	Status string `json:"status"`
+
+	// Form is the parsed payload.
+	Form WebhookForm `json:"form"`
+
+	// Payload is the raw payload, kept so the event can be replayed. It's
+	// empty if the payload wasn't valid JSON.
+	Payload json.RawMessage `json:"payload,omitempty"`
+
+	Outcome    string        `json:"outcome"`
+	Error      string        `json:"error,omitempty"`
+	ReceivedAt time.Time     `json:"received_at"`
+	Duration   time.Duration `json:"duration_ns"`
+}
+
+// EventLog keeps the most recent events in memory.
+type EventLog struct {
+	mu     sync.Mutex
+	size   int
+	events []*Event
+}
+
+// NewEventLog returns an EventLog that keeps the last size events.
+func NewEventLog(size int) *EventLog {
+	return &EventLog{size: size}
+}
+
+// Add records an event, evicting the oldest event if the log is full.
+func (l *EventLog) Add(ev *Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events = append(l.events, ev)
+	if len(l.events) > l.size {
+		l.events = append([]*Event(nil), l.events[len(l.events)-l.size:]...)
+	}
+}
+
+// List returns up to limit events, newest first. A limit of 0 returns every
+// event.
+func (l *EventLog) List(limit int) []*Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit <= 0 || limit > len(l.events) {
+		limit = len(l.events)
+	}
+	events := make([]*Event, 0, limit)
+	for i := len(l.events) - 1; i >= 0 && len(events) < limit; i-- {
+		events = append(events, l.events[i])
+	}
+	return events
+}
+
+// Get returns the event with the given id, or nil.
+func (l *EventLog) Get(id string) *Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, ev := range l.events {
+		if ev.ID == id {
+			return ev
+		}
+	}
+	return nil
+}
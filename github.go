@@ -0,0 +1,177 @@
+package quayd
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ejholmes/go-github/github"
+)
+
+// githubDo sends an API request to GitHub, bound to ctx so that it can be
+// cancelled and traced. The vendored go-github predates context support, so
+// requests are built with NewRequest and sent with Do rather than through the
+// service methods.
+func githubDo(ctx context.Context, c *github.Client, method, path string, body, v interface{}) (*github.Response, error) {
+	return githubDoAccept(ctx, c, method, path, "", body, v)
+}
+
+// githubDoAccept is githubDo with an Accept header, for API previews.
+func githubDoAccept(ctx context.Context, c *github.Client, method, path, accept string, body, v interface{}) (*github.Response, error) {
+	req, err := c.NewRequest(method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	return c.Do(req.WithContext(ctx), v)
+}
+
+// GitHubHost is a GitHub Enterprise Server that serves some repositories,
+// while the rest are served by the default GitHub host.
+type GitHubHost struct {
+	// BaseURL is the host's API url, e.g.
+	// https://github.example.com/api/v3/.
+	BaseURL *url.URL
+
+	// UploadURL is the host's uploads url. Defaults to the /api/uploads/
+	// sibling of BaseURL.
+	UploadURL *url.URL
+
+	// Repos are the owners ("acme") and repositories ("acme/api") served by
+	// the host.
+	Repos []string
+
+	// Token is the API token for the host.
+	Token string
+
+	// App, if set, authenticates to the host as a GitHub App installation
+	// instead of with Token.
+	App *GitHubApp
+}
+
+// NewGitHubClient returns a github.Client that sends requests to baseURL and
+// uploadURL through c. A nil baseURL means github.com, and a nil uploadURL is
+// derived from baseURL.
+func NewGitHubClient(c *http.Client, baseURL, uploadURL *url.URL) *github.Client {
+	g := github.NewClient(c)
+	if baseURL == nil {
+		return g
+	}
+
+	g.BaseURL = withTrailingSlash(baseURL)
+	if uploadURL == nil {
+		u := *g.BaseURL
+		u.Path = strings.Replace(u.Path, "/api/v3/", "/api/uploads/", 1)
+		uploadURL = &u
+	}
+	g.UploadURL = withTrailingSlash(uploadURL)
+	return g
+}
+
+// withTrailingSlash returns a copy of u whose path ends in a slash, as
+// go-github requires.
+func withTrailingSlash(u *url.URL) *url.URL {
+	c := *u
+	if !strings.HasSuffix(c.Path, "/") {
+		c.Path += "/"
+	}
+	return &c
+}
+
+// GitHubRoute is the StatusesRepository, CommitResolver,
+// DeploymentsRepository and PullRequestsRepository for a GitHub host.
+type GitHubRoute struct {
+	// Repos are the owners ("acme") and repositories ("acme/api") that the
+	// route serves.
+	Repos []string
+
+	StatusesRepository
+	CommitResolver
+	DeploymentsRepository
+	PullRequestsRepository
+}
+
+// matches returns true if the route serves repo.
+func (r *GitHubRoute) matches(repo string) bool {
+	for _, pattern := range r.Repos {
+		if matchRepo(pattern, repo) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRepo returns true if pattern, an owner ("acme"), repository
+// ("acme/api") or "*", matches repo.
+func matchRepo(pattern, repo string) bool {
+	owner := repo
+	if i := strings.Index(repo, "/"); i >= 0 {
+		owner = repo[:i]
+	}
+	return pattern == "*" || strings.EqualFold(pattern, repo) || strings.EqualFold(pattern, owner)
+}
+
+// GitHubRouter is a StatusesRepository, CommitResolver, DeploymentsRepository
+// and PullRequestsRepository that sends each call
+// to the GitHub host serving the repository, so that one quayd can serve
+// repositories on github.com and on GitHub Enterprise Server.
+type GitHubRouter struct {
+	// Routes are tried in order.
+	Routes []*GitHubRoute
+
+	// Default serves repositories that don't match any route.
+	Default *GitHubRoute
+}
+
+func (r *GitHubRouter) route(repo string) *GitHubRoute {
+	for _, route := range r.Routes {
+		if route.matches(repo) {
+			return route
+		}
+	}
+	return r.Default
+}
+
+// Create implements StatusesRepository Create.
+func (r *GitHubRouter) Create(ctx context.Context, status *Status) error {
+	return r.route(status.Repo).Create(ctx, status)
+}
+
+// Resolve implements CommitResolver Resolve.
+func (r *GitHubRouter) Resolve(ctx context.Context, repo, short string) (string, error) {
+	return r.route(repo).Resolve(ctx, repo, short)
+}
+
+// CreateDeployment implements DeploymentsRepository CreateDeployment.
+func (r *GitHubRouter) CreateDeployment(ctx context.Context, repo string, d *Deployment) (int64, error) {
+	return r.route(repo).CreateDeployment(ctx, repo, d)
+}
+
+// CreateDeploymentStatus implements DeploymentsRepository
+// CreateDeploymentStatus.
+func (r *GitHubRouter) CreateDeploymentStatus(ctx context.Context, repo string, id int64, s *DeploymentStatus) error {
+	return r.route(repo).CreateDeploymentStatus(ctx, repo, id, s)
+}
+
+// OpenPullRequests implements PullRequestsRepository OpenPullRequests.
+func (r *GitHubRouter) OpenPullRequests(ctx context.Context, repo, sha string) ([]int, error) {
+	return r.route(repo).OpenPullRequests(ctx, repo, sha)
+}
+
+// Comments implements PullRequestsRepository Comments.
+func (r *GitHubRouter) Comments(ctx context.Context, repo string, number int) ([]*Comment, error) {
+	return r.route(repo).Comments(ctx, repo, number)
+}
+
+// CreateComment implements PullRequestsRepository CreateComment.
+func (r *GitHubRouter) CreateComment(ctx context.Context, repo string, number int, body string) error {
+	return r.route(repo).CreateComment(ctx, repo, number, body)
+}
+
+// EditComment implements PullRequestsRepository EditComment.
+func (r *GitHubRouter) EditComment(ctx context.Context, repo string, id int64, body string) error {
+	return r.route(repo).EditComment(ctx, repo, id, body)
+}
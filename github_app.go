@@ -0,0 +1,284 @@
+package quayd
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultGitHubAPIURL is the base url of the GitHub API.
+const DefaultGitHubAPIURL = "https://api.github.com/"
+
+// installationTokenSlack is how long before it expires that an installation
+// token is refreshed.
+const installationTokenSlack = time.Minute
+
+// GitHubApp authenticates requests to GitHub as an installation of a GitHub
+// App, instead of as a user. The installation is looked up for each
+// repository, and installation tokens are cached until shortly before they
+// expire.
+type GitHubApp struct {
+	// ID is the GitHub App's id.
+	ID int64
+
+	// PrivateKey is the App's private key, used to sign JWTs.
+	PrivateKey *rsa.PrivateKey
+
+	// BaseURL is the GitHub API url. Defaults to DefaultGitHubAPIURL.
+	BaseURL string
+
+	// Client is used for the App's own requests. Defaults to
+	// DefaultHTTPClient.
+	Client *http.Client
+
+	mu            sync.Mutex
+	installations map[string]int64
+	tokens        map[int64]*installationToken
+
+	// now returns the current time. It's replaced in tests.
+	now func() time.Time
+}
+
+type installationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ParsePrivateKey parses a PEM encoded RSA private key, as downloaded from a
+// GitHub App's settings page.
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("github app: private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("github app: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("github app: private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// JWT returns a JSON Web Token, signed with the App's private key, that
+// authenticates as the App itself.
+func (a *GitHubApp) JWT() (string, error) {
+	now := a.clock()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		// Allow for clock drift between us and GitHub.
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(a.ID, 10),
+	})
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.PrivateKey, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// Token returns an installation token for the installation of the App on
+// repo, minting a new one if there's no cached token or it's about to expire.
+func (a *GitHubApp) Token(ctx context.Context, repo string) (string, error) {
+	id, err := a.installationID(ctx, repo)
+	if err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	t, ok := a.tokens[id]
+	a.mu.Unlock()
+	if ok && a.clock().Add(installationTokenSlack).Before(t.ExpiresAt) {
+		return t.Token, nil
+	}
+
+	t = new(installationToken)
+	if err := a.do(ctx, "POST", fmt.Sprintf("app/installations/%d/access_tokens", id), t); err != nil {
+		// The App was uninstalled, or reinstalled with a new id, so the
+		// installation is looked up again next time.
+		if e, ok := err.(*githubAppError); ok && (e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusUnauthorized) {
+			a.mu.Lock()
+			delete(a.installations, repo)
+			delete(a.tokens, id)
+			a.mu.Unlock()
+		}
+		return "", err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.tokens == nil {
+		a.tokens = make(map[int64]*installationToken)
+	}
+	a.tokens[id] = t
+	return t.Token, nil
+}
+
+// installationID returns the id of the App's installation on repo.
+func (a *GitHubApp) installationID(ctx context.Context, repo string) (int64, error) {
+	a.mu.Lock()
+	id, ok := a.installations[repo]
+	a.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	if err := a.do(ctx, "GET", "repos/"+repo+"/installation", &installation); err != nil {
+		return 0, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.installations == nil {
+		a.installations = make(map[string]int64)
+	}
+	a.installations[repo] = installation.ID
+	return installation.ID, nil
+}
+
+// Check implements Checker Check by verifying that GitHub accepts the App's
+// JWT.
+func (a *GitHubApp) Check(ctx context.Context) error {
+	return a.do(ctx, "GET", "app", nil)
+}
+
+// do makes a request authenticated as the App, decoding the response into v.
+func (a *GitHubApp) do(ctx context.Context, method, path string, v interface{}) error {
+	jwt, err := a.JWT()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, a.baseURL()+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.machine-man-preview+json")
+
+	resp, err := httpClient(a.Client).Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		return &githubAppError{
+			StatusCode: resp.StatusCode,
+			msg:        fmt.Sprintf("github app: %s %s: %s %s", method, path, resp.Status, strings.TrimSpace(buf.String())),
+		}
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// githubAppError is returned when GitHub responds to one of the App's own
+// requests with an error.
+type githubAppError struct {
+	StatusCode int
+	msg        string
+}
+
+func (e *githubAppError) Error() string {
+	return e.msg
+}
+
+func (a *GitHubApp) baseURL() string {
+	if a.BaseURL == "" {
+		return DefaultGitHubAPIURL
+	}
+	return strings.TrimSuffix(a.BaseURL, "/") + "/"
+}
+
+func (a *GitHubApp) clock() time.Time {
+	if a.now == nil {
+		return time.Now()
+	}
+	return a.now()
+}
+
+// Transport returns an http.RoundTripper that authenticates requests for a
+// repository, i.e. paths beginning with /repos/{owner}/{repo}, with an
+// installation token for that repository.
+func (a *GitHubApp) Transport(base http.RoundTripper) http.RoundTripper {
+	return &githubAppTransport{app: a, base: base}
+}
+
+type githubAppTransport struct {
+	app  *GitHubApp
+	base http.RoundTripper
+}
+
+func (t *githubAppTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	repo := repoFromPath(req.URL.Path)
+	if repo == "" {
+		return nil, fmt.Errorf("github app: can't authenticate %s, it's not a repository url", req.URL.Path)
+	}
+
+	token, err := t.app.Token(req.Context(), repo)
+	if err != nil {
+		return nil, err
+	}
+
+	// RoundTrippers must not modify the original request.
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("Authorization", "token "+token)
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(r)
+}
+
+// repoFromPath returns the owner/repo from an API path such as
+// /api/v3/repos/owner/repo/statuses/sha.
+func repoFromPath(path string) string {
+	i := strings.Index(path, "/repos/")
+	if i < 0 {
+		return ""
+	}
+	parts := strings.SplitN(path[i+len("/repos/"):], "/", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return ""
+	}
+	return parts[0] + "/" + parts[1]
+}
@@ -0,0 +1,217 @@
+package quayd
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ejholmes/go-github/github"
+)
+
+// fakeGitHubApp is an httptest stand-in for the parts of the GitHub API used
+// by GitHub App authentication.
+type fakeGitHubApp struct {
+	*httptest.Server
+	key *rsa.PublicKey
+
+	mu       sync.Mutex
+	minted   int
+	lookups  int
+	statuses []string
+
+	// installation is the id of the App's installation on
+	// remind101/r101-api.
+	installation int
+}
+
+func newFakeGitHubApp(t *testing.T, key *rsa.PublicKey) *fakeGitHubApp {
+	f := &fakeGitHubApp{key: key, installation: 42}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		auth := r.Header.Get("Authorization")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/repos/remind101/r101-api/installation":
+			f.verifyJWT(t, auth)
+			f.lookups++
+			fmt.Fprintf(w, `{"id": %d}`, f.installation)
+		case r.Method == "POST" && r.URL.Path == fmt.Sprintf("/app/installations/%d/access_tokens", f.installation):
+			f.verifyJWT(t, auth)
+			f.minted++
+			fmt.Fprintf(w, `{"token": "v1.%d", "expires_at": %q}`, f.minted, time.Now().Add(time.Hour).Format(time.RFC3339))
+		case r.Method == "POST" && strings.HasPrefix(r.URL.Path, "/repos/remind101/r101-api/statuses/"):
+			f.statuses = append(f.statuses, auth)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return f
+}
+
+func (f *fakeGitHubApp) verifyJWT(t *testing.T, auth string) {
+	parts := strings.Split(strings.TrimPrefix(auth, "Bearer "), ".")
+	if len(parts) != 3 {
+		t.Fatalf("Authorization => %s; want a Bearer JWT", auth)
+	}
+
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(f.key, crypto.SHA256, sum[:], sig); err != nil {
+		t.Fatalf("JWT signature: %v", err)
+	}
+
+	var claims struct {
+		Iss string `json:"iss"`
+	}
+	b, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	json.Unmarshal(b, &claims)
+	if got, want := claims.Iss, "1234"; got != want {
+		t.Fatalf("iss => %s; want %s", got, want)
+	}
+}
+
+func TestGitHubApp(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := newFakeGitHubApp(t, &key.PublicKey)
+	defer f.Close()
+
+	now := time.Now()
+	app := &GitHubApp{ID: 1234, PrivateKey: key, BaseURL: f.URL, now: func() time.Time { return now }}
+
+	g := github.NewClient(&http.Client{Transport: app.Transport(nil)})
+	g.BaseURL, _ = url.Parse(f.URL + "/")
+	r := &GitHubStatusesRepository{Client: g}
+
+	for i := 0; i < 2; i++ {
+		if err := r.Create(context.Background(), &Status{Repo: "remind101/r101-api", Ref: "abcd", State: "success"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Once the cached token is about to expire, a new one is minted.
+	now = now.Add(time.Hour)
+	if err := r.Create(context.Background(), &Status{Repo: "remind101/r101-api", Ref: "abcd", State: "success"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := f.minted, 2; got != want {
+		t.Fatalf("Minted %d tokens; want %d", got, want)
+	}
+	if got, want := strings.Join(f.statuses, ","), "token v1.1,token v1.1,token v1.2"; got != want {
+		t.Fatalf("Authorization => %s; want %s", got, want)
+	}
+}
+
+func TestGitHubApp_NotInstalled(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := newFakeGitHubApp(t, &key.PublicKey)
+	defer f.Close()
+
+	app := &GitHubApp{ID: 1234, PrivateKey: key, BaseURL: f.URL}
+	if _, err := app.Token(context.Background(), "remind101/other"); err == nil {
+		t.Fatal("Expected an error for a repository without an installation")
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	tests := []struct {
+		in []byte
+		ok bool
+	}{
+		{pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), true},
+		{pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), true},
+		{[]byte("not a key"), false},
+	}
+
+	for _, tt := range tests {
+		if _, err := ParsePrivateKey(tt.in); (err == nil) != tt.ok {
+			t.Fatalf("ParsePrivateKey(%q) => %v; want ok %v", tt.in[:10], err, tt.ok)
+		}
+	}
+}
+
+func TestRepoFromPath(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"/repos/remind101/r101-api/statuses/abcd", "remind101/r101-api"},
+		{"/api/v3/repos/remind101/r101-api/commits/abcd", "remind101/r101-api"},
+		{"/repos/remind101", ""},
+		{"/user", ""},
+	}
+
+	for _, tt := range tests {
+		if got, want := repoFromPath(tt.in), tt.out; got != want {
+			t.Fatalf("repoFromPath(%q) => %s; want %s", tt.in, got, want)
+		}
+	}
+}
+
+func TestGitHubApp_Reinstalled(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := newFakeGitHubApp(t, &key.PublicKey)
+	defer f.Close()
+
+	now := time.Now()
+	app := &GitHubApp{ID: 1234, PrivateKey: key, BaseURL: f.URL, now: func() time.Time { return now }}
+	if _, err := app.Token(context.Background(), "remind101/r101-api"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The App is reinstalled, so the cached installation 404s once the
+	// token expires, and is then looked up again.
+	f.mu.Lock()
+	f.installation = 43
+	f.mu.Unlock()
+	now = now.Add(time.Hour)
+
+	if _, err := app.Token(context.Background(), "remind101/r101-api"); err == nil {
+		t.Fatal("Expected an error for the old installation")
+	}
+	token, err := app.Token(context.Background(), "remind101/r101-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := token, "v1.2"; got != want {
+		t.Fatalf("Token => %s; want %s", got, want)
+	}
+	if got, want := f.lookups, 2; got != want {
+		t.Fatalf("Installation lookups => %d; want %d", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+package quayd
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewGitHubClient(t *testing.T) {
+	base, _ := url.Parse("https://github.example.com/api/v3")
+	g := NewGitHubClient(nil, base, nil)
+
+	if got, want := g.BaseURL.String(), "https://github.example.com/api/v3/"; got != want {
+		t.Fatalf("BaseURL => %s; want %s", got, want)
+	}
+	if got, want := g.UploadURL.String(), "https://github.example.com/api/uploads/"; got != want {
+		t.Fatalf("UploadURL => %s; want %s", got, want)
+	}
+
+	if got, want := NewGitHubClient(nil, nil, nil).BaseURL.String(), DefaultGitHubAPIURL; got != want {
+		t.Fatalf("BaseURL => %s; want %s", got, want)
+	}
+}
+
+func TestGitHubRoute_Matches(t *testing.T) {
+	r := &GitHubRoute{Repos: []string{"acme", "remind101/ghe-api"}}
+
+	tests := []struct {
+		repo string
+		ok   bool
+	}{
+		{"acme/api", true},
+		{"Acme/web", true},
+		{"remind101/ghe-api", true},
+		{"remind101/r101-api", false},
+	}
+
+	for _, tt := range tests {
+		if got, want := r.matches(tt.repo), tt.ok; got != want {
+			t.Fatalf("matches(%q) => %v; want %v", tt.repo, got, want)
+		}
+	}
+}
+
+// githubStandIn records the commit statuses created through it, and the token
+// each was created with.
+type githubStandIn struct {
+	sync.Mutex
+	created []string
+}
+
+func (s *githubStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.created = append(s.created, r.URL.Path+" "+r.Header.Get("Authorization"))
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(`{}`))
+}
+
+func TestNewWithOptions_GitHubEnterprise(t *testing.T) {
+	dotcom, ghe := new(githubStandIn), new(githubStandIn)
+
+	// The GHE host uses a certificate signed by an "internal" CA.
+	gheServer := httptest.NewTLSServer(http.StripPrefix("/api/v3", ghe))
+	defer gheServer.Close()
+	dotcomServer := httptest.NewServer(dotcom)
+	defer dotcomServer.Close()
+
+	ca, err := ioutil.TempFile("", "quayd-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(ca.Name())
+	pem.Encode(ca, &pem.Block{Type: "CERTIFICATE", Bytes: gheServer.Certificate().Raw})
+	ca.Close()
+
+	roots, err := LoadRootCAs(ca.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dotcomURL, _ := url.Parse(dotcomServer.URL)
+	gheURL, _ := url.Parse(gheServer.URL + "/api/v3/")
+	q := NewWithOptions(Options{
+		GitHubToken:   "dotcom-token",
+		GitHubBaseURL: dotcomURL,
+		GitHubHosts: []GitHubHost{
+			{BaseURL: gheURL, Repos: []string{"acme"}, Token: "ghe-token"},
+		},
+		HTTPClient: NewHTTPClientWithRootCAs(5*time.Second, roots),
+	})
+
+	for _, repo := range []string{"remind101/r101-api", "acme/api"} {
+		if err := q.StatusesRepository.Create(context.Background(), &Status{Repo: repo, Ref: "abcd", State: "success"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := len(dotcom.created), 1; got != want {
+		t.Fatalf("github.com statuses => %d; want %d", got, want)
+	}
+	if got, want := dotcom.created[0], "/repos/remind101/r101-api/statuses/abcd Bearer dotcom-token"; got != want {
+		t.Fatalf("github.com status => %s; want %s", got, want)
+	}
+	if got, want := len(ghe.created), 1; got != want {
+		t.Fatalf("GHE statuses => %d; want %d", got, want)
+	}
+	if got, want := ghe.created[0], "/repos/acme/api/statuses/abcd Bearer ghe-token"; got != want {
+		t.Fatalf("GHE status => %s; want %s", got, want)
+	}
+
+	if _, ok := q.Checkers["github:"+gheURL.Host]; !ok {
+		t.Fatal("Expected a readiness check for the GHE host")
+	}
+}
+
+func TestLoadRootCAs_NotPEM(t *testing.T) {
+	f, err := ioutil.TempFile("", "quayd-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("not a certificate")
+	f.Close()
+
+	if _, err := LoadRootCAs(f.Name()); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
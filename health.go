@@ -0,0 +1,286 @@
+package quayd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCheckTTL is how long the result of a dependency check is reused
+// before the dependency is checked again.
+const DefaultCheckTTL = 30 * time.Second
+
+// Checker checks that a dependency is reachable and that quayd's credentials
+// for it are valid.
+type Checker interface {
+	Check(context.Context) error
+}
+
+// CheckerFunc is a function that implements the Checker interface.
+type CheckerFunc func(context.Context) error
+
+// Check implements Checker Check.
+func (fn CheckerFunc) Check(ctx context.Context) error {
+	return fn(ctx)
+}
+
+// CheckResult is the outcome of a single dependency check.
+type CheckResult struct {
+	OK        bool      `json:"ok"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMS float64   `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Health runs a set of named dependency checks, caching each result for TTL
+// so that frequent probes don't hammer the APIs being checked. Concurrent
+// callers share a single in-flight run of each check.
+type Health struct {
+	// Checkers are the dependencies to check, by name.
+	Checkers map[string]Checker
+
+	// TTL is how long results are cached. Defaults to DefaultCheckTTL.
+	TTL time.Duration
+
+	// Timeout bounds each check. Defaults to DefaultTimeout.
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	cache    map[string]CheckResult
+	inflight map[string]*inflightCheck
+}
+
+// inflightCheck is a check that's running, shared by every caller waiting
+// for its result.
+type inflightCheck struct {
+	done   chan struct{}
+	result CheckResult
+}
+
+// Check runs every check that doesn't have a fresh cached result, and returns
+// all results along with whether every check passed.
+func (h *Health) Check(ctx context.Context) (map[string]CheckResult, bool) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]CheckResult, len(h.Checkers))
+	)
+
+	for name, c := range h.Checkers {
+		if r, ok := h.cached(name); ok {
+			results[name] = r
+			continue
+		}
+
+		wg.Add(1)
+		go func(name string, c Checker) {
+			defer wg.Done()
+			r := h.wait(ctx, name, c)
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = r
+		}(name, c)
+	}
+	wg.Wait()
+
+	ok := true
+	for _, r := range results {
+		ok = ok && r.OK
+	}
+	return results, ok
+}
+
+// wait returns the result of the check, starting it unless it's already
+// running. The check isn't bound to ctx, since other callers may be waiting
+// for it, but wait returns early if ctx is done.
+func (h *Health) wait(ctx context.Context, name string, c Checker) CheckResult {
+	h.mu.Lock()
+	// A run may have finished since Check looked at the cache, so look
+	// again under the same lock that registers a new run.
+	if r, ok := h.cachedLocked(name); ok {
+		h.mu.Unlock()
+		return r
+	}
+	call, ok := h.inflight[name]
+	if !ok {
+		call = &inflightCheck{done: make(chan struct{})}
+		if h.inflight == nil {
+			h.inflight = make(map[string]*inflightCheck)
+		}
+		h.inflight[name] = call
+		go h.start(name, c, call)
+	}
+	h.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.result
+	case <-ctx.Done():
+		return CheckResult{Error: ctx.Err().Error(), CheckedAt: time.Now().UTC()}
+	}
+}
+
+// start runs a shared check and caches its result.
+func (h *Health) start(name string, c Checker, call *inflightCheck) {
+	var err error
+	call.result, err = h.run(context.Background(), c)
+
+	// A cancelled or timed out check says nothing about the dependency, so
+	// it isn't cached.
+	h.mu.Lock()
+	delete(h.inflight, name)
+	if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		if h.cache == nil {
+			h.cache = make(map[string]CheckResult)
+		}
+		h.cache[name] = call.result
+	}
+	h.mu.Unlock()
+	close(call.done)
+}
+
+func (h *Health) run(ctx context.Context, c Checker) (CheckResult, error) {
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.Check(ctx)
+	r := CheckResult{
+		OK:        err == nil,
+		LatencyMS: time.Since(start).Seconds() * 1000,
+		CheckedAt: start.UTC(),
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r, err
+}
+
+func (h *Health) cached(name string) (CheckResult, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.cachedLocked(name)
+}
+
+// cachedLocked is cached, with h.mu held.
+func (h *Health) cachedLocked(name string) (CheckResult, bool) {
+	ttl := h.TTL
+	if ttl == 0 {
+		ttl = DefaultCheckTTL
+	}
+	r, ok := h.cache[name]
+	if !ok || time.Since(r.CheckedAt) > ttl {
+		return CheckResult{}, false
+	}
+	return r, true
+}
+
+// Liveness is an http.Handler that reports the process as alive.
+type Liveness struct{}
+
+func (Liveness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}` + "\n"))
+}
+
+// Readiness is an http.Handler that reports whether quayd's dependencies are
+// usable, along with the amount of work it currently has in flight.
+type Readiness struct {
+	*Health
+
+	// Backlog returns the current backlog, by name, to include in the
+	// response.
+	Backlog func() map[string]int
+}
+
+type readinessResponse struct {
+	Status  string                 `json:"status"`
+	Checks  map[string]CheckResult `json:"checks"`
+	Backlog map[string]int         `json:"backlog,omitempty"`
+}
+
+func (rd *Readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	results, ok := rd.Check(r.Context())
+
+	resp := readinessResponse{Status: "ok", Checks: results}
+	if rd.Backlog != nil {
+		resp.Backlog = rd.Backlog()
+	}
+
+	code := http.StatusOK
+	if !ok {
+		resp.Status = "unavailable"
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Check implements Checker Check by verifying that the GitHub token is valid
+// and is allowed to create commit statuses. The check is skipped while the
+// rate limit budget is low.
+func (r *GitHubStatusesRepository) Check(ctx context.Context) error {
+	if r.Budget.Low() {
+		return nil
+	}
+	resp, err := githubDo(ctx, r.Client, "GET", "user", nil, nil)
+	r.Budget.Update(resp)
+	if err != nil {
+		return err
+	}
+	return checkScopes(resp.Header.Get("X-OAuth-Scopes"))
+}
+
+// checkScopes returns an error unless the X-OAuth-Scopes header grants repo
+// or repo:status.
+func checkScopes(header string) error {
+	var scopes []string
+	for _, s := range strings.Split(header, ",") {
+		s = strings.TrimSpace(s)
+		if s == "repo" || s == "repo:status" {
+			return nil
+		}
+		if s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	sort.Strings(scopes)
+	return fmt.Errorf("token is missing the repo:status scope (has %q)", strings.Join(scopes, ","))
+}
+
+// Check implements Checker Check by verifying that the registry accepts the
+// tagger's credentials.
+func (dt *DockerRegistryTagger) Check(ctx context.Context) error {
+	req, err := http.NewRequest("GET", "https://"+dt.registry+"/v1/users/", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(dt.credentials.Registry())
+
+	resp, err := httpClient(dt.client).Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return errors.New("registry rejected credentials: " + resp.Status)
+	case resp.StatusCode >= 300:
+		return errors.New("Unsuccessful Request: " + resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package quayd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ejholmes/go-github/github"
+)
+
+func TestHealth_Caches(t *testing.T) {
+	var calls int
+	h := &Health{Checkers: map[string]Checker{
+		"github": CheckerFunc(func(ctx context.Context) error {
+			calls++
+			return nil
+		}),
+	}}
+
+	for i := 0; i < 3; i++ {
+		if _, ok := h.Check(context.Background()); !ok {
+			t.Fatal("Expected checks to pass")
+		}
+	}
+
+	if got, want := calls, 1; got != want {
+		t.Fatalf("Calls => %d; want %d", got, want)
+	}
+}
+
+func TestHealth_SharesInFlightChecks(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	release := make(chan struct{})
+	h := &Health{Checkers: map[string]Checker{
+		"github": CheckerFunc(func(ctx context.Context) error {
+			mu.Lock()
+			calls++
+			mu.Unlock()
+			<-release
+			return nil
+		}),
+	}}
+
+	// A caller that gives up doesn't cancel the check for everyone else.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if results, ok := h.Check(ctx); ok || results["github"].Error != context.Canceled.Error() {
+		t.Fatalf("Check => %+v, %v; want a cancelled result", results, ok)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := h.Check(context.Background()); !ok {
+				t.Error("Expected checks to pass")
+			}
+		}()
+	}
+	close(release)
+	wg.Wait()
+
+	if _, ok := h.Check(context.Background()); !ok {
+		t.Fatal("Expected checks to pass")
+	}
+	if got, want := calls, 1; got != want {
+		t.Fatalf("Calls => %d; want %d", got, want)
+	}
+}
+
+func TestHealth_DoesNotCacheCancelledChecks(t *testing.T) {
+	var calls int
+	h := &Health{Checkers: map[string]Checker{
+		"github": CheckerFunc(func(ctx context.Context) error {
+			calls++
+			switch calls {
+			case 1:
+				return fmt.Errorf("get: %w", context.Canceled)
+			case 2:
+				return context.DeadlineExceeded
+			}
+			return nil
+		}),
+	}}
+
+	if _, ok := h.Check(context.Background()); ok {
+		t.Fatal("Expected the cancelled check to fail")
+	}
+	if _, ok := h.Check(context.Background()); ok {
+		t.Fatal("Expected the timed out check to fail")
+	}
+	if _, ok := h.Check(context.Background()); !ok {
+		t.Fatal("Expected the check to run again and pass")
+	}
+	if got, want := calls, 3; got != want {
+		t.Fatalf("Calls => %d; want %d", got, want)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	rd := &Readiness{
+		Health: &Health{Checkers: map[string]Checker{
+			"github":   CheckerFunc(func(ctx context.Context) error { return nil }),
+			"registry": CheckerFunc(func(ctx context.Context) error { return errors.New("401 Unauthorized") }),
+		}},
+		Backlog: func() map[string]int { return map[string]int{"in_flight_webhooks": 2} },
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	rd.ServeHTTP(resp, req)
+
+	if got, want := resp.Code, http.StatusServiceUnavailable; got != want {
+		t.Fatalf("Status => %d; want %d", got, want)
+	}
+
+	var body readinessResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if !body.Checks["github"].OK || body.Checks["registry"].OK {
+		t.Fatalf("Checks => %+v", body.Checks)
+	}
+	if got, want := body.Checks["registry"].Error, "401 Unauthorized"; got != want {
+		t.Fatalf("Error => %s; want %s", got, want)
+	}
+	if got, want := body.Backlog["in_flight_webhooks"], 2; got != want {
+		t.Fatalf("Backlog => %d; want %d", got, want)
+	}
+}
+
+func TestCheckScopes(t *testing.T) {
+	tests := []struct {
+		in string
+		ok bool
+	}{
+		{"repo, user", true},
+		{"repo:status", true},
+		{"public_repo, user", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got, want := checkScopes(tt.in) == nil, tt.ok; got != want {
+			t.Fatalf("checkScopes(%q) => %v; want %v", tt.in, got, want)
+		}
+	}
+}
+
+func TestGitHubStatusesRepository_Check(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/user" {
+			t.Fatalf("Path => %s; want /user", r.URL.Path)
+		}
+		w.Header().Set("X-OAuth-Scopes", "repo:status")
+		w.Write([]byte(`{}`))
+	}))
+	defer s.Close()
+
+	g := github.NewClient(nil)
+	g.BaseURL, _ = url.Parse(s.URL + "/")
+
+	r := &GitHubStatusesRepository{Client: g}
+	if err := r.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDockerRegistryTagger_Check(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, _ := r.BasicAuth(); u != "user" || p != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer s.Close()
+
+	host := strings.TrimPrefix(s.URL, "https://")
+	tests := []struct {
+		password string
+		ok       bool
+	}{
+		{"pass", true},
+		{"wrong", false},
+	}
+
+	for _, tt := range tests {
+		creds, _ := NewCredentials("", "user:"+tt.password)
+		dt := &DockerRegistryTagger{registry: host, credentials: creds, client: s.Client()}
+		if got, want := dt.Check(context.Background()) == nil, tt.ok; got != want {
+			t.Fatalf("Check with %s => %v; want %v", tt.password, got, want)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package quayd
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuildQueryLimit is the most builds returned by a query without a
+// limit.
+const DefaultBuildQueryLimit = 100
+
+// DefaultBuildStoreSize is the most builds a FileBuildStore keeps.
+const DefaultBuildStoreSize = 10000
+
+// finishedStates are the states of a build that Quay has finished.
+var finishedStates = map[string]bool{
+	"success": true,
+	"failure": true,
+	"error":   true,
+}
+
+// BuildRecord is the history of a Quay build.
+type BuildRecord struct {
+	ID         string `json:"id"`
+	Repository string `json:"repository"`
+	Commit     string `json:"commit"`
+	Branch     string `json:"branch,omitempty"`
+	Image      string `json:"image"`
+	URL        string `json:"url"`
+
+	// State is the build's latest state.
+	State string `json:"state"`
+
+	// Transitions are the build's states, oldest first.
+	Transitions []Transition `json:"transitions"`
+
+	// Tags are the tags applied to the image, and Digest is its id. They're
+	// set once the build succeeds.
+	Tags   []string `json:"tags,omitempty"`
+	Digest string   `json:"digest,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Transition is a change to a build's state.
+type Transition struct {
+	State string    `json:"state"`
+	At    time.Time `json:"at"`
+}
+
+// BuildQuery selects builds. Empty fields match every build.
+type BuildQuery struct {
+	Repository string
+
+	// Commit matches builds whose commit starts with it, so that short
+	// shas can be used.
+	Commit string
+
+	State string
+
+	// Limit is the most builds to return. Defaults to
+	// DefaultBuildQueryLimit.
+	Limit int
+}
+
+func (q BuildQuery) matches(r *BuildRecord) bool {
+	return (q.Repository == "" || q.Repository == r.Repository) &&
+		(q.Commit == "" || strings.HasPrefix(r.Commit, q.Commit)) &&
+		(q.State == "" || q.State == r.State)
+}
+
+// BuildStore represents something that keeps the history of builds.
+type BuildStore interface {
+	// RecordBuild records a build event.
+	RecordBuild(ctx context.Context, b *Build) error
+
+	// Builds returns the builds matching the query, most recently updated
+	// first.
+	Builds(ctx context.Context, q BuildQuery) ([]*BuildRecord, error)
+}
+
+// FileBuildStore is a BuildStore kept in memory and persisted to a file of
+// newline delimited JSON records. Each event appends the build's updated
+// record, and the file is compacted to the latest record of each build when
+// it's opened, and whenever it has grown to twice Size records.
+type FileBuildStore struct {
+	// Path is the file. The store isn't persisted if it's empty.
+	Path string
+
+	// Size is the most builds kept, dropping the least recently updated.
+	// Defaults to DefaultBuildStoreSize.
+	Size int
+
+	mu sync.Mutex
+	f  *os.File
+
+	// ll holds the records, least recently updated first.
+	ll      *list.List
+	records map[string]*list.Element
+
+	// lines is the number of records in the file.
+	lines int
+
+	// now returns the current time. It's replaced in tests.
+	now func() time.Time
+}
+
+// NewMemoryBuildStore returns a FileBuildStore that isn't persisted.
+func NewMemoryBuildStore() *FileBuildStore {
+	return &FileBuildStore{ll: list.New(), records: make(map[string]*list.Element)}
+}
+
+// OpenFileBuildStore opens the store at path, creating it if it doesn't
+// exist, and keeping at most size builds. A size of 0 means
+// DefaultBuildStoreSize.
+func OpenFileBuildStore(path string, size int) (*FileBuildStore, error) {
+	s := &FileBuildStore{Path: path, Size: size, ll: list.New(), records: make(map[string]*list.Element)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the records in the file, later records replacing earlier ones.
+func (s *FileBuildStore) load() error {
+	f, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	latest := make(map[string]*BuildRecord)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var r BuildRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return fmt.Errorf("%s:%d: %v", s.Path, line, err)
+		}
+		latest[r.ID] = &r
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// The file is only in order until a build is updated, so the records
+	// are sorted once here, and kept in order from then on.
+	records := make([]*BuildRecord, 0, len(latest))
+	for _, r := range latest {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].UpdatedAt.Equal(records[j].UpdatedAt) {
+			return records[i].ID < records[j].ID
+		}
+		return records[i].UpdatedAt.Before(records[j].UpdatedAt)
+	})
+	for _, r := range records {
+		s.put(r)
+	}
+	return nil
+}
+
+// compact rewrites the file with only the latest record of each build, and
+// reopens it for appending. s.mu must be held, or s not yet shared.
+func (s *FileBuildStore) compact() error {
+	tmp, err := os.Create(filepath.Join(filepath.Dir(s.Path), "."+filepath.Base(s.Path)+".tmp"))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for e := s.ll.Front(); e != nil; e = e.Next() {
+		raw, _ := json.Marshal(e.Value.(*BuildRecord))
+		w.Write(append(raw, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.Path); err != nil {
+		return err
+	}
+
+	if s.f != nil {
+		s.f.Close()
+		s.f = nil
+	}
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	s.f = f
+	s.lines = s.ll.Len()
+	return nil
+}
+
+// put makes r the most recently updated record, dropping the least recently
+// updated records beyond Size. s.mu must be held, or s not yet shared.
+func (s *FileBuildStore) put(r *BuildRecord) {
+	if e, ok := s.records[r.ID]; ok {
+		e.Value = r
+		s.ll.MoveToBack(e)
+	} else {
+		s.records[r.ID] = s.ll.PushBack(r)
+	}
+
+	for s.ll.Len() > s.size() {
+		e := s.ll.Front()
+		s.ll.Remove(e)
+		delete(s.records, e.Value.(*BuildRecord).ID)
+	}
+}
+
+func (s *FileBuildStore) size() int {
+	if s.Size == 0 {
+		return DefaultBuildStoreSize
+	}
+	return s.Size
+}
+
+// RecordBuild implements BuildStore RecordBuild. A repeated event, such as a
+// replayed webhook, doesn't add a transition, and a pending event that
+// arrives after the build finished is ignored.
+func (s *FileBuildStore) RecordBuild(ctx context.Context, b *Build) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock()
+	r := &BuildRecord{ID: b.ID, CreatedAt: now}
+	if e, ok := s.records[b.ID]; ok {
+		r = e.Value.(*BuildRecord)
+	}
+	if b.Status == "pending" && finishedStates[r.State] {
+		return nil
+	}
+
+	// Work on a copy, so the record isn't changed if it can't be
+	// persisted.
+	updated := *r
+	updated.Repository, updated.Commit, updated.Image, updated.URL = b.Repository, b.Commit, b.Image, b.URL
+	if b.Branch != "" {
+		updated.Branch = b.Branch
+	}
+	if n := len(r.Transitions); n == 0 || r.Transitions[n-1].State != b.Status {
+		updated.Transitions = append(append([]Transition(nil), r.Transitions...), Transition{State: b.Status, At: now})
+	}
+	updated.State = b.Status
+	if b.ImageID != "" {
+		updated.Tags = []string{b.Commit, b.ImageID}
+		updated.Digest = b.ImageID
+	}
+	updated.UpdatedAt = now
+
+	if s.f != nil {
+		raw, err := json.Marshal(&updated)
+		if err != nil {
+			return err
+		}
+		if _, err := s.f.Write(append(raw, '\n')); err != nil {
+			return err
+		}
+		s.lines++
+	}
+	s.put(&updated)
+
+	if s.f != nil && s.lines >= 2*s.size() {
+		return s.compact()
+	}
+	return nil
+}
+
+// Builds implements BuildStore Builds.
+func (s *FileBuildStore) Builds(ctx context.Context, q BuildQuery) ([]*BuildRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultBuildQueryLimit
+	}
+
+	var builds []*BuildRecord
+	for e := s.ll.Back(); e != nil && len(builds) < limit; e = e.Prev() {
+		if r := e.Value.(*BuildRecord); q.matches(r) {
+			c := *r
+			builds = append(builds, &c)
+		}
+	}
+	return builds, nil
+}
+
+// Close closes the file.
+func (s *FileBuildStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+func (s *FileBuildStore) clock() time.Time {
+	if s.now == nil {
+		return time.Now().UTC()
+	}
+	return s.now()
+}
+
+// BuildHistory is a BuildHook that records every build event in a
+// BuildStore.
+type BuildHistory struct {
+	Store BuildStore
+}
+
+// BuildEvent implements BuildHook BuildEvent.
+func (h *BuildHistory) BuildEvent(ctx context.Context, b *Build) error {
+	return h.Store.RecordBuild(ctx, b)
+}
@@ -0,0 +1,183 @@
+package quayd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileBuildStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quayd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "builds.json")
+
+	s, err := OpenFileBuildStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+
+	ctx := context.Background()
+	events := []*Build{
+		{ID: "1", Status: "pending", Repository: "acme/api", Commit: "6607c19d3fd492ec53439f4104b39e4c62ece179", Branch: "master"},
+		{ID: "2", Status: "pending", Repository: "acme/web", Commit: "d2c3b4a5e6f708192a3b4c5d6e7f8091a2b3c4d5"},
+		{ID: "1", Status: "success", Repository: "acme/api", Commit: "6607c19d3fd492ec53439f4104b39e4c62ece179", ImageID: "1234"},
+		// Replayed webhooks don't add transitions.
+		{ID: "1", Status: "success", Repository: "acme/api", Commit: "6607c19d3fd492ec53439f4104b39e4c62ece179", ImageID: "1234"},
+		{ID: "2", Status: "failure", Repository: "acme/web", Commit: "d2c3b4a5e6f708192a3b4c5d6e7f8091a2b3c4d5"},
+	}
+	for _, b := range events {
+		if err := s.RecordBuild(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	// Reopening the store loads the records, and compacts the file.
+	s, err = OpenFileBuildStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	raw, _ := ioutil.ReadFile(path)
+	if got, want := strings.Count(string(raw), "\n"), 2; got != want {
+		t.Fatalf("Lines => %d; want %d", got, want)
+	}
+
+	builds, _ := s.Builds(ctx, BuildQuery{Commit: "6607c19"})
+	if got, want := len(builds), 1; got != want {
+		t.Fatalf("Builds => %d; want %d", got, want)
+	}
+	b := builds[0]
+	if got, want := b.State, "success"; got != want {
+		t.Fatalf("State => %s; want %s", got, want)
+	}
+	if got, want := len(b.Transitions), 2; got != want {
+		t.Fatalf("Transitions => %d; want %d", got, want)
+	}
+	if got, want := b.Transitions[0].At, time.Date(2017, 6, 1, 12, 1, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("Transitions[0].At => %v; want %v", got, want)
+	}
+	if got, want := b.Digest, "1234"; got != want {
+		t.Fatalf("Digest => %s; want %s", got, want)
+	}
+	if got, want := strings.Join(b.Tags, ","), "6607c19d3fd492ec53439f4104b39e4c62ece179,1234"; got != want {
+		t.Fatalf("Tags => %s; want %s", got, want)
+	}
+	if got, want := b.Branch, "master"; got != want {
+		t.Fatalf("Branch => %s; want %s", got, want)
+	}
+
+	tests := []struct {
+		query BuildQuery
+		ids   string
+	}{
+		{BuildQuery{}, "2,1"},
+		{BuildQuery{Repository: "acme/web"}, "2"},
+		{BuildQuery{State: "success"}, "1"},
+		{BuildQuery{Commit: "ffff"}, ""},
+		{BuildQuery{Limit: 1}, "2"},
+	}
+
+	for _, tt := range tests {
+		builds, _ := s.Builds(ctx, tt.query)
+		var ids []string
+		for _, b := range builds {
+			ids = append(ids, b.ID)
+		}
+		if got, want := strings.Join(ids, ","), tt.ids; got != want {
+			t.Fatalf("Builds(%+v) => %s; want %s", tt.query, got, want)
+		}
+	}
+}
+
+func TestFileBuildStore_Size(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quayd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "builds.json")
+
+	s, err := OpenFileBuildStore(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "1", "3"} {
+		if err := s.RecordBuild(ctx, &Build{ID: id, Status: "pending", Repository: "acme/api"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The least recently updated build is dropped, and the file is
+	// compacted once it has twice as many records as the store keeps.
+	builds, _ := s.Builds(ctx, BuildQuery{})
+	var ids []string
+	for _, b := range builds {
+		ids = append(ids, b.ID)
+	}
+	if got, want := strings.Join(ids, ","), "3,1"; got != want {
+		t.Fatalf("Builds => %s; want %s", got, want)
+	}
+	raw, _ := ioutil.ReadFile(path)
+	if got, want := strings.Count(string(raw), "\n"), 2; got != want {
+		t.Fatalf("Lines => %d; want %d", got, want)
+	}
+
+	if err := s.RecordBuild(ctx, &Build{ID: "4", Status: "pending", Repository: "acme/api"}); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ = ioutil.ReadFile(path)
+	if got, want := strings.Count(string(raw), "\n"), 3; got != want {
+		t.Fatalf("Lines => %d; want %d", got, want)
+	}
+}
+
+func TestFileBuildStore_LatePending(t *testing.T) {
+	s := NewMemoryBuildStore()
+	ctx := context.Background()
+
+	for _, status := range []string{"pending", "failure", "pending"} {
+		if err := s.RecordBuild(ctx, &Build{ID: "1", Status: status, Repository: "acme/api"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	builds, _ := s.Builds(ctx, BuildQuery{})
+	if got, want := builds[0].State, "failure"; got != want {
+		t.Fatalf("State => %s; want %s", got, want)
+	}
+	if got, want := len(builds[0].Transitions), 2; got != want {
+		t.Fatalf("Transitions => %d; want %d", got, want)
+	}
+}
+
+func TestOpenFileBuildStore_Corrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quayd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "builds.json")
+	ioutil.WriteFile(path, []byte("{\"id\":\"1\"}\nnot json\n"), 0644)
+
+	_, err = OpenFileBuildStore(path, 0)
+	if err == nil || !strings.Contains(err.Error(), "builds.json:2") {
+		t.Fatalf("err => %v; want the bad line", err)
+	}
+}
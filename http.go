@@ -0,0 +1,76 @@
+package quayd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultHTTPClient is the http.Client used for requests to GitHub and the
+// registry when no other client is configured.
+var DefaultHTTPClient = NewHTTPClient(30 * time.Second)
+
+// NewHTTPClient returns an http.Client with bounded dial, TLS handshake and
+// response header timeouts, limits on idle connections, and an overall request
+// timeout. Requests are traced with the DefaultTracer.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return NewHTTPClientWithRootCAs(timeout, nil)
+}
+
+// NewHTTPClientWithRootCAs returns an http.Client like NewHTTPClient that
+// trusts the certificate authorities in roots, e.g. for a GitHub Enterprise
+// Server with an internal CA. A nil roots uses the system's.
+func NewHTTPClientWithRootCAs(timeout time.Duration, roots *x509.CertPool) *http.Client {
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: timeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if roots != nil {
+		t.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+
+	return &http.Client{
+		Transport: &tracingTransport{t},
+		Timeout:   timeout,
+	}
+}
+
+// LoadRootCAs returns the system's certificate authorities, plus those in the
+// PEM encoded files.
+func LoadRootCAs(files ...string) (*x509.CertPool, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if !roots.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("%s: no PEM certificates found", f)
+		}
+	}
+	return roots, nil
+}
+
+// httpClient returns c, or DefaultHTTPClient if c is nil.
+func httpClient(c *http.Client) *http.Client {
+	if c == nil {
+		return DefaultHTTPClient
+	}
+	return c
+}
@@ -0,0 +1,215 @@
+package quayd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log line.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel parses a level name such as "info" into a Level.
+func ParseLevel(s string) (Level, error) {
+	for l, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return l, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level: %q", s)
+}
+
+// Log formats supported by NewLogger.
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+// Redacted is written in place of secret values.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are field names whose values are never written out.
+var sensitiveKeys = []string{"token", "password", "secret", "auth", "authorization"}
+
+// DefaultLogger is the Logger used when a Quayd has no Logger.
+var DefaultLogger = NewLogger(os.Stdout, FormatLogfmt, LevelInfo)
+
+// Logger writes structured log lines as logfmt or JSON. Loggers derived with
+// With share their output, level and redacted secrets with their parent.
+type Logger struct {
+	out    *logOutput
+	fields []interface{}
+}
+
+// logOutput is the state shared between a Logger and its children.
+type logOutput struct {
+	sync.Mutex
+	w       io.Writer
+	format  string
+	level   Level
+	secrets []string
+}
+
+// NewLogger returns a Logger that writes lines of the given format to w,
+// dropping anything below level.
+func NewLogger(w io.Writer, format string, level Level) *Logger {
+	return &Logger{out: &logOutput{w: w, format: format, level: level}}
+}
+
+// With returns a child Logger that adds the key/value pairs to every line. A
+// key that the Logger already has is replaced, so that each line has it once.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+next:
+	for i := 0; i+1 < len(kv); i += 2 {
+		for j := 0; j+1 < len(fields); j += 2 {
+			if fields[j] == kv[i] {
+				fields[j+1] = kv[i+1]
+				continue next
+			}
+		}
+		fields = append(fields, kv[i], kv[i+1])
+	}
+	if len(kv)%2 == 1 {
+		fields = append(fields, kv[len(kv)-1])
+	}
+	return &Logger{out: l.out, fields: fields}
+}
+
+// SetLevel changes the minimum level written by the Logger and all Loggers
+// sharing its output.
+func (l *Logger) SetLevel(level Level) {
+	l.out.Lock()
+	defer l.out.Unlock()
+	l.out.level = level
+}
+
+// minRedactLength is the shortest secret that Redact will register. Shorter
+// values would mangle unrelated output.
+const minRedactLength = 4
+
+// Redact registers secret values that should be replaced with Redacted
+// wherever they appear in a log line.
+func (l *Logger) Redact(secrets ...string) {
+	l.out.Lock()
+	defer l.out.Unlock()
+	for _, s := range secrets {
+		if len(s) >= minRedactLength {
+			l.out.secrets = append(l.out.secrets, s)
+		}
+	}
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+func (l *Logger) Info(msg string, kv ...interface{})  { l.log(LevelInfo, msg, kv) }
+func (l *Logger) Warn(msg string, kv ...interface{})  { l.log(LevelWarn, msg, kv) }
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	l.out.Lock()
+	defer l.out.Unlock()
+
+	if level < l.out.level {
+		return
+	}
+
+	fields := make([]interface{}, 0, 6+len(l.fields)+len(kv))
+	fields = append(fields, "time", time.Now().UTC().Format(time.RFC3339Nano), "level", level.String(), "msg", msg)
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+
+	var buf bytes.Buffer
+	if l.out.format == FormatJSON {
+		l.out.writeJSON(&buf, fields)
+	} else {
+		l.out.writeLogfmt(&buf, fields)
+	}
+	buf.WriteByte('\n')
+	l.out.w.Write(buf.Bytes())
+}
+
+func (o *logOutput) writeLogfmt(buf *bytes.Buffer, fields []interface{}) {
+	for i := 0; i < len(fields); i += 2 {
+		key, value := o.pair(fields, i)
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		if value == "" || strings.ContainsAny(value, " \t\r\n\"=") {
+			buf.WriteString(strconv.Quote(value))
+		} else {
+			buf.WriteString(value)
+		}
+	}
+}
+
+func (o *logOutput) writeJSON(buf *bytes.Buffer, fields []interface{}) {
+	buf.WriteByte('{')
+	for i := 0; i < len(fields); i += 2 {
+		key, value := o.pair(fields, i)
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		v, _ := json.Marshal(value)
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+}
+
+// pair returns the key and the redacted, stringified value at fields[i].
+func (o *logOutput) pair(fields []interface{}, i int) (string, string) {
+	key := fmt.Sprint(fields[i])
+	if i+1 >= len(fields) {
+		return key, ""
+	}
+
+	for _, s := range sensitiveKeys {
+		if strings.Contains(strings.ToLower(key), s) {
+			return key, Redacted
+		}
+	}
+
+	var value string
+	switch v := fields[i+1].(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		value = strconv.FormatFloat(v.Seconds()*1000, 'f', 3, 64) + "ms"
+	default:
+		value = fmt.Sprint(v)
+	}
+
+	for _, s := range o.secrets {
+		value = strings.Replace(value, s, Redacted, -1)
+	}
+	return key, value
+}
@@ -0,0 +1,720 @@
+package quayd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the histogram buckets, in seconds, used for backend call
+// latencies.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultQuantiles are the quantiles reported for build durations, and
+// DefaultQuantileWindow is the number of recent builds of each series that
+// they're calculated over.
+var (
+	DefaultQuantiles      = []float64{.5, .9, .99}
+	DefaultQuantileWindow = 100
+)
+
+// DefaultRegistry is the Registry that quayd's own metrics are registered
+// with, and that is served on /metrics.
+var DefaultRegistry = NewRegistry()
+
+var (
+	// webhooksTotal counts received webhooks by Quay status and outcome.
+	webhooksTotal = DefaultRegistry.NewCounterVec(
+		"quayd_webhooks_total",
+		"Number of Quay webhooks received, by status and outcome.",
+		"status", "outcome",
+	)
+
+	// backendCallDuration tracks the latency of calls to GitHub and the
+	// registry.
+	backendCallDuration = DefaultRegistry.NewHistogramVec(
+		"quayd_backend_call_duration_seconds",
+		"Latency of calls to the backend interfaces, by call (e.g. Tagger.Tag) and result.",
+		DefaultBuckets,
+		"call", "result",
+	)
+
+	// webhooksInFlight is the number of webhooks currently being
+	// processed.
+	webhooksInFlight = DefaultRegistry.NewGauge(
+		"quayd_webhooks_in_flight",
+		"Number of Quay webhooks currently being processed.",
+	)
+
+	// githubRateLimit is the last seen rate limit of each GitHub host: the
+	// limit, the requests remaining, and the reset time as a unix
+	// timestamp.
+	githubRateLimit = DefaultRegistry.NewGaugeVec(
+		"quayd_github_rate_limit",
+		"GitHub rate limit by host and field (limit, remaining, or reset as a unix timestamp).",
+		"host", "field",
+	)
+
+	// githubStatusesQueued is the number of commit status writes waiting
+	// for a GitHub host's rate limit to reset.
+	githubStatusesQueued = DefaultRegistry.NewGaugeVec(
+		"quayd_github_statuses_queued",
+		"Number of commit status writes queued until the GitHub rate limit resets, by host.",
+		"host",
+	)
+
+	// buildHooksTotal counts BuildHook runs by hook and result.
+	buildHooksTotal = DefaultRegistry.NewCounterVec(
+		"quayd_build_hooks_total",
+		"Number of build hook runs, by hook and result.",
+		"hook", "result",
+	)
+
+	// deliveriesTotal counts Dispatcher deliveries by sink and result.
+	deliveriesTotal = DefaultRegistry.NewCounterVec(
+		"quayd_deliveries_total",
+		"Number of notification and event delivery attempts, by sink and result (success, retry, failed or dropped).",
+		"sink", "result",
+	)
+
+	// buildDuration tracks how long builds take from the pending webhook
+	// to the final one.
+	buildDuration = DefaultRegistry.NewSummaryVec(
+		"quayd_build_duration_seconds",
+		"Time from a build's pending webhook to its success or failure webhook, by repository and status.",
+		DefaultQuantiles,
+		DefaultQuantileWindow,
+		"repo", "status",
+	)
+
+	// slowBuildsTotal counts builds that took longer than their
+	// repository's threshold.
+	slowBuildsTotal = DefaultRegistry.NewCounterVec(
+		"quayd_slow_builds_total",
+		"Number of builds that took longer than their repository's slow build threshold, by repository.",
+		"repo",
+	)
+
+	// reconciledTagsTotal counts the commit tags checked by a Reconciler,
+	// by result.
+	reconciledTagsTotal = DefaultRegistry.NewCounterVec(
+		"quayd_reconciled_tags_total",
+		"Number of commit tags checked by the reconciler, by result (ok, fixed or error).",
+		"result",
+	)
+
+	// reapedBuildsTotal counts the stale pending builds checked by a
+	// Reaper, by result.
+	reapedBuildsTotal = DefaultRegistry.NewCounterVec(
+		"quayd_reaped_builds_total",
+		"Number of stale pending builds checked, by result (reaped, still_running, check_failed or error).",
+		"result",
+	)
+
+	// commitCacheTotal counts CachedCommitResolver lookups by result.
+	commitCacheTotal = DefaultRegistry.NewCounterVec(
+		"quayd_commit_cache_total",
+		"Number of commit resolutions, by cache result (hit, miss or full_sha).",
+		"result",
+	)
+)
+
+// collector is something that can write itself in the Prometheus text
+// exposition format.
+type collector interface {
+	writeTo(w io.Writer)
+}
+
+// Registry is a collection of metrics that can be served over HTTP in the
+// Prometheus text exposition format.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo writes all registered metrics to w.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, c := range collectors {
+		c.writeTo(&buf)
+	}
+	return buf.WriteTo(w)
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.WriteTo(w)
+}
+
+// metric holds the name, help text and label names shared by all series of a
+// metric.
+type metric struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (m *metric) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+}
+
+// key joins label values into a map key.
+func (m *metric) key(values []string) string {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", m.name, len(m.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs formats label values as {name="value",...}, with any extra
+// pairs appended.
+func (m *metric) labelPairs(key string, extra ...string) string {
+	var pairs []string
+	if len(m.labels) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, m.labels[i]+"="+quoteLabel(v))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+quoteLabel(extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func quoteLabel(v string) string {
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, "\n", `\n`, -1)
+	v = strings.Replace(v, `"`, `\"`, -1)
+	return `"` + v + `"`
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// valueVec is a set of float values keyed by label values. It backs both
+// counters and gauges.
+type valueVec struct {
+	metric
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func (v *valueVec) add(delta float64, labels []string) {
+	k := v.key(labels)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.values[k] += delta
+}
+
+func (v *valueVec) set(value float64, labels []string) {
+	k := v.key(labels)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.values[k] = value
+}
+
+func (v *valueVec) get(labels []string) float64 {
+	k := v.key(labels)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.values[k]
+}
+
+func (v *valueVec) writeTo(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.writeHeader(w)
+	for _, k := range sortedKeys(v.values) {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, v.labelPairs(k), formatFloat(v.values[k]))
+	}
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	valueVec
+}
+
+// NewCounterVec registers and returns a new CounterVec.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{valueVec{metric: metric{name, help, "counter", labels}, values: map[string]float64{}}}
+	r.register(c)
+	return c
+}
+
+// Inc increments the counter for the given label values.
+func (c *CounterVec) Inc(labels ...string) {
+	c.add(1, labels)
+}
+
+// Value returns the current value of the counter for the given label values.
+func (c *CounterVec) Value(labels ...string) float64 {
+	return c.get(labels)
+}
+
+// GaugeVec is a gauge partitioned by label values.
+type GaugeVec struct {
+	valueVec
+}
+
+// NewGaugeVec registers and returns a new GaugeVec.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{valueVec{metric: metric{name, help, "gauge", labels}, values: map[string]float64{}}}
+	r.register(g)
+	return g
+}
+
+// Set sets the gauge for the given label values.
+func (g *GaugeVec) Set(value float64, labels ...string) {
+	g.set(value, labels)
+}
+
+// Add adds delta to the gauge for the given label values.
+func (g *GaugeVec) Add(delta float64, labels ...string) {
+	g.add(delta, labels)
+}
+
+// Value returns the current value of the gauge for the given label values.
+func (g *GaugeVec) Value(labels ...string) float64 {
+	return g.get(labels)
+}
+
+// Gauge is a gauge without labels.
+type Gauge struct {
+	*GaugeVec
+}
+
+// NewGauge registers and returns a new Gauge.
+func (r *Registry) NewGauge(name, help string) Gauge {
+	return Gauge{r.NewGaugeVec(name, help)}
+}
+
+// Set sets the gauge.
+func (g Gauge) Set(value float64) { g.GaugeVec.Set(value) }
+
+// Add adds delta to the gauge.
+func (g Gauge) Add(delta float64) { g.GaugeVec.Add(delta) }
+
+// Value returns the current value of the gauge.
+func (g Gauge) Value() float64 { return g.GaugeVec.Value() }
+
+// HistogramVec is a histogram partitioned by label values.
+type HistogramVec struct {
+	metric
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec registers and returns a new HistogramVec with the given
+// upper bounds.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		metric:  metric{name, help, "histogram", labels},
+		buckets: buckets,
+		series:  map[string]*histogram{},
+	}
+	r.register(h)
+	return h
+}
+
+// Observe records a value for the given label values.
+func (h *HistogramVec) Observe(value float64, labels ...string) {
+	k := h.key(labels)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[k]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[k] = s
+	}
+	for i, b := range h.buckets {
+		if value <= b {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// Count returns the number of observations for the given label values.
+func (h *HistogramVec) Count(labels ...string) uint64 {
+	k := h.key(labels)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[k]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) writeTo(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := h.series[k]
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(k, "le", formatFloat(b)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(k, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(k), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(k), s.count)
+	}
+}
+
+// SummaryVec is a summary partitioned by label values. Its quantiles are
+// calculated over the most recent observations of each series.
+type SummaryVec struct {
+	metric
+	quantiles []float64
+	window    int
+
+	mu     sync.Mutex
+	series map[string]*summary
+}
+
+type summary struct {
+	// recent is a ring of the last window observations, next is where the
+	// next one goes.
+	recent []float64
+	next   int
+	sum    float64
+	count  uint64
+}
+
+// NewSummaryVec registers and returns a new SummaryVec that reports the given
+// quantiles over the last window observations of each series.
+func (r *Registry) NewSummaryVec(name, help string, quantiles []float64, window int, labels ...string) *SummaryVec {
+	s := &SummaryVec{
+		metric:    metric{name, help, "summary", labels},
+		quantiles: quantiles,
+		window:    window,
+		series:    map[string]*summary{},
+	}
+	r.register(s)
+	return s
+}
+
+// Observe records a value for the given label values.
+func (s *SummaryVec) Observe(value float64, labels ...string) {
+	k := s.key(labels)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ss, ok := s.series[k]
+	if !ok {
+		ss = &summary{}
+		s.series[k] = ss
+	}
+	if len(ss.recent) < s.window {
+		ss.recent = append(ss.recent, value)
+	} else {
+		ss.recent[ss.next] = value
+	}
+	ss.next = (ss.next + 1) % s.window
+	ss.sum += value
+	ss.count++
+}
+
+// Quantile returns the q quantile of the recent observations for the given
+// label values, or NaN if there are none.
+func (s *SummaryVec) Quantile(q float64, labels ...string) float64 {
+	k := s.key(labels)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ss, ok := s.series[k]
+	if !ok {
+		return math.NaN()
+	}
+	return quantile(sortedCopy(ss.recent), q)
+}
+
+func (s *SummaryVec) writeTo(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.writeHeader(w)
+	keys := make([]string, 0, len(s.series))
+	for k := range s.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		ss := s.series[k]
+		recent := sortedCopy(ss.recent)
+		for _, q := range s.quantiles {
+			fmt.Fprintf(w, "%s%s %s\n", s.name, s.labelPairs(k, "quantile", formatFloat(q)), formatFloat(quantile(recent, q)))
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", s.name, s.labelPairs(k), formatFloat(ss.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", s.name, s.labelPairs(k), ss.count)
+	}
+}
+
+func sortedCopy(values []float64) []float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return sorted
+}
+
+// quantile returns the q quantile of sorted values, using the nearest rank.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// instrument starts a span for a backend call. The returned func must be
+// called with the call's error once it completes, to finish the span and
+// record the call's latency.
+func instrument(ctx context.Context, call string, attrs ...string) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, span := startSpan(ctx, call, SpanKindInternal)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		span.SetAttribute(attrs[i], attrs[i+1])
+	}
+
+	return ctx, func(err error) {
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		span.SetError(err)
+		span.Finish()
+		backendCallDuration.Observe(time.Since(start).Seconds(), call, result)
+	}
+}
+
+// InstrumentedStatusesRepository is a StatusesRepository that traces and
+// records the latency of each Create call.
+type InstrumentedStatusesRepository struct {
+	StatusesRepository
+}
+
+// Create implements StatusesRepository Create.
+func (r *InstrumentedStatusesRepository) Create(ctx context.Context, status *Status) (err error) {
+	ctx, done := instrument(ctx, "StatusesRepository.Create", "repo", status.Repo, "commit", status.Ref, "state", status.State)
+	defer func() { done(err) }()
+	return r.StatusesRepository.Create(ctx, status)
+}
+
+// InstrumentedCommitResolver is a CommitResolver that traces and records the
+// latency of each Resolve call.
+type InstrumentedCommitResolver struct {
+	CommitResolver
+}
+
+// Resolve implements CommitResolver Resolve.
+func (cr *InstrumentedCommitResolver) Resolve(ctx context.Context, repo, short string) (sha string, err error) {
+	ctx, done := instrument(ctx, "CommitResolver.Resolve", "repo", repo, "ref", short)
+	defer func() { done(err) }()
+	return cr.CommitResolver.Resolve(ctx, repo, short)
+}
+
+// InstrumentedTagger is a Tagger that traces and records the latency of each
+// Tag call.
+type InstrumentedTagger struct {
+	Tagger
+}
+
+// Tag implements Tagger Tag.
+func (t *InstrumentedTagger) Tag(ctx context.Context, repo, imageID, tag string) (err error) {
+	ctx, done := instrument(ctx, "Tagger.Tag", "repo", repo, "image_id", imageID, "tag", tag)
+	defer func() { done(err) }()
+	return t.Tagger.Tag(ctx, repo, imageID, tag)
+}
+
+// InstrumentedTagResolver is a TagResolver that traces and records the
+// latency of each Resolve call.
+type InstrumentedTagResolver struct {
+	TagResolver
+}
+
+// Resolve implements TagResolver Resolve.
+func (r *InstrumentedTagResolver) Resolve(ctx context.Context, repo, tag string) (imageID string, err error) {
+	ctx, done := instrument(ctx, "TagResolver.Resolve", "repo", repo, "tag", tag)
+	defer func() { done(err) }()
+	return r.TagResolver.Resolve(ctx, repo, tag)
+}
+
+// InstrumentedDeploymentsRepository is a DeploymentsRepository that traces and
+// records the latency of each call.
+type InstrumentedDeploymentsRepository struct {
+	DeploymentsRepository
+}
+
+// CreateDeployment implements DeploymentsRepository CreateDeployment.
+func (r *InstrumentedDeploymentsRepository) CreateDeployment(ctx context.Context, repo string, d *Deployment) (id int64, err error) {
+	ctx, done := instrument(ctx, "DeploymentsRepository.CreateDeployment", "repo", repo, "environment", d.Environment)
+	defer func() { done(err) }()
+	return r.DeploymentsRepository.CreateDeployment(ctx, repo, d)
+}
+
+// CreateDeploymentStatus implements DeploymentsRepository
+// CreateDeploymentStatus.
+func (r *InstrumentedDeploymentsRepository) CreateDeploymentStatus(ctx context.Context, repo string, id int64, s *DeploymentStatus) (err error) {
+	ctx, done := instrument(ctx, "DeploymentsRepository.CreateDeploymentStatus", "repo", repo, "state", s.State)
+	defer func() { done(err) }()
+	return r.DeploymentsRepository.CreateDeploymentStatus(ctx, repo, id, s)
+}
+
+// InstrumentedPullRequestsRepository is a PullRequestsRepository that traces
+// and records the latency of each call.
+type InstrumentedPullRequestsRepository struct {
+	PullRequestsRepository
+}
+
+// OpenPullRequests implements PullRequestsRepository OpenPullRequests.
+func (r *InstrumentedPullRequestsRepository) OpenPullRequests(ctx context.Context, repo, sha string) (numbers []int, err error) {
+	ctx, done := instrument(ctx, "PullRequestsRepository.OpenPullRequests", "repo", repo, "commit", sha)
+	defer func() { done(err) }()
+	return r.PullRequestsRepository.OpenPullRequests(ctx, repo, sha)
+}
+
+// Comments implements PullRequestsRepository Comments.
+func (r *InstrumentedPullRequestsRepository) Comments(ctx context.Context, repo string, number int) (comments []*Comment, err error) {
+	ctx, done := instrument(ctx, "PullRequestsRepository.Comments", "repo", repo, "number", strconv.Itoa(number))
+	defer func() { done(err) }()
+	return r.PullRequestsRepository.Comments(ctx, repo, number)
+}
+
+// CreateComment implements PullRequestsRepository CreateComment.
+func (r *InstrumentedPullRequestsRepository) CreateComment(ctx context.Context, repo string, number int, body string) (err error) {
+	ctx, done := instrument(ctx, "PullRequestsRepository.CreateComment", "repo", repo, "number", strconv.Itoa(number))
+	defer func() { done(err) }()
+	return r.PullRequestsRepository.CreateComment(ctx, repo, number, body)
+}
+
+// EditComment implements PullRequestsRepository EditComment.
+func (r *InstrumentedPullRequestsRepository) EditComment(ctx context.Context, repo string, id int64, body string) (err error) {
+	ctx, done := instrument(ctx, "PullRequestsRepository.EditComment", "repo", repo, "comment_id", strconv.FormatInt(id, 10))
+	defer func() { done(err) }()
+	return r.PullRequestsRepository.EditComment(ctx, repo, id, body)
+}
+
+// InstrumentedQuayAPI is a QuayAPI that traces and records the latency of
+// each call.
+type InstrumentedQuayAPI struct {
+	QuayAPI
+}
+
+// GetBuild implements QuayAPI GetBuild.
+func (q *InstrumentedQuayAPI) GetBuild(ctx context.Context, repo, id string) (b *QuayBuild, err error) {
+	ctx, done := instrument(ctx, "QuayAPI.GetBuild", "repo", repo, "build_id", id)
+	defer func() { done(err) }()
+	return q.QuayAPI.GetBuild(ctx, repo, id)
+}
+
+// ListBuilds implements QuayAPI ListBuilds.
+func (q *InstrumentedQuayAPI) ListBuilds(ctx context.Context, repo string, limit int) (builds []*QuayBuild, err error) {
+	ctx, done := instrument(ctx, "QuayAPI.ListBuilds", "repo", repo)
+	defer func() { done(err) }()
+	return q.QuayAPI.ListBuilds(ctx, repo, limit)
+}
+
+// GetTag implements QuayAPI GetTag.
+func (q *InstrumentedQuayAPI) GetTag(ctx context.Context, repo, tag string) (t *QuayTag, err error) {
+	ctx, done := instrument(ctx, "QuayAPI.GetTag", "repo", repo, "tag", tag)
+	defer func() { done(err) }()
+	return q.QuayAPI.GetTag(ctx, repo, tag)
+}
+
+// ListNotifications implements QuayAPI ListNotifications.
+func (q *InstrumentedQuayAPI) ListNotifications(ctx context.Context, repo string) (notifications []*QuayNotification, err error) {
+	ctx, done := instrument(ctx, "QuayAPI.ListNotifications", "repo", repo)
+	defer func() { done(err) }()
+	return q.QuayAPI.ListNotifications(ctx, repo)
+}
+
+// StartBuild implements QuayAPI StartBuild.
+func (q *InstrumentedQuayAPI) StartBuild(ctx context.Context, repo, triggerID string, req *QuayTriggerRequest) (b *QuayBuild, err error) {
+	ctx, done := instrument(ctx, "QuayAPI.StartBuild", "repo", repo, "trigger_id", triggerID)
+	defer func() { done(err) }()
+	return q.QuayAPI.StartBuild(ctx, repo, triggerID, req)
+}
+
+// ListRepositories implements QuayAPI ListRepositories.
+func (q *InstrumentedQuayAPI) ListRepositories(ctx context.Context, namespace string) (repos []string, err error) {
+	ctx, done := instrument(ctx, "QuayAPI.ListRepositories", "namespace", namespace)
+	defer func() { done(err) }()
+	return q.QuayAPI.ListRepositories(ctx, namespace)
+}
+
+// CreateNotification implements QuayAPI CreateNotification.
+func (q *InstrumentedQuayAPI) CreateNotification(ctx context.Context, repo string, n *QuayNotification) (created *QuayNotification, err error) {
+	ctx, done := instrument(ctx, "QuayAPI.CreateNotification", "repo", repo, "event", n.Event)
+	defer func() { done(err) }()
+	return q.QuayAPI.CreateNotification(ctx, repo, n)
+}
+
+// DeleteNotification implements QuayAPI DeleteNotification.
+func (q *InstrumentedQuayAPI) DeleteNotification(ctx context.Context, repo, uuid string) (err error) {
+	ctx, done := instrument(ctx, "QuayAPI.DeleteNotification", "repo", repo, "notification_id", uuid)
+	defer func() { done(err) }()
+	return q.QuayAPI.DeleteNotification(ctx, repo, uuid)
+}
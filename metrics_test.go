@@ -0,0 +1,87 @@
+package quayd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "A test counter.", "status")
+	h := r.NewHistogramVec("test_seconds", "A test histogram.", []float64{0.1, 1}, "call")
+	g := r.NewGauge("test_gauge", "A test gauge.")
+
+	c.Inc(`pen"ding`)
+	c.Inc(`pen"ding`)
+	h.Observe(0.5, "resolve")
+	g.Set(42)
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+
+	for _, want := range []string{
+		"# TYPE test_total counter",
+		`test_total{status="pen\"ding"} 2`,
+		`test_seconds_bucket{call="resolve",le="0.1"} 0`,
+		`test_seconds_bucket{call="resolve",le="1"} 1`,
+		`test_seconds_bucket{call="resolve",le="+Inf"} 1`,
+		`test_seconds_sum{call="resolve"} 0.5`,
+		`test_seconds_count{call="resolve"} 1`,
+		"test_gauge 42",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("Output =>\n%s\nwant it to contain %s", buf.String(), want)
+		}
+	}
+}
+
+func TestSummaryVec(t *testing.T) {
+	r := NewRegistry()
+	s := r.NewSummaryVec("test_duration_seconds", "A test summary.", []float64{.5, .9}, 10, "repo")
+
+	for i := 1; i <= 20; i++ {
+		s.Observe(float64(i), "acme/api")
+	}
+
+	// Only the last 10 observations count towards the quantiles.
+	if got, want := s.Quantile(.5, "acme/api"), 15.0; got != want {
+		t.Fatalf("Quantile(.5) => %v; want %v", got, want)
+	}
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+
+	for _, want := range []string{
+		"# TYPE test_duration_seconds summary",
+		`test_duration_seconds{repo="acme/api",quantile="0.5"} 15`,
+		`test_duration_seconds{repo="acme/api",quantile="0.9"} 19`,
+		`test_duration_seconds_sum{repo="acme/api"} 210`,
+		`test_duration_seconds_count{repo="acme/api"} 20`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("Output =>\n%s\nwant it to contain %s", buf.String(), want)
+		}
+	}
+}
+
+type errCommitResolver struct{}
+
+func (cr *errCommitResolver) Resolve(ctx context.Context, repo, short string) (string, error) {
+	return "", errors.New("boom")
+}
+
+func TestInstrumentedCommitResolver(t *testing.T) {
+	before := backendCallDuration.Count("CommitResolver.Resolve", "error")
+
+	cr := &InstrumentedCommitResolver{&errCommitResolver{}}
+	if _, err := cr.Resolve(context.Background(), "ejholmes/docker-statsd", "6607c19"); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if got, want := backendCallDuration.Count("CommitResolver.Resolve", "error"), before+1; got != want {
+		t.Fatalf("Count => %d; want %d", got, want)
+	}
+}
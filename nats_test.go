@@ -0,0 +1,213 @@
+package quayd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// natsServer is a fake NATS server that speaks enough of the protocol to
+// accept connections and published messages.
+type natsServer struct {
+	net.Listener
+
+	// token, if set, is the auth token that clients must send.
+	token string
+
+	mu       sync.Mutex
+	connects []natsConnect
+	messages []*BusMessage
+	conns    []net.Conn
+}
+
+func newNATSServer(t *testing.T, token string) *natsServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &natsServer{Listener: l, token: token}
+	go s.serve()
+	return s
+}
+
+func (s *natsServer) URL() *url.URL {
+	return &url.URL{Scheme: "nats", Host: s.Addr().String()}
+}
+
+func (s *natsServer) serve() {
+	for {
+		conn, err := s.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *natsServer) handle(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"max_payload\":1048576,\"auth_required\":%v}\r\n", s.token != "")
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(line, "CONNECT "):
+			var c natsConnect
+			json.Unmarshal([]byte(line[len("CONNECT "):]), &c)
+			s.mu.Lock()
+			s.connects = append(s.connects, c)
+			s.mu.Unlock()
+			if c.AuthToken != s.token {
+				conn.Write([]byte("-ERR 'Authorization Violation'\r\n"))
+				return
+			}
+		case strings.HasPrefix(line, "PUB "):
+			fields := strings.Fields(line)
+			n, _ := strconv.Atoi(fields[len(fields)-1])
+			data := make([]byte, n+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, &BusMessage{Topic: fields[1], Data: data[:n]})
+			s.mu.Unlock()
+		case line == "PING":
+			conn.Write([]byte("PONG\r\n"))
+		}
+	}
+}
+
+// published returns the published messages.
+func (s *natsServer) published() []*BusMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*BusMessage(nil), s.messages...)
+}
+
+// connected returns the CONNECTs sent by clients.
+func (s *natsServer) connected() []natsConnect {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]natsConnect(nil), s.connects...)
+}
+
+// disconnect closes every open client connection.
+func (s *natsServer) disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+func TestNATSPublisher(t *testing.T) {
+	s := newNATSServer(t, "")
+	defer s.Close()
+
+	p := &NATSPublisher{URL: s.URL()}
+	defer p.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := p.Publish(context.Background(), "quayd.build.success", "ejholmes/docker-statsd", []byte(`{"id":"1"}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	connects, messages := s.connected(), s.published()
+	if got, want := len(connects), 1; got != want {
+		t.Fatalf("Connects => %d; want %d", got, want)
+	}
+	if got, want := connects[0].Name, "quayd"; got != want {
+		t.Fatalf("Name => %s; want %s", got, want)
+	}
+	if got, want := len(messages), 2; got != want {
+		t.Fatalf("Messages => %d; want %d", got, want)
+	}
+	if got, want := messages[0].Topic, "quayd.build.success.ejholmes.docker-statsd"; got != want {
+		t.Fatalf("Subject => %s; want %s", got, want)
+	}
+	if got, want := string(messages[0].Data), `{"id":"1"}`; got != want {
+		t.Fatalf("Data => %s; want %s", got, want)
+	}
+}
+
+func TestNATSPublisher_Reconnect(t *testing.T) {
+	s := newNATSServer(t, "")
+	defer s.Close()
+
+	p := &NATSPublisher{URL: s.URL()}
+	defer p.Close()
+
+	if err := p.Publish(context.Background(), "quayd.build.success", "acme/api", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	s.disconnect()
+
+	// The first publish after the server goes away fails, and the next one
+	// reconnects.
+	if err := p.Publish(context.Background(), "quayd.build.success", "acme/api", []byte(`{}`)); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if err := p.Publish(context.Background(), "quayd.build.success", "acme/api", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(s.connected()), 2; got != want {
+		t.Fatalf("Connects => %d; want %d", got, want)
+	}
+}
+
+func TestNATSPublisher_Auth(t *testing.T) {
+	s := newNATSServer(t, "secret")
+	defer s.Close()
+
+	u := s.URL()
+	p := &NATSPublisher{URL: u}
+	err := p.Publish(context.Background(), "quayd.build.success", "acme/api", []byte(`{}`))
+	if _, ok := err.(*permanentError); !ok {
+		t.Fatalf("err => %v; want a permanent error", err)
+	}
+
+	u.User = url.User("secret")
+	p = &NATSPublisher{URL: u}
+	defer p.Close()
+	if err := p.Publish(context.Background(), "quayd.build.success", "acme/api", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNATSSubject(t *testing.T) {
+	tests := []struct {
+		topic, key string
+		subject    string
+	}{
+		{"quayd.build.success", "acme/api", "quayd.build.success.acme.api"},
+		{"quayd.build.success", "acme/api.v2", "quayd.build.success.acme.api_v2"},
+		{"quayd.build.failure", "", "quayd.build.failure"},
+	}
+
+	for _, tt := range tests {
+		if got, want := natsSubject(tt.topic, tt.key), tt.subject; got != want {
+			t.Fatalf("natsSubject(%q, %q) => %s; want %s", tt.topic, tt.key, got, want)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package quayd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Notification events.
+const (
+	// NotifyBuildFailed is sent when a build fails.
+	NotifyBuildFailed = "build_failed"
+
+	// NotifyImagePromoted is sent when a build succeeds and its image has
+	// been tagged with the commit sha.
+	NotifyImagePromoted = "image_promoted"
+
+	// NotifyBuildSlow is sent when a build takes longer than its
+	// repository's slow build threshold.
+	NotifyBuildSlow = "build_slow"
+)
+
+// notificationEvents maps build statuses to the notification sent for them.
+var notificationEvents = map[string]string{
+	"failure": NotifyBuildFailed,
+	"success": NotifyImagePromoted,
+}
+
+// DefaultNotificationTemplates are the text/templates used to render each
+// notification event. They're executed with the *Build.
+var DefaultNotificationTemplates = map[string]string{
+	NotifyBuildFailed:   `Build of {{.Repository}}@{{short .Commit}}{{if .Branch}} on {{.Branch}}{{end}} failed: {{.URL}}`,
+	NotifyImagePromoted: `{{.ImageRef}}{{if .Branch}} from {{.Branch}}{{end}} is ready: {{.URL}}`,
+	NotifyBuildSlow:     `Build of {{.Repository}}@{{short .Commit}}{{if .Branch}} on {{.Branch}}{{end}} took {{.Duration}}: {{.URL}}`,
+}
+
+// templateFuncs are available to notification templates.
+var templateFuncs = template.FuncMap{
+	// short abbreviates a commit sha.
+	"short": func(sha string) string {
+		if len(sha) > 7 {
+			return sha[:7]
+		}
+		return sha
+	},
+}
+
+// ParseNotificationTemplates parses notification templates by event, filling
+// in DefaultNotificationTemplates for events without one.
+func ParseNotificationTemplates(templates map[string]string) (map[string]*template.Template, error) {
+	parsed := make(map[string]*template.Template)
+	for event, text := range DefaultNotificationTemplates {
+		if t, ok := templates[event]; ok && t != "" {
+			text = t
+		}
+		t, err := template.New(event).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s template: %v", event, err)
+		}
+		parsed[event] = t
+	}
+	for event := range templates {
+		if _, ok := parsed[event]; !ok {
+			return nil, fmt.Errorf("unknown notification event: %q", event)
+		}
+	}
+	return parsed, nil
+}
+
+// Notification tells a team about a build's outcome.
+type Notification struct {
+	// Event is NotifyBuildFailed or NotifyImagePromoted.
+	Event string `json:"event"`
+
+	// Text is the rendered message.
+	Text string `json:"text"`
+
+	Build *Build `json:"build"`
+}
+
+// Notifier represents something that can deliver a Notification.
+type Notifier interface {
+	Notify(context.Context, *Notification) error
+}
+
+// notifier is a fake implementation of the Notifier interface.
+type notifier struct {
+	sync.Mutex
+	notifications []*Notification
+}
+
+func (n *notifier) Notify(ctx context.Context, notification *Notification) error {
+	n.Lock()
+	defer n.Unlock()
+	n.notifications = append(n.notifications, notification)
+	return nil
+}
+
+// SlackNotifier posts notifications to a Slack incoming webhook.
+type SlackNotifier struct {
+	URL string
+
+	// Channel, if set, overrides the webhook's default channel.
+	Channel string
+
+	Client *http.Client
+}
+
+// Notify implements Notifier Notify.
+func (n *SlackNotifier) Notify(ctx context.Context, notification *Notification) error {
+	msg := map[string]string{"text": notification.Text}
+	if n.Channel != "" {
+		msg["channel"] = n.Channel
+	}
+	return postJSON(ctx, n.Client, n.URL, "application/json", msg)
+}
+
+// TeamsNotifier posts notifications to a Microsoft Teams incoming webhook as
+// message cards.
+type TeamsNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify implements Notifier Notify.
+func (n *TeamsNotifier) Notify(ctx context.Context, notification *Notification) error {
+	color := "2EB886"
+	if notification.Event == NotifyBuildFailed {
+		color = "D00000"
+	}
+
+	card := map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    notification.Text,
+		"text":       notification.Text,
+		"themeColor": color,
+	}
+	if b := notification.Build; b != nil && b.URL != "" {
+		card["potentialAction"] = []map[string]interface{}{{
+			"@type":   "OpenUri",
+			"name":    "View build",
+			"targets": []map[string]string{{"os": "default", "uri": b.URL}},
+		}}
+	}
+	return postJSON(ctx, n.Client, n.URL, "application/json", card)
+}
+
+// WebhookNotifier POSTs notifications as JSON to a url.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify implements Notifier Notify.
+func (n *WebhookNotifier) Notify(ctx context.Context, notification *Notification) error {
+	return postJSON(ctx, n.Client, n.URL, "application/json", notification)
+}
+
+// NotificationRoute sends notifications for some repositories and events to a
+// Notifier.
+type NotificationRoute struct {
+	// Name identifies the route in logs and metrics.
+	Name string
+
+	// Repos are the owners ("acme") and repositories ("acme/api") that the
+	// route is for. Empty means every repository.
+	Repos []string
+
+	// Events are the events that the route is for. Empty means every
+	// event.
+	Events []string
+
+	Notifier
+}
+
+func (r *NotificationRoute) matches(repo, event string) bool {
+	return (len(r.Repos) == 0 || containsMatch(r.Repos, repo)) &&
+		(len(r.Events) == 0 || contains(r.Events, event))
+}
+
+func containsMatch(patterns []string, repo string) bool {
+	for _, p := range patterns {
+		if matchRepo(p, repo) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNotificationRoutes parses a comma separated list of routes of the form
+// [repository[@event]=]kind:url, where kind is slack, teams or webhook. For
+// slack, a #channel fragment on the url overrides the webhook's channel. For
+// example:
+//
+//	acme/api@build_failed=slack:https://hooks.slack.com/services/...#api,teams:https://...
+func ParseNotificationRoutes(s string, client *http.Client) ([]*NotificationRoute, error) {
+	var routes []*NotificationRoute
+	for _, spec := range strings.Split(s, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		route := new(NotificationRoute)
+		if i := strings.Index(spec, "="); i >= 0 && !strings.Contains(spec[:i], ":") {
+			selector := spec[:i]
+			spec = spec[i+1:]
+			if j := strings.Index(selector, "@"); j >= 0 {
+				event := selector[j+1:]
+				if _, ok := DefaultNotificationTemplates[event]; !ok {
+					return nil, fmt.Errorf("unknown notification event: %q", event)
+				}
+				route.Events = []string{event}
+				selector = selector[:j]
+			}
+			if selector != "" {
+				route.Repos = []string{selector}
+			}
+		}
+
+		i := strings.Index(spec, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid notification route %q: expected kind:url", spec)
+		}
+		kind, raw := spec[:i], spec[i+1:]
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			// The url is likely a secret, so it isn't included.
+			return nil, fmt.Errorf("invalid %s notification url", kind)
+		}
+
+		switch kind {
+		case "slack":
+			channel := u.Fragment
+			if channel != "" {
+				channel = "#" + channel
+			}
+			u.Fragment = ""
+			route.Notifier = &SlackNotifier{URL: u.String(), Channel: channel, Client: client}
+		case "teams":
+			route.Notifier = &TeamsNotifier{URL: raw, Client: client}
+		case "webhook":
+			route.Notifier = &WebhookNotifier{URL: raw, Client: client}
+		default:
+			return nil, fmt.Errorf("unknown notifier: %q", kind)
+		}
+		route.Name = kind
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// Notifications is a BuildHook that notifies the matching routes when a build
+// fails or its image is promoted. Notifications are delivered in the
+// background by the Dispatcher, so a failing notifier never holds up tagging.
+type Notifications struct {
+	Routes []*NotificationRoute
+
+	// Templates render each event's text, by event. Defaults to
+	// DefaultNotificationTemplates.
+	Templates map[string]*template.Template
+
+	// Dispatcher delivers the notifications. Defaults to
+	// DefaultDispatcher.
+	Dispatcher *Dispatcher
+}
+
+// BuildEvent implements BuildHook BuildEvent. A slow build is notified as
+// build_slow, as well as failed or promoted.
+func (n *Notifications) BuildEvent(ctx context.Context, b *Build) error {
+	if b.Slow {
+		if err := n.notify(NotifyBuildSlow, b); err != nil {
+			return err
+		}
+	}
+
+	event, ok := notificationEvents[b.Status]
+	if !ok {
+		return nil
+	}
+	return n.notify(event, b)
+}
+
+// notify sends the event to the matching routes.
+func (n *Notifications) notify(event string, b *Build) error {
+	var routes []*NotificationRoute
+	for _, r := range n.Routes {
+		if r.matches(b.Repository, event) {
+			routes = append(routes, r)
+		}
+	}
+	if len(routes) == 0 {
+		return nil
+	}
+
+	text, err := n.render(event, b)
+	if err != nil {
+		return err
+	}
+	notification := &Notification{Event: event, Text: text, Build: b}
+
+	d := n.Dispatcher
+	if d == nil {
+		d = DefaultDispatcher
+	}
+	for _, r := range routes {
+		r := r
+		d.Go("notify:"+r.Name, func(ctx context.Context) error {
+			return r.Notify(ctx, notification)
+		})
+	}
+	return nil
+}
+
+func (n *Notifications) render(event string, b *Build) (string, error) {
+	templates := n.Templates
+	if templates == nil {
+		templates, _ = ParseNotificationTemplates(nil)
+	}
+
+	var buf bytes.Buffer
+	if err := templates[event].Execute(&buf, b); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
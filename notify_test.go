@@ -0,0 +1,186 @@
+package quayd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// notifierStandIn records the JSON bodies posted to it.
+type notifierStandIn struct {
+	*httptest.Server
+	code int
+
+	mu     sync.Mutex
+	bodies []map[string]interface{}
+}
+
+func newNotifierStandIn(code int) *notifierStandIn {
+	s := &notifierStandIn{code: code}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.bodies = append(s.bodies, body)
+		w.WriteHeader(s.code)
+	}))
+	return s
+}
+
+func TestParseNotificationRoutes(t *testing.T) {
+	routes, err := ParseNotificationRoutes("ejholmes/docker-statsd@build_failed=slack:https://hooks.slack.com/services/T0/B0/X#builds, teams:https://outlook.office.com/webhook/x?a=b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(routes), 2; got != want {
+		t.Fatalf("Routes => %d; want %d", got, want)
+	}
+
+	slack := routes[0].Notifier.(*SlackNotifier)
+	if got, want := slack.Channel, "#builds"; got != want {
+		t.Fatalf("Channel => %s; want %s", got, want)
+	}
+	if got, want := slack.URL, "https://hooks.slack.com/services/T0/B0/X"; got != want {
+		t.Fatalf("URL => %s; want %s", got, want)
+	}
+	if !routes[0].matches("ejholmes/docker-statsd", NotifyBuildFailed) || routes[0].matches("ejholmes/docker-statsd", NotifyImagePromoted) {
+		t.Fatal("Expected the slack route to only match failed builds")
+	}
+	if got, want := routes[1].Notifier.(*TeamsNotifier).URL, "https://outlook.office.com/webhook/x?a=b"; got != want {
+		t.Fatalf("URL => %s; want %s", got, want)
+	}
+	if !routes[1].matches("remind101/r101-api", NotifyImagePromoted) {
+		t.Fatal("Expected the teams route to match everything")
+	}
+
+	for _, in := range []string{"slack", "irc:https://example.com", "slack:hooks.slack.com", "acme@deployed=slack:https://hooks.slack.com"} {
+		if _, err := ParseNotificationRoutes(in, nil); err == nil {
+			t.Fatalf("ParseNotificationRoutes(%q): expected an error", in)
+		}
+	}
+}
+
+func TestParseNotificationTemplates(t *testing.T) {
+	templates, err := ParseNotificationTemplates(map[string]string{
+		NotifyBuildFailed: "{{.Repository}} broke at {{short .Commit}}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := &Notifications{Templates: templates}
+	b := &Build{Repository: "ejholmes/docker-statsd", Commit: "6607c19d3fd492ec53439f4104b39e4c62ece179", Image: "quay.io/ejholmes/docker-statsd"}
+
+	if got, _ := n.render(NotifyBuildFailed, b); got != "ejholmes/docker-statsd broke at 6607c19" {
+		t.Fatalf("Text => %q", got)
+	}
+	if got, _ := n.render(NotifyImagePromoted, b); got != "quay.io/ejholmes/docker-statsd:6607c19d3fd492ec53439f4104b39e4c62ece179 is ready: " {
+		t.Fatalf("Text => %q", got)
+	}
+
+	for _, in := range []map[string]string{{NotifyBuildFailed: "{{"}, {"deployed": "x"}} {
+		if _, err := ParseNotificationTemplates(in); err == nil {
+			t.Fatalf("ParseNotificationTemplates(%v): expected an error", in)
+		}
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	slack, teams, hook := newNotifierStandIn(200), newNotifierStandIn(200), newNotifierStandIn(200)
+	defer slack.Close()
+	defer teams.Close()
+	defer hook.Close()
+
+	d := &Dispatcher{Backoff: time.Millisecond}
+	n := &Notifications{
+		Routes: []*NotificationRoute{
+			{Name: "slack", Repos: []string{"ejholmes"}, Notifier: &SlackNotifier{URL: slack.URL, Channel: "#builds"}},
+			{Name: "teams", Events: []string{NotifyBuildFailed}, Notifier: &TeamsNotifier{URL: teams.URL}},
+			{Name: "webhook", Notifier: &WebhookNotifier{URL: hook.URL}},
+		},
+		Dispatcher: d,
+	}
+
+	b := &Build{ID: "1", Status: "success", Repository: "ejholmes/docker-statsd", Commit: "6607c19", Image: "quay.io/ejholmes/docker-statsd"}
+	if err := n.BuildEvent(nil, b); err != nil {
+		t.Fatal(err)
+	}
+	d.Wait()
+
+	if got, want := len(slack.bodies), 1; got != want {
+		t.Fatalf("Slack messages => %d; want %d", got, want)
+	}
+	if got, want := slack.bodies[0]["channel"], "#builds"; got != want {
+		t.Fatalf("Channel => %v; want %v", got, want)
+	}
+	if got, want := len(teams.bodies), 0; got != want {
+		t.Fatalf("Teams messages => %d; want %d", got, want)
+	}
+	if got, want := hook.bodies[0]["event"], NotifyImagePromoted; got != want {
+		t.Fatalf("Event => %v; want %v", got, want)
+	}
+
+	b.Status = "failure"
+	n.BuildEvent(nil, b)
+	d.Wait()
+
+	if got, want := len(teams.bodies), 1; got != want {
+		t.Fatalf("Teams messages => %d; want %d", got, want)
+	}
+	if got, want := teams.bodies[0]["@type"], "MessageCard"; got != want {
+		t.Fatalf("@type => %v; want %v", got, want)
+	}
+}
+
+func TestNotifications_Slow(t *testing.T) {
+	n := new(notifier)
+	d := &Dispatcher{Backoff: time.Millisecond}
+	notifications := &Notifications{
+		Routes:     []*NotificationRoute{{Name: "fake", Events: []string{NotifyBuildSlow}, Notifier: n}},
+		Dispatcher: d,
+	}
+
+	b := &Build{ID: "1", Status: "success", Repository: "acme/api", Commit: "6607c19d3fd492ec53439f4104b39e4c62ece179", Duration: 25 * time.Minute, Slow: true}
+	if err := notifications.BuildEvent(nil, b); err != nil {
+		t.Fatal(err)
+	}
+	d.Wait()
+
+	if got, want := len(n.notifications), 1; got != want {
+		t.Fatalf("Notifications => %d; want %d", got, want)
+	}
+	if got, want := n.notifications[0].Text, "Build of acme/api@6607c19 took 25m0s: "; got != want {
+		t.Fatalf("Text => %q; want %q", got, want)
+	}
+}
+
+func TestWebhook_NotificationFailure(t *testing.T) {
+	broken := newNotifierStandIn(http.StatusBadGateway)
+	defer broken.Close()
+
+	d := &Dispatcher{Attempts: 2, Backoff: time.Millisecond}
+	q := &Quayd{Hooks: []NamedBuildHook{
+		{"notifications", &Notifications{
+			Routes:     []*NotificationRoute{{Name: "slack", Notifier: &SlackNotifier{URL: broken.URL}}},
+			Dispatcher: d,
+		}},
+	}}
+	s := NewServer(q)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/quay/success", loadFixture("success_build", t))
+	s.ServeHTTP(resp, req)
+	d.Wait()
+
+	if got, want := resp.Code, http.StatusOK; got != want {
+		t.Fatalf("Status => %d; want %d", got, want)
+	}
+	if got, want := len(broken.bodies), 2; got != want {
+		t.Fatalf("Attempts => %d; want %d", got, want)
+	}
+}
@@ -0,0 +1,232 @@
+package quayd
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// QuayNotificationEvents are the Quay notification events that a Provisioner
+// creates, and the build status that each is sent to.
+var QuayNotificationEvents = map[string]string{
+	"build_queued":    "pending",
+	"build_success":   "success",
+	"build_failure":   "failure",
+	"build_cancelled": "error",
+}
+
+// Actions of a NotificationChange.
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionDelete    = "delete"
+	ActionUnchanged = "unchanged"
+)
+
+// NotificationChange is a change to a repository's notifications that brings
+// them in line with what quayd wants.
+type NotificationChange struct {
+	Repository string `json:"repository"`
+	Action     string `json:"action"`
+	Event      string `json:"event"`
+
+	// From is the url that an existing notification posts to, and To the
+	// url that it should post to. The secret is redacted from both.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+
+	existing *QuayNotification
+	desired  *QuayNotification
+}
+
+// Provisioner creates the webhook notifications that send a repository's
+// builds to quayd.
+type Provisioner struct {
+	Quay QuayAPI
+
+	// URL is quayd's external url, e.g. https://quayd.example.com. The
+	// notifications post to /quay/<status> under it.
+	URL *url.URL
+
+	// Secret, if set, is sent as the secret query parameter of each
+	// notification, as required by the server's WebhookSecret.
+	Secret string
+}
+
+// Repositories returns the repositories named by targets, which are either
+// owner/repo names or namespaces, whose repositories are listed from Quay.
+func (p *Provisioner) Repositories(ctx context.Context, targets []string) ([]string, error) {
+	var repos []string
+	for _, target := range targets {
+		if strings.Contains(target, "/") {
+			repos = append(repos, target)
+			continue
+		}
+		namespaced, err := p.Quay.ListRepositories(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, namespaced...)
+	}
+	return repos, nil
+}
+
+// Plan compares a repository's notifications with the ones quayd wants. Only
+// webhook notifications that post to quayd's /quay/<status> urls for the
+// QuayNotificationEvents are changed, and duplicates of them deleted, so that
+// other notifications are left alone. Notifications posting to quayd for
+// other events were set up by hand, and are reported as unchanged.
+func (p *Provisioner) Plan(ctx context.Context, repo string) ([]*NotificationChange, error) {
+	existing, err := p.Quay.ListNotifications(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := make(map[string][]*QuayNotification)
+	for _, n := range existing {
+		if p.owns(n) {
+			owned[n.Event] = append(owned[n.Event], n)
+		}
+	}
+
+	var changes []*NotificationChange
+	for _, event := range quayNotificationEvents() {
+		desired := p.notification(event)
+		change := &NotificationChange{
+			Repository: repo,
+			Event:      event,
+			To:         p.redact(desired.URL()),
+			desired:    desired,
+		}
+
+		have := owned[event]
+		delete(owned, event)
+		switch {
+		case len(have) == 0:
+			change.Action = ActionCreate
+		case have[0].URL() == desired.URL():
+			change.Action = ActionUnchanged
+		default:
+			change.Action = ActionUpdate
+		}
+		if len(have) > 0 {
+			change.existing = have[0]
+			change.From = p.redact(have[0].URL())
+			have = have[1:]
+		}
+		changes = append(changes, change)
+
+		for _, n := range have {
+			changes = append(changes, p.deletion(repo, n))
+		}
+	}
+
+	events := make([]string, 0, len(owned))
+	for event := range owned {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	for _, event := range events {
+		for _, n := range owned[event] {
+			changes = append(changes, &NotificationChange{
+				Repository: repo,
+				Action:     ActionUnchanged,
+				Event:      n.Event,
+				From:       p.redact(n.URL()),
+				To:         p.redact(n.URL()),
+				existing:   n,
+			})
+		}
+	}
+	return changes, nil
+}
+
+// Apply makes the planned changes. Quay can't edit a notification, so an
+// update creates the new notification before deleting the old one.
+func (p *Provisioner) Apply(ctx context.Context, changes []*NotificationChange) error {
+	for _, c := range changes {
+		if c.Action == ActionCreate || c.Action == ActionUpdate {
+			if _, err := p.Quay.CreateNotification(ctx, c.Repository, c.desired); err != nil {
+				return err
+			}
+		}
+		if c.Action == ActionUpdate || c.Action == ActionDelete {
+			if err := p.Quay.DeleteNotification(ctx, c.Repository, c.existing.UUID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Provisioner) deletion(repo string, n *QuayNotification) *NotificationChange {
+	return &NotificationChange{
+		Repository: repo,
+		Action:     ActionDelete,
+		Event:      n.Event,
+		From:       p.redact(n.URL()),
+		existing:   n,
+	}
+}
+
+// notification returns the notification that sends the event to quayd.
+func (p *Provisioner) notification(event string) *QuayNotification {
+	status := QuayNotificationEvents[event]
+	return &QuayNotification{
+		Title:  "quayd " + status,
+		Event:  event,
+		Method: "webhook",
+		Config: map[string]interface{}{"url": p.webhookURL(status)},
+	}
+}
+
+// webhookURL returns quayd's url for webhooks of a status.
+func (p *Provisioner) webhookURL(status string) string {
+	u := *p.URL
+	u.Path = path.Join("/", u.Path, "quay", status)
+	u.RawQuery = ""
+	if p.Secret != "" {
+		u.RawQuery = url.Values{"secret": {p.Secret}}.Encode()
+	}
+	return u.String()
+}
+
+// owns returns true if n is a webhook that posts to quayd.
+func (p *Provisioner) owns(n *QuayNotification) bool {
+	if n.Method != "webhook" {
+		return false
+	}
+	u, err := url.Parse(n.URL())
+	if err != nil || u.Host != p.URL.Host {
+		return false
+	}
+	dir, status := path.Split(u.Path)
+	return path.Clean(dir) == path.Join("/", p.URL.Path, "quay") && ValidStatus(status)
+}
+
+// redact replaces the secret in a url.
+func (p *Provisioner) redact(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	q := u.Query()
+	if q.Get("secret") == "" {
+		return s
+	}
+	q.Del("secret")
+	u.RawQuery = strings.TrimPrefix(q.Encode()+"&secret="+Redacted, "&")
+	return u.String()
+}
+
+// quayNotificationEvents returns the QuayNotificationEvents in order.
+func quayNotificationEvents() []string {
+	events := make([]string, 0, len(QuayNotificationEvents))
+	for event := range QuayNotificationEvents {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	return events
+}
@@ -0,0 +1,109 @@
+package quayd
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestProvisioner() (*Provisioner, *quayAPI) {
+	q := &quayAPI{
+		repositories: []string{"acme/api", "acme/web", "other/api"},
+		notifications: map[string][]*QuayNotification{
+			"acme/api": {
+				{UUID: "n1", Event: "build_success", Method: "webhook", Config: map[string]interface{}{"url": "https://quayd.example.com/quay/success"}},
+				{UUID: "n2", Event: "build_queued", Method: "webhook", Config: map[string]interface{}{"url": "https://quayd.example.com/quay/pending?secret=s3cret"}},
+				{UUID: "n3", Event: "build_start", Method: "webhook", Config: map[string]interface{}{"url": "https://quayd.example.com/quay/pending"}},
+				{UUID: "n4", Event: "build_failure", Method: "slack", Config: map[string]interface{}{"url": "https://hooks.slack.com/services/1234"}},
+				{UUID: "n5", Event: "build_failure", Method: "webhook", Config: map[string]interface{}{"url": "https://ci.example.com/quay/failure"}},
+			},
+		},
+	}
+	u, _ := url.Parse("https://quayd.example.com")
+	return &Provisioner{Quay: q, URL: u, Secret: "s3cret"}, q
+}
+
+func TestProvisioner_Plan(t *testing.T) {
+	p, _ := newTestProvisioner()
+
+	changes, err := p.Plan(context.Background(), "acme/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, c := range changes {
+		got = append(got, strings.Join([]string{c.Action, c.Event, c.From, c.To}, " "))
+	}
+	want := []string{
+		"create build_cancelled  https://quayd.example.com/quay/error?secret=[REDACTED]",
+		"create build_failure  https://quayd.example.com/quay/failure?secret=[REDACTED]",
+		"unchanged build_queued https://quayd.example.com/quay/pending?secret=[REDACTED] https://quayd.example.com/quay/pending?secret=[REDACTED]",
+		"update build_success https://quayd.example.com/quay/success https://quayd.example.com/quay/success?secret=[REDACTED]",
+		"unchanged build_start https://quayd.example.com/quay/pending https://quayd.example.com/quay/pending",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Changes => %q; want %q", got, want)
+	}
+}
+
+func TestProvisioner_Apply(t *testing.T) {
+	p, q := newTestProvisioner()
+	ctx := context.Background()
+
+	changes, err := p.Plan(ctx, "acme/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Apply(ctx, changes); err != nil {
+		t.Fatal(err)
+	}
+
+	// The slack notification, the webhook to another host, and the
+	// build_start webhook that quayd doesn't manage, are left alone.
+	if got, want := len(q.notifications["acme/api"]), 7; got != want {
+		t.Fatalf("Notifications => %d; want %d", got, want)
+	}
+
+	changes, err = p.Plan(ctx, "acme/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range changes {
+		if c.Action != ActionUnchanged {
+			t.Fatalf("Action(%s) => %s; want %s", c.Event, c.Action, ActionUnchanged)
+		}
+	}
+	if got, want := len(changes), len(QuayNotificationEvents)+1; got != want {
+		t.Fatalf("Changes => %d; want %d", got, want)
+	}
+}
+
+func TestProvisioner_Repositories(t *testing.T) {
+	p, _ := newTestProvisioner()
+
+	repos, err := p.Repositories(context.Background(), []string{"acme", "other/api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(repos, ","), "acme/api,acme/web,other/api"; got != want {
+		t.Fatalf("Repositories => %s; want %s", got, want)
+	}
+}
+
+func TestProvisioner_Subpath(t *testing.T) {
+	u, _ := url.Parse("https://example.com/quayd/")
+	p := &Provisioner{URL: u}
+
+	if got, want := p.webhookURL("success"), "https://example.com/quayd/quay/success"; got != want {
+		t.Fatalf("webhookURL => %s; want %s", got, want)
+	}
+	if !p.owns(&QuayNotification{Method: "webhook", Config: map[string]interface{}{"url": "https://example.com/quayd/quay/failure"}}) {
+		t.Fatal("Expected the notification to be owned")
+	}
+	if p.owns(&QuayNotification{Method: "webhook", Config: map[string]interface{}{"url": "https://example.com/quay/failure"}}) {
+		t.Fatal("Expected the notification not to be owned")
+	}
+}
@@ -0,0 +1,213 @@
+package quayd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ejholmes/go-github/github"
+)
+
+// commentMarker is hidden in the comments quayd posts, so that it can find and
+// edit them on later builds.
+const commentMarker = "<!-- quayd:image -->"
+
+// Comment is a comment on a pull request.
+type Comment struct {
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+}
+
+// PullRequestsRepository represents something that can find the pull requests
+// for a commit and manage their comments.
+type PullRequestsRepository interface {
+	// OpenPullRequests returns the numbers of the open pull requests whose
+	// head is the commit.
+	OpenPullRequests(ctx context.Context, repo, sha string) ([]int, error)
+
+	// Comments returns the comments on a pull request.
+	Comments(ctx context.Context, repo string, number int) ([]*Comment, error)
+
+	// CreateComment comments on a pull request.
+	CreateComment(ctx context.Context, repo string, number int, body string) error
+
+	// EditComment replaces the body of a comment.
+	EditComment(ctx context.Context, repo string, id int64, body string) error
+}
+
+// pullRequestsRepository is a fake implementation of the
+// PullRequestsRepository interface.
+type pullRequestsRepository struct {
+	sync.Mutex
+	pulls    map[string][]int
+	comments map[int][]*Comment
+	nextID   int64
+}
+
+func (r *pullRequestsRepository) OpenPullRequests(ctx context.Context, repo, sha string) ([]int, error) {
+	r.Lock()
+	defer r.Unlock()
+	return r.pulls[sha], nil
+}
+
+func (r *pullRequestsRepository) Comments(ctx context.Context, repo string, number int) ([]*Comment, error) {
+	r.Lock()
+	defer r.Unlock()
+	return r.comments[number], nil
+}
+
+func (r *pullRequestsRepository) CreateComment(ctx context.Context, repo string, number int, body string) error {
+	r.Lock()
+	defer r.Unlock()
+	if r.comments == nil {
+		r.comments = make(map[int][]*Comment)
+	}
+	r.nextID++
+	r.comments[number] = append(r.comments[number], &Comment{ID: r.nextID, Body: body})
+	return nil
+}
+
+func (r *pullRequestsRepository) EditComment(ctx context.Context, repo string, id int64, body string) error {
+	r.Lock()
+	defer r.Unlock()
+	for _, comments := range r.comments {
+		for _, c := range comments {
+			if c.ID == id {
+				c.Body = body
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("comment %d not found", id)
+}
+
+// GitHubPullRequestsRepository is an implementation of the
+// PullRequestsRepository interface backed by GitHub.
+type GitHubPullRequestsRepository struct {
+	Client *github.Client
+
+	// Budget, if set, tracks the rate limit reported by GitHub.
+	Budget *GitHubBudget
+}
+
+// commitPullsPreview enables listing the pull requests for a commit.
+const commitPullsPreview = "application/vnd.github.groot-preview+json"
+
+// OpenPullRequests implements PullRequestsRepository OpenPullRequests.
+func (r *GitHubPullRequestsRepository) OpenPullRequests(ctx context.Context, repo, sha string) ([]int, error) {
+	var pulls []struct {
+		Number int    `json:"number"`
+		State  string `json:"state"`
+		Head   struct {
+			SHA string `json:"sha"`
+		} `json:"head"`
+	}
+	resp, err := githubDoAccept(ctx, r.Client, "GET", fmt.Sprintf("repos/%s/commits/%s/pulls", repo, sha), commitPullsPreview, nil, &pulls)
+	r.Budget.Update(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var numbers []int
+	for _, p := range pulls {
+		if p.State == "open" && strings.EqualFold(p.Head.SHA, sha) {
+			numbers = append(numbers, p.Number)
+		}
+	}
+	return numbers, nil
+}
+
+// Comments implements PullRequestsRepository Comments.
+func (r *GitHubPullRequestsRepository) Comments(ctx context.Context, repo string, number int) ([]*Comment, error) {
+	var all []*Comment
+	for page := 1; page != 0; {
+		var comments []*Comment
+		resp, err := githubDo(ctx, r.Client, "GET", fmt.Sprintf("repos/%s/issues/%d/comments?per_page=100&page=%d", repo, number, page), nil, &comments)
+		r.Budget.Update(resp)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, comments...)
+		page = resp.NextPage
+	}
+	return all, nil
+}
+
+// CreateComment implements PullRequestsRepository CreateComment.
+func (r *GitHubPullRequestsRepository) CreateComment(ctx context.Context, repo string, number int, body string) error {
+	resp, err := githubDo(ctx, r.Client, "POST", fmt.Sprintf("repos/%s/issues/%d/comments", repo, number), map[string]string{"body": body}, nil)
+	r.Budget.Update(resp)
+	return err
+}
+
+// EditComment implements PullRequestsRepository EditComment.
+func (r *GitHubPullRequestsRepository) EditComment(ctx context.Context, repo string, id int64, body string) error {
+	resp, err := githubDo(ctx, r.Client, "PATCH", fmt.Sprintf("repos/%s/issues/comments/%d", repo, id), map[string]string{"body": body}, nil)
+	r.Budget.Update(resp)
+	return err
+}
+
+// PullRequestCommenter is a BuildHook that, when a build succeeds, keeps a
+// single comment on each open pull request for the commit up to date with
+// the built image.
+type PullRequestCommenter struct {
+	PullRequests PullRequestsRepository
+}
+
+// BuildEvent implements BuildHook BuildEvent.
+func (c *PullRequestCommenter) BuildEvent(ctx context.Context, b *Build) error {
+	if b.Status != "success" {
+		return nil
+	}
+
+	numbers, err := c.PullRequests.OpenPullRequests(ctx, b.Repository, b.Commit)
+	if err != nil {
+		return err
+	}
+
+	body := imageComment(b)
+	for _, n := range numbers {
+		if err := c.comment(ctx, b.Repository, n, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// comment edits quayd's comment on the pull request, or creates it if there
+// isn't one.
+func (c *PullRequestCommenter) comment(ctx context.Context, repo string, number int, body string) error {
+	comments, err := c.PullRequests.Comments(ctx, repo, number)
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range comments {
+		if !strings.Contains(existing.Body, commentMarker) {
+			continue
+		}
+		if existing.Body == body {
+			return nil
+		}
+		return c.PullRequests.EditComment(ctx, repo, existing.ID, body)
+	}
+	return c.PullRequests.CreateComment(ctx, repo, number, body)
+}
+
+// imageComment returns the markdown comment describing the build's image.
+func imageComment(b *Build) string {
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, commentMarker)
+	fmt.Fprintf(&buf, "**Docker image built** for %s\n\n", b.Commit)
+	fmt.Fprintln(&buf, "| | |")
+	fmt.Fprintln(&buf, "|---|---|")
+	fmt.Fprintf(&buf, "| Image | `%s` |\n", b.ImageRef())
+	if b.ImageID != "" {
+		fmt.Fprintf(&buf, "| Digest | `%s` |\n", b.ImageID)
+	}
+	fmt.Fprintf(&buf, "| Build | [%s](%s) |\n\n", b.ID, b.URL)
+	fmt.Fprintf(&buf, "```\ndocker pull %s\n```\n", b.ImageRef())
+	return buf.String()
+}
@@ -0,0 +1,104 @@
+package quayd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ejholmes/go-github/github"
+)
+
+func TestPullRequestCommenter(t *testing.T) {
+	sha := "6607c19d3fd492ec53439f4104b39e4c62ece179"
+	r := &pullRequestsRepository{pulls: map[string][]int{sha: {1, 2}}}
+	r.CreateComment(context.Background(), "ejholmes/docker-statsd", 1, "LGTM")
+	c := &PullRequestCommenter{PullRequests: r}
+
+	b := &Build{ID: "1", Status: "success", Repository: "ejholmes/docker-statsd", Commit: sha, Image: "quay.io/ejholmes/docker-statsd", ImageID: "abcd", URL: "https://quay.io/build/1"}
+	if err := c.BuildEvent(context.Background(), b); err != nil {
+		t.Fatal(err)
+	}
+
+	// A later build edits the comment in place.
+	b.ID, b.ImageID = "2", "efgh"
+	if err := c.BuildEvent(context.Background(), b); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(r.comments[1]), 2; got != want {
+		t.Fatalf("Comments on #1 => %d; want %d", got, want)
+	}
+	if got, want := len(r.comments[2]), 1; got != want {
+		t.Fatalf("Comments on #2 => %d; want %d", got, want)
+	}
+
+	body := r.comments[2][0].Body
+	for _, want := range []string{commentMarker, "`quay.io/ejholmes/docker-statsd:" + sha + "`", "`efgh`", "docker pull quay.io/ejholmes/docker-statsd:" + sha} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("Comment %q doesn't contain %q", body, want)
+		}
+	}
+}
+
+func TestPullRequestCommenter_Pending(t *testing.T) {
+	r := &pullRequestsRepository{pulls: map[string][]int{"abcd": {1}}}
+	c := &PullRequestCommenter{PullRequests: r}
+
+	if err := c.BuildEvent(context.Background(), &Build{Status: "pending", Commit: "abcd"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(r.comments), 0; got != want {
+		t.Fatalf("Comments => %d; want %d", got, want)
+	}
+}
+
+func TestGitHubPullRequestsRepository(t *testing.T) {
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/ejholmes/docker-statsd/commits/abcd/pulls":
+			w.Write([]byte(`[
+				{"number": 1, "state": "open", "head": {"sha": "abcd"}},
+				{"number": 2, "state": "closed", "head": {"sha": "abcd"}},
+				{"number": 3, "state": "open", "head": {"sha": "efgh"}}
+			]`))
+		case "/repos/ejholmes/docker-statsd/issues/1/comments":
+			if r.URL.Query().Get("page") == "1" {
+				w.Header().Set("Link", fmt.Sprintf(`<%s%s?page=2>; rel="next"`, s.URL, r.URL.Path))
+				w.Write([]byte(`[{"id": 10, "body": "LGTM"}]`))
+				return
+			}
+			w.Write([]byte(`[{"id": 11, "body": "` + commentMarker + `"}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	g := github.NewClient(nil)
+	g.BaseURL, _ = url.Parse(s.URL + "/")
+	r := &GitHubPullRequestsRepository{Client: g}
+
+	numbers, err := r.OpenPullRequests(context.Background(), "ejholmes/docker-statsd", "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(numbers) != 1 || numbers[0] != 1 {
+		t.Fatalf("OpenPullRequests => %v; want [1]", numbers)
+	}
+
+	comments, err := r.Comments(context.Background(), "ejholmes/docker-statsd", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(comments), 2; got != want {
+		t.Fatalf("Comments => %d; want %d", got, want)
+	}
+	if got, want := comments[1].ID, int64(11); got != want {
+		t.Fatalf("ID => %d; want %d", got, want)
+	}
+}
@@ -0,0 +1,478 @@
+package quayd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// DefaultQuayAPIURL is the url of Quay's API.
+const DefaultQuayAPIURL = "https://quay.io/api/v1/"
+
+// QuayBuild is a build in Quay.
+type QuayBuild struct {
+	ID string `json:"id"`
+
+	// Phase is the build's phase, e.g. waiting, building, complete or
+	// error.
+	Phase string `json:"phase"`
+
+	// Started is when the build started, as formatted by Quay.
+	Started string `json:"started"`
+
+	// Tags are the tags the build pushes.
+	Tags []string `json:"tags"`
+
+	// TriggerMetadata describes the commit that triggered the build.
+	TriggerMetadata map[string]interface{} `json:"trigger_metadata"`
+
+	// ManualUser is the user who started the build, if it was started by
+	// hand.
+	ManualUser string `json:"manual_user,omitempty"`
+
+	DisplayName string `json:"display_name"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Status returns the build's phase as a quayd build status: pending, success
+// or failure.
+func (b *QuayBuild) Status() string {
+	switch b.Phase {
+	case "complete":
+		return "success"
+	case "error", "internalerror", "cancelled", "expired":
+		return "failure"
+	}
+	return "pending"
+}
+
+// Commit returns the sha of the commit that triggered the build, if any.
+func (b *QuayBuild) Commit() string {
+	commit, _ := b.TriggerMetadata["commit"].(string)
+	return commit
+}
+
+// QuayTag is a tag in a Quay repository.
+type QuayTag struct {
+	Name string `json:"name"`
+
+	// ManifestDigest is the digest of the tag's manifest, e.g.
+	// sha256:....
+	ManifestDigest string `json:"manifest_digest"`
+
+	// ImageID is the id of the tagged image.
+	ImageID string `json:"docker_image_id"`
+
+	LastModified string `json:"last_modified"`
+}
+
+// QuayNotification is a repository notification in Quay.
+type QuayNotification struct {
+	UUID  string `json:"uuid"`
+	Title string `json:"title"`
+
+	// Event is the event that triggers the notification, e.g.
+	// build_success.
+	Event string `json:"event"`
+
+	// Method is how the notification is sent, e.g. webhook.
+	Method string `json:"method"`
+
+	Config      map[string]interface{} `json:"config"`
+	EventConfig map[string]interface{} `json:"event_config"`
+}
+
+// URL returns the url that a webhook notification posts to.
+func (n *QuayNotification) URL() string {
+	u, _ := n.Config["url"].(string)
+	return u
+}
+
+// QuayTriggerRequest says what to build when starting a build trigger. One of
+// CommitSHA or BranchName should be set.
+type QuayTriggerRequest struct {
+	CommitSHA  string `json:"commit_sha,omitempty"`
+	BranchName string `json:"branch_name,omitempty"`
+}
+
+// QuayAPI represents Quay's API.
+type QuayAPI interface {
+	// GetBuild returns a build of a repository.
+	GetBuild(ctx context.Context, repo, id string) (*QuayBuild, error)
+
+	// ListBuilds returns the most recent builds of a repository, newest
+	// first.
+	ListBuilds(ctx context.Context, repo string, limit int) ([]*QuayBuild, error)
+
+	// GetTag returns a tag of a repository. It returns ErrTagNotFound if
+	// the tag doesn't exist.
+	GetTag(ctx context.Context, repo, tag string) (*QuayTag, error)
+
+	// ListNotifications returns the notifications of a repository.
+	ListNotifications(ctx context.Context, repo string) ([]*QuayNotification, error)
+
+	// StartBuild starts a build trigger of a repository.
+	StartBuild(ctx context.Context, repo, triggerID string, req *QuayTriggerRequest) (*QuayBuild, error)
+
+	// ListRepositories returns the repositories in a namespace, as
+	// namespace/name.
+	ListRepositories(ctx context.Context, namespace string) ([]string, error)
+
+	// CreateNotification adds a notification to a repository.
+	CreateNotification(ctx context.Context, repo string, n *QuayNotification) (*QuayNotification, error)
+
+	// DeleteNotification removes a notification from a repository.
+	DeleteNotification(ctx context.Context, repo, uuid string) error
+}
+
+// quayAPI is a fake implementation of the QuayAPI interface.
+type quayAPI struct {
+	sync.Mutex
+
+	// builds are the builds of each repository, newest first.
+	builds map[string][]*QuayBuild
+
+	// tags are keyed by repo:tag.
+	tags map[string]*QuayTag
+
+	notifications map[string][]*QuayNotification
+	started       []*QuayTriggerRequest
+	repositories  []string
+}
+
+func (q *quayAPI) GetBuild(ctx context.Context, repo, id string) (*QuayBuild, error) {
+	q.Lock()
+	defer q.Unlock()
+	for _, b := range q.builds[repo] {
+		if b.ID == id {
+			return b, nil
+		}
+	}
+	return nil, &QuayError{StatusCode: http.StatusNotFound, Message: "Not Found"}
+}
+
+func (q *quayAPI) ListBuilds(ctx context.Context, repo string, limit int) ([]*QuayBuild, error) {
+	q.Lock()
+	defer q.Unlock()
+	builds := q.builds[repo]
+	if limit > 0 && len(builds) > limit {
+		builds = builds[:limit]
+	}
+	return builds, nil
+}
+
+func (q *quayAPI) GetTag(ctx context.Context, repo, tag string) (*QuayTag, error) {
+	q.Lock()
+	defer q.Unlock()
+	if t, ok := q.tags[repo+":"+tag]; ok {
+		return t, nil
+	}
+	return nil, ErrTagNotFound
+}
+
+func (q *quayAPI) ListNotifications(ctx context.Context, repo string) ([]*QuayNotification, error) {
+	q.Lock()
+	defer q.Unlock()
+	return q.notifications[repo], nil
+}
+
+func (q *quayAPI) StartBuild(ctx context.Context, repo, triggerID string, req *QuayTriggerRequest) (*QuayBuild, error) {
+	q.Lock()
+	defer q.Unlock()
+	q.started = append(q.started, req)
+	b := &QuayBuild{ID: fmt.Sprintf("build-%d", len(q.started)), Phase: "waiting"}
+	if q.builds == nil {
+		q.builds = make(map[string][]*QuayBuild)
+	}
+	q.builds[repo] = append([]*QuayBuild{b}, q.builds[repo]...)
+	return b, nil
+}
+
+func (q *quayAPI) ListRepositories(ctx context.Context, namespace string) ([]string, error) {
+	q.Lock()
+	defer q.Unlock()
+	var repos []string
+	for _, repo := range q.repositories {
+		if strings.HasPrefix(repo, namespace+"/") {
+			repos = append(repos, repo)
+		}
+	}
+	return repos, nil
+}
+
+func (q *quayAPI) CreateNotification(ctx context.Context, repo string, n *QuayNotification) (*QuayNotification, error) {
+	q.Lock()
+	defer q.Unlock()
+	created := *n
+	created.UUID = fmt.Sprintf("notification-%d", len(q.notifications[repo])+1)
+	if q.notifications == nil {
+		q.notifications = make(map[string][]*QuayNotification)
+	}
+	q.notifications[repo] = append(q.notifications[repo], &created)
+	return &created, nil
+}
+
+func (q *quayAPI) DeleteNotification(ctx context.Context, repo, uuid string) error {
+	q.Lock()
+	defer q.Unlock()
+	for i, n := range q.notifications[repo] {
+		if n.UUID == uuid {
+			q.notifications[repo] = append(q.notifications[repo][:i], q.notifications[repo][i+1:]...)
+			return nil
+		}
+	}
+	return &QuayError{StatusCode: http.StatusNotFound, Message: "Not Found"}
+}
+
+// QuayError is an error response from Quay's API.
+type QuayError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *QuayError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// isQuayNotFound returns true if err is Quay responding with a 404.
+func isQuayNotFound(err error) bool {
+	e, ok := err.(*QuayError)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// QuayClient is an implementation of the QuayAPI interface backed by Quay's
+// API.
+type QuayClient struct {
+	// BaseURL is the API url. Defaults to DefaultQuayAPIURL.
+	BaseURL *url.URL
+
+	// Token is an OAuth access token, e.g. of a Quay application or robot.
+	Token string
+
+	Client *http.Client
+}
+
+// GetBuild implements QuayAPI GetBuild.
+func (c *QuayClient) GetBuild(ctx context.Context, repo, id string) (*QuayBuild, error) {
+	var b QuayBuild
+	if err := c.do(ctx, "GET", fmt.Sprintf("repository/%s/build/%s", repo, url.PathEscape(id)), nil, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// ListBuilds implements QuayAPI ListBuilds.
+func (c *QuayClient) ListBuilds(ctx context.Context, repo string, limit int) ([]*QuayBuild, error) {
+	path := fmt.Sprintf("repository/%s/build/", repo)
+	if limit > 0 {
+		path += fmt.Sprintf("?limit=%d", limit)
+	}
+
+	var resp struct {
+		Builds []*QuayBuild `json:"builds"`
+	}
+	if err := c.do(ctx, "GET", path, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Builds, nil
+}
+
+// GetTag implements QuayAPI GetTag.
+func (c *QuayClient) GetTag(ctx context.Context, repo, tag string) (*QuayTag, error) {
+	var resp struct {
+		Tags []*QuayTag `json:"tags"`
+	}
+	path := fmt.Sprintf("repository/%s/tag/?onlyActiveTags=true&specificTag=%s", repo, url.QueryEscape(tag))
+	if err := c.do(ctx, "GET", path, nil, &resp); err != nil {
+		return nil, err
+	}
+	for _, t := range resp.Tags {
+		if t.Name == tag {
+			return t, nil
+		}
+	}
+	return nil, ErrTagNotFound
+}
+
+// ListNotifications implements QuayAPI ListNotifications.
+func (c *QuayClient) ListNotifications(ctx context.Context, repo string) ([]*QuayNotification, error) {
+	var resp struct {
+		Notifications []*QuayNotification `json:"notifications"`
+	}
+	if err := c.do(ctx, "GET", fmt.Sprintf("repository/%s/notification/", repo), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Notifications, nil
+}
+
+// StartBuild implements QuayAPI StartBuild.
+func (c *QuayClient) StartBuild(ctx context.Context, repo, triggerID string, req *QuayTriggerRequest) (*QuayBuild, error) {
+	var b QuayBuild
+	if err := c.do(ctx, "POST", fmt.Sprintf("repository/%s/trigger/%s/start", repo, url.PathEscape(triggerID)), req, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// ListRepositories implements QuayAPI ListRepositories.
+func (c *QuayClient) ListRepositories(ctx context.Context, namespace string) ([]string, error) {
+	var (
+		repos    []string
+		nextPage string
+	)
+	for {
+		path := "repository?namespace=" + url.QueryEscape(namespace)
+		if nextPage != "" {
+			path += "&next_page=" + url.QueryEscape(nextPage)
+		}
+
+		var resp struct {
+			Repositories []struct {
+				Namespace string `json:"namespace"`
+				Name      string `json:"name"`
+			} `json:"repositories"`
+			NextPage string `json:"next_page"`
+		}
+		if err := c.do(ctx, "GET", path, nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, r := range resp.Repositories {
+			repos = append(repos, r.Namespace+"/"+r.Name)
+		}
+
+		if resp.NextPage == "" {
+			return repos, nil
+		}
+		nextPage = resp.NextPage
+	}
+}
+
+// CreateNotification implements QuayAPI CreateNotification.
+func (c *QuayClient) CreateNotification(ctx context.Context, repo string, n *QuayNotification) (*QuayNotification, error) {
+	eventConfig := n.EventConfig
+	if eventConfig == nil {
+		eventConfig = map[string]interface{}{}
+	}
+	req := map[string]interface{}{
+		"event":       n.Event,
+		"method":      n.Method,
+		"config":      n.Config,
+		"eventConfig": eventConfig,
+		"title":       n.Title,
+	}
+
+	var created QuayNotification
+	if err := c.do(ctx, "POST", fmt.Sprintf("repository/%s/notification/", repo), req, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// DeleteNotification implements QuayAPI DeleteNotification.
+func (c *QuayClient) DeleteNotification(ctx context.Context, repo, uuid string) error {
+	return c.do(ctx, "DELETE", fmt.Sprintf("repository/%s/notification/%s", repo, url.PathEscape(uuid)), nil, nil)
+}
+
+// do sends an API request, with body encoded as JSON, and decodes the response
+// into v.
+func (c *QuayClient) do(ctx context.Context, method, path string, body, v interface{}) error {
+	base := c.BaseURL
+	if base == nil {
+		base, _ = url.Parse(DefaultQuayAPIURL)
+	}
+	u, err := withTrailingSlash(base).Parse(path)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequest(method, u.String(), r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := httpClient(c.Client).Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return quayError(req, resp)
+	}
+	if v == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// quayError returns the QuayError for an error response.
+func quayError(req *http.Request, resp *http.Response) error {
+	raw, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	var body struct {
+		ErrorMessage string `json:"error_message"`
+		Detail       string `json:"detail"`
+		Message      string `json:"message"`
+	}
+	json.Unmarshal(raw, &body)
+
+	msg := body.ErrorMessage
+	if msg == "" {
+		msg = body.Detail
+	}
+	if msg == "" {
+		msg = body.Message
+	}
+	if msg == "" {
+		msg = strings.TrimSpace(http.StatusText(resp.StatusCode))
+	}
+	return &QuayError{
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		StatusCode: resp.StatusCode,
+		Message:    msg,
+	}
+}
+
+// QuayBuildStatuses is a BuildStatuses that asks Quay's API.
+type QuayBuildStatuses struct {
+	QuayAPI
+}
+
+// BuildStatus implements BuildStatuses BuildStatus. A build that Quay doesn't
+// know about has failed.
+func (s *QuayBuildStatuses) BuildStatus(ctx context.Context, repo, id string) (string, error) {
+	b, err := s.GetBuild(ctx, repo, id)
+	if isQuayNotFound(err) {
+		return "failure", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return b.Status(), nil
+}
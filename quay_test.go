@@ -0,0 +1,269 @@
+package quayd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newQuayServer returns a stand-in for Quay's API, serving acme/api, and the
+// trigger requests it received.
+func newQuayServer(t *testing.T) (*httptest.Server, *[]QuayTriggerRequest) {
+	var started []QuayTriggerRequest
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/repository/acme/api/build/", func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.URL.Query().Get("limit"), "2"; got != want {
+			t.Errorf("limit => %q; want %q", got, want)
+		}
+		w.Write([]byte(`{"builds": [
+			{"id": "b2", "phase": "building", "trigger_metadata": {"commit": "d2c3b4a"}},
+			{"id": "b1", "phase": "complete", "tags": ["latest"], "trigger_metadata": {"commit": "6607c19d3fd492ec53439f4104b39e4c62ece179"}}
+		]}`))
+	})
+	mux.HandleFunc("/api/v1/repository/acme/api/build/b1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "b1", "phase": "complete", "tags": ["latest"]}`))
+	})
+	mux.HandleFunc("/api/v1/repository/acme/api/build/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"detail": "Not Found", "error_message": "Not Found", "status": 404}`))
+	})
+	mux.HandleFunc("/api/v1/repository/acme/api/tag/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("specificTag") != "latest" {
+			w.Write([]byte(`{"tags": []}`))
+			return
+		}
+		w.Write([]byte(`{"tags": [{"name": "latest", "manifest_digest": "sha256:abcd", "docker_image_id": "1234"}]}`))
+	})
+	mux.HandleFunc("/api/v1/repository/acme/api/notification/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			var req map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Error(err)
+			}
+			if _, ok := req["eventConfig"]; !ok {
+				t.Error("Expected an eventConfig")
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"uuid": "n2", "event": req["event"], "method": req["method"], "config": req["config"]})
+			return
+		}
+		w.Write([]byte(`{"notifications": [
+			{"uuid": "n1", "event": "build_success", "method": "webhook", "config": {"url": "https://quayd.example.com/quay/success"}}
+		]}`))
+	})
+	mux.HandleFunc("/api/v1/repository/acme/api/notification/n1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Errorf("Method => %s; want DELETE", r.Method)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/api/v1/repository", func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.URL.Query().Get("namespace"), "acme"; got != want {
+			t.Errorf("namespace => %q; want %q", got, want)
+		}
+		if r.URL.Query().Get("next_page") == "" {
+			w.Write([]byte(`{"repositories": [{"namespace": "acme", "name": "api"}], "next_page": "abc"}`))
+			return
+		}
+		w.Write([]byte(`{"repositories": [{"namespace": "acme", "name": "web"}]}`))
+	})
+	mux.HandleFunc("/api/v1/repository/acme/api/trigger/t1/start", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Method => %s; want POST", r.Method)
+		}
+		var req QuayTriggerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		started = append(started, req)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "b3", "phase": "waiting"}`))
+	})
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.Header.Get("Authorization"), "Bearer 1234"; got != want {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error_message": "Unauthorized"}`))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	return s, &started
+}
+
+func newTestQuayClient(s *httptest.Server, token string) *QuayClient {
+	u, _ := url.Parse(s.URL + "/api/v1")
+	return &QuayClient{BaseURL: u, Token: token, Client: s.Client()}
+}
+
+func TestQuayClient(t *testing.T) {
+	s, started := newQuayServer(t)
+	defer s.Close()
+
+	c := newTestQuayClient(s, "1234")
+	ctx := context.Background()
+
+	b, err := c.GetBuild(ctx, "acme/api", "b1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.Status(), "success"; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+
+	builds, err := c.ListBuilds(ctx, "acme/api", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(builds), 2; got != want {
+		t.Fatalf("Builds => %d; want %d", got, want)
+	}
+	if got, want := builds[0].Status(), "pending"; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+	if got, want := builds[1].Commit(), "6607c19d3fd492ec53439f4104b39e4c62ece179"; got != want {
+		t.Fatalf("Commit => %s; want %s", got, want)
+	}
+
+	tag, err := c.GetTag(ctx, "acme/api", "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tag.ManifestDigest, "sha256:abcd"; got != want {
+		t.Fatalf("ManifestDigest => %s; want %s", got, want)
+	}
+	if _, err := c.GetTag(ctx, "acme/api", "6607c19"); err != ErrTagNotFound {
+		t.Fatalf("err => %v; want %v", err, ErrTagNotFound)
+	}
+
+	notifications, err := c.ListNotifications(ctx, "acme/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(notifications), 1; got != want {
+		t.Fatalf("Notifications => %d; want %d", got, want)
+	}
+	if got, want := notifications[0].URL(), "https://quayd.example.com/quay/success"; got != want {
+		t.Fatalf("URL => %s; want %s", got, want)
+	}
+
+	n, err := c.CreateNotification(ctx, "acme/api", &QuayNotification{
+		Event:  "build_failure",
+		Method: "webhook",
+		Config: map[string]interface{}{"url": "https://quayd.example.com/quay/failure"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n.UUID, "n2"; got != want {
+		t.Fatalf("UUID => %s; want %s", got, want)
+	}
+	if got, want := n.URL(), "https://quayd.example.com/quay/failure"; got != want {
+		t.Fatalf("URL => %s; want %s", got, want)
+	}
+	if err := c.DeleteNotification(ctx, "acme/api", "n1"); err != nil {
+		t.Fatal(err)
+	}
+
+	repos, err := c.ListRepositories(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(repos, ","), "acme/api,acme/web"; got != want {
+		t.Fatalf("Repositories => %s; want %s", got, want)
+	}
+
+	b, err = c.StartBuild(ctx, "acme/api", "t1", &QuayTriggerRequest{CommitSHA: "6607c19d3fd492ec53439f4104b39e4c62ece179"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.ID, "b3"; got != want {
+		t.Fatalf("ID => %s; want %s", got, want)
+	}
+	if got, want := len(*started), 1; got != want {
+		t.Fatalf("Started => %d; want %d", got, want)
+	}
+	if got, want := (*started)[0].CommitSHA, "6607c19d3fd492ec53439f4104b39e4c62ece179"; got != want {
+		t.Fatalf("CommitSHA => %s; want %s", got, want)
+	}
+}
+
+func TestQuayClient_Errors(t *testing.T) {
+	s, _ := newQuayServer(t)
+	defer s.Close()
+
+	tests := []struct {
+		token string
+		id    string
+		code  int
+		msg   string
+	}{
+		{"1234", "missing", http.StatusNotFound, "Not Found"},
+		{"", "b1", http.StatusUnauthorized, "Unauthorized"},
+	}
+
+	for _, tt := range tests {
+		_, err := newTestQuayClient(s, tt.token).GetBuild(context.Background(), "acme/api", tt.id)
+		e, ok := err.(*QuayError)
+		if !ok {
+			t.Fatalf("err => %v; want a QuayError", err)
+		}
+		if got, want := e.StatusCode, tt.code; got != want {
+			t.Fatalf("StatusCode => %d; want %d", got, want)
+		}
+		if got, want := e.Message, tt.msg; got != want {
+			t.Fatalf("Message => %q; want %q", got, want)
+		}
+	}
+}
+
+func TestQuayBuild_Status(t *testing.T) {
+	tests := map[string]string{
+		"waiting":         "pending",
+		"build-scheduled": "pending",
+		"building":        "pending",
+		"pushing":         "pending",
+		"complete":        "success",
+		"error":           "failure",
+		"internalerror":   "failure",
+		"cancelled":       "failure",
+		"expired":         "failure",
+	}
+
+	for phase, want := range tests {
+		b := &QuayBuild{Phase: phase}
+		if got := b.Status(); got != want {
+			t.Fatalf("Status(%s) => %s; want %s", phase, got, want)
+		}
+	}
+}
+
+func TestQuayBuildStatuses(t *testing.T) {
+	q := &quayAPI{builds: map[string][]*QuayBuild{
+		"acme/api": {{ID: "b1", Phase: "building"}},
+	}}
+	s := &QuayBuildStatuses{q}
+
+	tests := []struct {
+		id     string
+		status string
+	}{
+		{"b1", "pending"},
+		{"missing", "failure"},
+	}
+
+	for _, tt := range tests {
+		status, err := s.BuildStatus(context.Background(), "acme/api", tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := status, tt.status; got != want {
+			t.Fatalf("BuildStatus(%s) => %s; want %s", tt.id, got, want)
+		}
+	}
+}
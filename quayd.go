@@ -2,12 +2,17 @@ package quayd
 
 import (
 	// "code.google.com/p/goauth2/oauth"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/ejholmes/go-github/github"
 	"golang.org/x/oauth2"
 	"net/http"
+	"net/url"
 	"strings"
+	"text/template"
+	"time"
 )
 
 var (
@@ -34,6 +39,7 @@ var (
 		"pending": "The Docker image is building",
 		"success": "The Docker image was built",
 		"failure": "The Docker image failed to build",
+		"error":   "The Docker image build was cancelled or errored",
 	}
 )
 
@@ -51,7 +57,7 @@ type Status struct {
 // Commit Statuses.
 type StatusesRepository interface {
 	// Create creates a GitHub Commit Status.
-	Create(*Status) error
+	Create(context.Context, *Status) error
 }
 
 // statusesRepository is a fake implementation of the StatusesRepository
@@ -61,7 +67,7 @@ type statusesRepository struct {
 }
 
 // Create implements StatusesRepository Create.
-func (r *statusesRepository) Create(status *Status) error {
+func (r *statusesRepository) Create(ctx context.Context, status *Status) error {
 	r.statuses = append(r.statuses, status)
 
 	return nil
@@ -75,13 +81,14 @@ func (r *statusesRepository) Reset() {
 // GitHubStatusesRepository is an implementation of the StatusesRepository
 // interface backed by a github.Client.
 type GitHubStatusesRepository struct {
-	RepositoriesService interface {
-		CreateStatus(owner, repo, ref string, status *github.RepoStatus) (*github.RepoStatus, *github.Response, error)
-	}
+	Client *github.Client
+
+	// Budget, if set, tracks the rate limit reported by GitHub.
+	Budget *GitHubBudget
 }
 
 // Create implements StatusesRepository Create.
-func (r *GitHubStatusesRepository) Create(status *Status) error {
+func (r *GitHubStatusesRepository) Create(ctx context.Context, status *Status) error {
 
 	st := &github.RepoStatus{
 		State:       &status.State,
@@ -90,15 +97,14 @@ func (r *GitHubStatusesRepository) Create(status *Status) error {
 		Description: &status.Description,
 	}
 
-	// Split `owner/repo` into ["owner", "repo"].
-	c := strings.Split(status.Repo, "/")
+	owner, name, err := splitRepo(status.Repo)
+	if err != nil {
+		return err
+	}
 
-	_, _, err := r.RepositoriesService.CreateStatus(
-		c[0],
-		c[1],
-		status.Ref,
-		st,
-	)
+	u := fmt.Sprintf("repos/%v/%v/statuses/%v", owner, name, status.Ref)
+	resp, err := githubDo(ctx, r.Client, "POST", u, st, nil)
+	r.Budget.Update(resp)
 	return err
 }
 
@@ -106,44 +112,56 @@ func (r *GitHubStatusesRepository) Create(status *Status) error {
 // character sha.
 type CommitResolver interface {
 	// Resolve resolves the short sha to a full 40 character sha.
-	Resolve(repo, short string) (string, error)
+	Resolve(ctx context.Context, repo, short string) (string, error)
 }
 
 // commitResolver returns the short sha prefixed with the string "long".
 type commitResolver struct{}
 
 // Resolve implements CommitResolver Resolve.
-func (cr *commitResolver) Resolve(repo, short string) (string, error) {
+func (cr *commitResolver) Resolve(ctx context.Context, repo, short string) (string, error) {
 	return "long-" + short, nil
 }
 
 // GitHubCommitResolver is an implementation of CommitResolver backed by a
 // github.Client.
 type GitHubCommitResolver struct {
-	RepositoriesService interface {
-		GetCommit(owner, repo, sha string) (*github.RepositoryCommit, *github.Response, error)
-	}
+	Client *github.Client
+
+	// Budget, if set, tracks the rate limit reported by GitHub. Commits
+	// aren't resolved while it's exhausted.
+	Budget *GitHubBudget
 }
 
 // Resolve implements CommitResolver Resolve.
-func (cr *GitHubCommitResolver) Resolve(repo, short string) (string, error) {
-	// Split `owner/repo` into ["owner", "repo"].
-	c := strings.Split(repo, "/")
-	cm, _, err := cr.RepositoriesService.GetCommit(
-		c[0],
-		c[1],
-		short,
-	)
+func (cr *GitHubCommitResolver) Resolve(ctx context.Context, repo, short string) (string, error) {
+	owner, name, err := splitRepo(repo)
 	if err != nil {
 		return "", err
 	}
+	if len(short) < minShortSHALength && isHex(short) {
+		return "", ErrAmbiguousCommit
+	}
+	if cr.Budget.Exhausted() {
+		return "", ErrRateLimited
+	}
+	u := fmt.Sprintf("repos/%v/%v/commits/%v", owner, name, short)
+	cm := new(github.RepositoryCommit)
+	resp, err := githubDo(ctx, cr.Client, "GET", u, nil, cm)
+	cr.Budget.Update(resp)
+	if err != nil {
+		if isAmbiguousCommit(err) {
+			return "", ErrAmbiguousCommit
+		}
+		return "", err
+	}
 	return *cm.SHA, nil
 }
 
 // Tagger is an interface for tagging a docker image with a tag.
 type Tagger interface {
 	// Tag tags the imageID with the given tag.
-	Tag(repo, imageID, tag string) error
+	Tag(ctx context.Context, repo, imageID, tag string) error
 }
 
 // tagger is a fake implementation of the Tagger interface.
@@ -151,19 +169,20 @@ type tagger struct {
 }
 
 // Tag implements Tagger Tag.
-func (t *tagger) Tag(repo, imageID, tag string) error {
+func (t *tagger) Tag(ctx context.Context, repo, imageID, tag string) error {
 	return nil
 }
 
 // DockerRegistryTagger is a Tagger implementation that can tag a
 // docker image by using the docker registry api
 type DockerRegistryTagger struct {
-	registry string
-	username string
-	password string
+	registry    string
+	credentials *Credentials
+	client      *http.Client
 }
 
-func (dt *DockerRegistryTagger) Tag(repo, imageID, tag string) error {
+// Tag implements Tagger Tag.
+func (dt *DockerRegistryTagger) Tag(ctx context.Context, repo, imageID, tag string) error {
 	req, err := http.NewRequest("PUT",
 		"https://"+dt.registry+"/v1/repositories/"+repo+"/tags/"+tag,
 		strings.NewReader(`"`+imageID+`"`))
@@ -171,38 +190,62 @@ func (dt *DockerRegistryTagger) Tag(repo, imageID, tag string) error {
 		return err
 	}
 	req.Header.Add("Content-Type", "application/json")
-	req.SetBasicAuth(dt.username, dt.password)
+	req.SetBasicAuth(dt.credentials.Registry())
 
-	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode >= 300 {
+	resp, err := httpClient(dt.client).Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
 		return errors.New("Unsuccessful Request: " + resp.Status)
 	}
 
-	return err
+	return nil
 }
 
 // TagResolver resolves a docker tag to an image id.
 type TagResolver interface {
-	Resolve(repo, tag string) (string, error)
+	Resolve(ctx context.Context, repo, tag string) (string, error)
 }
 
 // tagResolver is a fake implementation of the TagResolver interface.
 type tagResolver struct{}
 
-func (r *tagResolver) Resolve(repo, tag string) (string, error) {
+func (r *tagResolver) Resolve(ctx context.Context, repo, tag string) (string, error) {
 	return "", nil
 }
 
+// ErrTagNotFound is returned by a TagResolver when the tag doesn't exist.
+var ErrTagNotFound = errors.New("tag not found")
+
 // DockerTagResolver is an implementation of the TagResolver that resolves an
 // image tag to a docker image id, using the docker api.
 type DockerRegistryTagResolver struct {
 	registry string
+	client   *http.Client
 }
 
-func (r *DockerRegistryTagResolver) Resolve(repo, tag string) (string, error) {
-	resp, err := http.Get("https://" + r.registry + "/v1/repositories/" + repo + "/tags/" + tag)
+func (r *DockerRegistryTagResolver) Resolve(ctx context.Context, repo, tag string) (string, error) {
+	req, err := http.NewRequest("GET", "https://"+r.registry+"/v1/repositories/"+repo+"/tags/"+tag, nil)
 	if err != nil {
 		return "", err
 	}
+
+	resp, err := httpClient(r.client).Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrTagNotFound
+	}
+	if resp.StatusCode >= 300 {
+		return "", errors.New("Unsuccessful Request: " + resp.Status)
+	}
+
 	var imageID string
 	if err := json.NewDecoder(resp.Body).Decode(&imageID); err != nil {
 		return "", err
@@ -217,6 +260,58 @@ type Quayd struct {
 	CommitResolver
 	Tagger
 	TagResolver
+
+	// Timeouts bounds each call to the backends. Defaults to
+	// DefaultTimeouts.
+	Timeouts *Timeouts
+
+	// Checkers are the dependencies checked by the readiness endpoint,
+	// by name.
+	Checkers map[string]Checker
+
+	// Logger is used to log each call to the backends. Defaults to
+	// DefaultLogger.
+	Logger *Logger
+
+	// Hooks are run in order for each build event.
+	Hooks []NamedBuildHook
+
+	// GitHubBudgets are the rate limit budgets of each GitHub host, by the
+	// same names as Checkers.
+	GitHubBudgets map[string]*GitHubBudget
+
+	// CloudEvents, if set, receives an event for each stage of processing
+	// a build.
+	CloudEvents *CloudEventEmitter
+
+	// Builds, if set, is the history of builds served by the /api.
+	Builds BuildStore
+
+	// Publishers are the message buses that build events are published
+	// to, by name.
+	Publishers map[string]Publisher
+
+	// Dispatcher runs the hooks' background deliveries, so that they can
+	// be waited for before exiting.
+	Dispatcher *Dispatcher
+
+	// Registry is the host of the docker registry that images are tagged
+	// in. Defaults to DefaultRegistryHost.
+	Registry string
+
+	// Timer, if set, measures how long builds take.
+	Timer *BuildTimer
+
+	// Reaper, if set, flips the statuses of builds that are pending for
+	// too long to error. It must be Run.
+	Reaper *Reaper
+
+	// Quay, if set, is Quay's API.
+	Quay QuayAPI
+
+	// Reconciler, if set, tags the images of builds that are missing their
+	// commit sha tag. It must be Run.
+	Reconciler *Reconciler
 }
 
 type TokenSource struct {
@@ -230,35 +325,353 @@ func (t *TokenSource) Token() (*oauth2.Token, error) {
 	return token, nil
 }
 
+// DefaultRegistryHost is the docker registry that images are tagged in.
+const DefaultRegistryHost = "quay.io"
+
+// Options configures a Quayd built by NewWithOptions.
+type Options struct {
+	// GitHubToken is the API token used to create commit statuses.
+	GitHubToken string
+
+	// RegistryAuth is the registry's basic auth credentials, as
+	// username:password.
+	RegistryAuth string
+
+	// Credentials, if set, is used instead of GitHubToken and RegistryAuth,
+	// and allows them to be rotated while quayd is running.
+	Credentials *Credentials
+
+	// Registry is the host of the docker registry. Defaults to
+	// DefaultRegistryHost.
+	Registry string
+
+	// HTTPClient is used for all requests to GitHub and the registry.
+	// Defaults to DefaultHTTPClient.
+	HTTPClient *http.Client
+
+	// Timeouts bounds each call to the backends. Defaults to
+	// DefaultTimeouts.
+	Timeouts *Timeouts
+
+	// GitHubBaseURL is the GitHub API url, for GitHub Enterprise Server.
+	// Defaults to github.com.
+	GitHubBaseURL *url.URL
+
+	// GitHubUploadURL is the GitHub uploads url. Defaults to the /api/uploads/
+	// sibling of GitHubBaseURL.
+	GitHubUploadURL *url.URL
+
+	// GitHubHosts are additional GitHub Enterprise Server hosts, each serving
+	// the repositories it lists.
+	GitHubHosts []GitHubHost
+
+	// DeploymentRules, if set, create a GitHub Deployment when a build of a
+	// deployable branch succeeds.
+	DeploymentRules []DeploymentRule
+
+	// PullRequestComments, if true, keeps a comment describing the built
+	// image on the open pull requests for each successful build.
+	PullRequestComments bool
+
+	// NotificationRoutes, if set, notify teams when builds fail or images
+	// are promoted, using NotificationTemplates. The templates default to
+	// DefaultNotificationTemplates.
+	NotificationRoutes    []*NotificationRoute
+	NotificationTemplates map[string]*template.Template
+
+	// CloudEventSinks, if set, receive a CloudEvent for each stage of
+	// processing a build, from CloudEventSource. The source defaults to
+	// DefaultCloudEventSource.
+	CloudEventSinks  map[string]CloudEventSink
+	CloudEventSource string
+
+	// SlowBuildThresholds are how long builds can take before they're
+	// slow, and notify the NotificationRoutes of a build_slow event.
+	SlowBuildThresholds []SlowBuildThreshold
+
+	// PendingTimeout, if set, is how long a build can be pending before
+	// its commit status is flipped to error, unless BuildStatuses says it's
+	// still running. BuildStatuses defaults to asking Quay, if set.
+	PendingTimeout time.Duration
+	BuildStatuses  BuildStatuses
+
+	// Quay, if set, is Quay's API, e.g. a QuayClient.
+	Quay QuayAPI
+
+	// ReconcileRepositories, if set with Quay, are the repositories whose
+	// recent builds are checked for missing commit sha tags every
+	// ReconcileInterval. The interval defaults to DefaultReconcileInterval.
+	ReconcileRepositories []string
+	ReconcileInterval     time.Duration
+
+	// BuildStore, if set, records the history of every build.
+	BuildStore BuildStore
+
+	// Publishers, if set, receive every build event on the topic
+	// <TopicPrefix>.build.<status>, keyed by repository. The prefix
+	// defaults to DefaultTopicPrefix.
+	Publishers  map[string]Publisher
+	TopicPrefix string
+
+	// Dispatcher delivers notifications, CloudEvents and published build
+	// events, and runs the deployments and pull request comments hooks, in
+	// the background. Defaults to DefaultDispatcher.
+	Dispatcher *Dispatcher
+
+	// RateLimitReserve is the number of remaining GitHub requests below
+	// which status writes are queued until the rate limit resets. Defaults
+	// to DefaultRateLimitReserve.
+	RateLimitReserve int
+
+	// CommitCacheSize and CommitCacheTTL bound the cache of resolved
+	// commits. They default to DefaultCommitCacheSize and
+	// DefaultCommitCacheTTL.
+	CommitCacheSize int
+	CommitCacheTTL  time.Duration
+
+	// GitHubApp, if set, authenticates to GitHub as an installation of a
+	// GitHub App instead of with GitHubToken.
+	GitHubApp *GitHubApp
+}
+
+// ErrInvalidRegistryAuth is returned by ParseRegistryAuth when the
+// credentials aren't in the form username:password.
+var ErrInvalidRegistryAuth = errors.New("registry auth must be in the form username:password")
+
+// ParseRegistryAuth splits registry credentials in the form username:password.
+// An empty string is valid and means no credentials.
+func ParseRegistryAuth(auth string) (username, password string, err error) {
+	if auth == "" {
+		return "", "", nil
+	}
+	i := strings.Index(auth, ":")
+	if i <= 0 {
+		return auth, "", ErrInvalidRegistryAuth
+	}
+	return auth[:i], auth[i+1:], nil
+}
+
 // New returns a new Quayd instance backed by GitHub implementations.
 func New(token, registryAuth string) *Quayd {
+	return NewWithOptions(Options{
+		GitHubToken:  token,
+		RegistryAuth: registryAuth,
+	})
+}
 
-	tokenSource := &TokenSource{
-		AccessToken: token,
+// NewWithOptions returns a new Quayd instance backed by GitHub and docker
+// registry implementations, configured by opts.
+func NewWithOptions(opts Options) *Quayd {
+	client := httpClient(opts.HTTPClient)
+	registry := opts.Registry
+	if registry == "" {
+		registry = DefaultRegistryHost
+	}
+	dispatcher := opts.Dispatcher
+	if dispatcher == nil {
+		dispatcher = DefaultDispatcher
 	}
-	oauthClient := oauth2.NewClient(oauth2.NoContext, tokenSource)
 
-	gh := github.NewClient(oauthClient)
-	auth := strings.Split(registryAuth, ":")
-	return &Quayd{
-		StatusesRepository: &GitHubStatusesRepository{gh.Repositories},
-		CommitResolver:     &GitHubCommitResolver{gh.Repositories},
-		TagResolver:        &DockerRegistryTagResolver{registry: "quay.io"},
-		Tagger: &DockerRegistryTagger{registry: "quay.io",
-			username: auth[0],
-			password: auth[1]},
+	creds := opts.Credentials
+	if creds == nil {
+		creds = &Credentials{}
+		if err := creds.Update(opts.GitHubToken, opts.RegistryAuth); err != nil {
+			// Keep the GitHub token, so that statuses can still be
+			// created, and make the problem visible.
+			DefaultLogger.Error("invalid registry auth, registry requests will be unauthenticated", "error", err)
+			creds.Update(opts.GitHubToken, "")
+		}
 	}
+
+	gh := newGitHubRoute(client, opts.GitHubBaseURL, opts.GitHubUploadURL, creds, opts.GitHubApp, opts.RateLimitReserve)
+	checkers := map[string]Checker{"github": gh.checker}
+	budgets := map[string]*GitHubBudget{"github": gh.budget}
+
+	router := &GitHubRouter{Default: gh.GitHubRoute}
+	for _, host := range opts.GitHubHosts {
+		route := newGitHubRoute(client, host.BaseURL, host.UploadURL, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: host.Token}), host.App, opts.RateLimitReserve)
+		route.Repos = host.Repos
+		router.Routes = append(router.Routes, route.GitHubRoute)
+		checkers["github:"+host.BaseURL.Host] = route.checker
+		budgets["github:"+host.BaseURL.Host] = route.budget
+	}
+
+	statuses := &InstrumentedStatusesRepository{router}
+	commits := &CachedCommitResolver{
+		CommitResolver: &InstrumentedCommitResolver{router},
+		Size:           opts.CommitCacheSize,
+		TTL:            opts.CommitCacheTTL,
+	}
+
+	var quay QuayAPI
+	if opts.Quay != nil {
+		quay = &InstrumentedQuayAPI{opts.Quay}
+	}
+
+	var hooks []NamedBuildHook
+	var reaper *Reaper
+	if opts.PendingTimeout > 0 {
+		builds := opts.BuildStatuses
+		if builds == nil && quay != nil {
+			builds = &QuayBuildStatuses{quay}
+		}
+		reaper = &Reaper{
+			Statuses: statuses,
+			Commits:  commits,
+			Builds:   builds,
+			Timeout:  opts.PendingTimeout,
+		}
+		hooks = append(hooks, NamedBuildHook{"reaper", reaper})
+	}
+	if len(opts.DeploymentRules) > 0 {
+		hooks = append(hooks, NamedBuildHook{"deployments", &DispatchedBuildHook{
+			BuildHook: &Deployer{
+				Deployments: &InstrumentedDeploymentsRepository{router},
+				Rules:       opts.DeploymentRules,
+			},
+			Sink:       "hook:deployments",
+			Dispatcher: opts.Dispatcher,
+		}})
+	}
+	if len(opts.NotificationRoutes) > 0 {
+		hooks = append(hooks, NamedBuildHook{"notifications", &Notifications{
+			Routes:     opts.NotificationRoutes,
+			Templates:  opts.NotificationTemplates,
+			Dispatcher: opts.Dispatcher,
+		}})
+	}
+	if opts.BuildStore != nil {
+		hooks = append(hooks, NamedBuildHook{"history", &BuildHistory{Store: opts.BuildStore}})
+	}
+	if len(opts.Publishers) > 0 {
+		hooks = append(hooks, NamedBuildHook{"event_bus", &EventBus{
+			Publishers: opts.Publishers,
+			Prefix:     opts.TopicPrefix,
+			Dispatcher: opts.Dispatcher,
+		}})
+	}
+	if opts.PullRequestComments {
+		hooks = append(hooks, NamedBuildHook{"pull_request_comments", &DispatchedBuildHook{
+			BuildHook: &PullRequestCommenter{
+				PullRequests: &InstrumentedPullRequestsRepository{router},
+			},
+			Sink:       "hook:pull_request_comments",
+			Dispatcher: opts.Dispatcher,
+		}})
+	}
+
+	var events *CloudEventEmitter
+	if len(opts.CloudEventSinks) > 0 {
+		events = &CloudEventEmitter{
+			Source:     opts.CloudEventSource,
+			Sinks:      opts.CloudEventSinks,
+			Dispatcher: opts.Dispatcher,
+		}
+	}
+
+	tagger := &DockerRegistryTagger{registry: registry,
+		credentials: creds,
+		client:      client}
+	checkers["registry"] = tagger
+	q := &Quayd{
+		StatusesRepository: statuses,
+		CommitResolver:     commits,
+		TagResolver:        &InstrumentedTagResolver{&DockerRegistryTagResolver{registry: registry, client: client}},
+		Tagger:             &InstrumentedTagger{tagger},
+		Timeouts:           opts.Timeouts,
+		Checkers:           checkers,
+		GitHubBudgets:      budgets,
+		Hooks:              hooks,
+		CloudEvents:        events,
+		Builds:             opts.BuildStore,
+		Publishers:         opts.Publishers,
+		Dispatcher:         dispatcher,
+		Registry:           registry,
+		Timer:              &BuildTimer{Thresholds: opts.SlowBuildThresholds},
+		Reaper:             reaper,
+		Quay:               quay,
+	}
+	if quay != nil && len(opts.ReconcileRepositories) > 0 {
+		q.Reconciler = &Reconciler{
+			Quayd:        q,
+			Repositories: opts.ReconcileRepositories,
+			Interval:     opts.ReconcileInterval,
+		}
+	}
+	return q
 }
 
-// Handle resolves the ref to a full 40 character sha, then creates a new GitHub
-// Commit Status for that sha.
-func (q *Quayd) Handle(repo, ref, url, state string) error {
-	sha, err := q.commitResolver().Resolve(repo, ref)
-	if err != nil {
-		return err
+type githubRoute struct {
+	*GitHubRoute
+	checker Checker
+	budget  *GitHubBudget
+}
+
+// newGitHubRoute returns the route to a GitHub host, authenticating as the App
+// if it's set or with tokens from source otherwise.
+func newGitHubRoute(client *http.Client, baseURL, uploadURL *url.URL, source oauth2.TokenSource, app *GitHubApp, reserve int) githubRoute {
+	var transport http.RoundTripper = &oauth2.Transport{
+		Source: source,
+		Base:   client.Transport,
 	}
+	if app != nil {
+		if app.Client == nil {
+			app.Client = client
+		}
+		if app.BaseURL == "" && baseURL != nil {
+			app.BaseURL = baseURL.String()
+		}
+		transport = app.Transport(client.Transport)
+	}
+
+	gh := NewGitHubClient(&http.Client{
+		Transport: transport,
+		Timeout:   client.Timeout,
+	}, baseURL, uploadURL)
+	budget := &GitHubBudget{Host: gh.BaseURL.Host, Reserve: reserve}
+	statuses := &GitHubStatusesRepository{Client: gh, Budget: budget}
+
+	route := githubRoute{
+		GitHubRoute: &GitHubRoute{
+			StatusesRepository:     &BudgetedStatusesRepository{statuses, budget},
+			CommitResolver:         &GitHubCommitResolver{Client: gh, Budget: budget},
+			DeploymentsRepository:  &GitHubDeploymentsRepository{Client: gh, Budget: budget},
+			PullRequestsRepository: &GitHubPullRequestsRepository{Client: gh, Budget: budget},
+		},
+		checker: statuses,
+		budget:  budget,
+	}
+	if app != nil {
+		route.checker = app
+	}
+	return route
+}
+
+// Handle resolves the ref to a full 40 character sha, unless it already is
+// one, then creates a new GitHub Commit Status for that sha.
+func (q *Quayd) Handle(ctx context.Context, repo, ref, url, state string) error {
+	l := q.logger().With("repo", repo, "ref", ref)
+
+	timeouts := q.timeouts()
+
+	sha := ref
+	if !IsFullSHA(ref) {
+		start := time.Now()
+		rctx, cancel := withTimeout(ctx, timeouts.CommitResolver)
+		var err error
+		sha, err = q.commitResolver().Resolve(rctx, repo, ref)
+		cancel()
+		if err != nil {
+			l.Error("commit resolution failed", "duration", time.Since(start), "error", err)
+			return err
+		}
+		l.Debug("resolved commit", "duration", time.Since(start))
+	}
+	l = l.With("commit", sha)
 
-	return q.statusesRepository().Create(&Status{
+	start := time.Now()
+	sctx, cancel := withTimeout(ctx, timeouts.StatusesRepository)
+	err := q.statusesRepository().Create(sctx, &Status{
 		Repo:        repo,
 		TargetURL:   url,
 		Ref:         sha,
@@ -266,29 +679,104 @@ func (q *Quayd) Handle(repo, ref, url, state string) error {
 		Description: Statuses[state],
 		Context:     Context,
 	})
+	cancel()
+	if err != nil {
+		l.Error("creating commit status failed", "state", state, "duration", time.Since(start), "error", err)
+		return err
+	}
+	l.Info("created commit status", "state", state, "duration", time.Since(start))
+
+	q.CloudEvents.Emit(EventStatusReported, &CloudEventData{
+		Repository: repo,
+		Commit:     sha,
+		State:      state,
+		URL:        url,
+	})
+	return nil
+}
+
+// splitRepo splits an owner/repo name into the owner and repo.
+func splitRepo(repo string) (string, string, error) {
+	c := strings.Split(repo, "/")
+	if len(c) != 2 || c[0] == "" || c[1] == "" {
+		return "", "", fmt.Errorf("invalid repository %q: expected owner/repo", repo)
+	}
+	return c[0], c[1], nil
+}
+
+// isAmbiguousCommit returns true if err is GitHub refusing to resolve a short
+// sha because it matches more than one commit.
+func isAmbiguousCommit(err error) bool {
+	r, ok := err.(*github.ErrorResponse)
+	return ok && r.Response.StatusCode == http.StatusUnprocessableEntity &&
+		strings.Contains(strings.ToLower(r.Message), "ambiguous")
 }
 
 // LoadImageTags locates a build from its repo and tag and adds
 // tags for the Image ID as well as the Git SHA since the docker
 // registry does not currently support puling a docker image by its
 // immutable identifier, only by a tag
-func (q *Quayd) LoadImageTags(commitID, tag, repo, ref string) error {
+func (q *Quayd) LoadImageTags(ctx context.Context, commitID, tag, repo, ref string) error {
+	_, err := q.loadImageTags(ctx, commitID, tag, repo, ref)
+	return err
+}
+
+// ResolveTag resolves a tag to an image id, bounded by the TagResolver
+// timeout.
+func (q *Quayd) ResolveTag(ctx context.Context, repo, tag string) (string, error) {
+	ctx, cancel := withTimeout(ctx, q.timeouts().TagResolver)
+	defer cancel()
+	return q.tagResolver().Resolve(ctx, repo, tag)
+}
+
+// loadImageTags is LoadImageTags, returning the id of the tagged image.
+func (q *Quayd) loadImageTags(ctx context.Context, commitID, tag, repo, ref string) (string, error) {
 	// sha, err := q.commitResolver().Resolve(repo, ref)
 	// if err != nil {
 	// 	return err
 	// }
 
+	l := q.logger().With("repo", repo, "commit", commitID)
+
 	// Something that resolves the `tag` into an image id.
-	imageID, err := q.tagResolver().Resolve(repo, tag)
+	timeouts := q.timeouts()
+
+	start := time.Now()
+	imageID, err := q.ResolveTag(ctx, repo, tag)
 	if err != nil {
-		return err
+		l.Error("tag resolution failed", "tag", tag, "duration", time.Since(start), "error", err)
+		return "", err
 	}
-
-	if err := q.tagger().Tag(repo, imageID, commitID); err != nil {
-		return err
+	l = l.With("image_id", imageID)
+	l.Debug("resolved tag", "tag", tag, "duration", time.Since(start))
+
+	for _, t := range []string{commitID, imageID} {
+		start = time.Now()
+		tctx, cancel := withTimeout(ctx, timeouts.Tagger)
+		err := q.tagger().Tag(tctx, repo, imageID, t)
+		cancel()
+		if err != nil {
+			l.Error("tagging image failed", "tag", t, "duration", time.Since(start), "error", err)
+			return "", err
+		}
+		l.Info("tagged image", "tag", t, "duration", time.Since(start))
 	}
-	return q.tagger().Tag(repo, imageID, imageID)
 
+	q.CloudEvents.Emit(EventTagsApplied, &CloudEventData{
+		Repository: repo,
+		Commit:     commitID,
+		Tags:       []string{commitID, imageID},
+		Digest:     imageID,
+	})
+	return imageID, nil
+}
+
+// WithLogger returns a shallow copy of q that logs to l. It's used to scope
+// log lines to a single request.
+func (q *Quayd) WithLogger(l *Logger) *Quayd {
+	c := *q
+	c.Logger = l
+	return &c
 }
 
 func (q *Quayd) commitResolver() CommitResolver {
@@ -315,6 +803,29 @@ func (q *Quayd) tagger() Tagger {
 	return q.Tagger
 }
 
+func (q *Quayd) timeouts() Timeouts {
+	if q.Timeouts == nil {
+		return DefaultTimeouts
+	}
+
+	return *q.Timeouts
+}
+
+func (q *Quayd) logger() *Logger {
+	if q.Logger == nil {
+		return DefaultLogger
+	}
+
+	return q.Logger
+}
+
+func (q *Quayd) registry() string {
+	if q.Registry == "" {
+		return DefaultRegistryHost
+	}
+	return q.Registry
+}
+
 func (q *Quayd) tagResolver() TagResolver {
 	if q.TagResolver == nil {
 		q.TagResolver = DefaultTagResolver
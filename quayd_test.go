@@ -1,6 +1,9 @@
 package quayd
 
 import (
+	"bytes"
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/ejholmes/go-github/github"
@@ -11,11 +14,11 @@ func testGitHubStatusesRepository(t *testing.T) {
 	repo := "ejholmes/docker-statsd"
 
 	g := github.NewClient(nil)
-	r := &GitHubStatusesRepository{RepositoriesService: g.Repositories}
+	r := &GitHubStatusesRepository{Client: g}
 
 	s := &Status{Repo: repo, Ref: "6607c19", State: "pending", Context: "test"}
 
-	if err := r.Create(s); err != nil {
+	if err := r.Create(context.Background(), s); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -33,9 +36,9 @@ func TestGitHubCommitResolver(t *testing.T) {
 
 	for _, tt := range tests {
 		g := github.NewClient(nil)
-		r := &GitHubCommitResolver{RepositoriesService: g.Repositories}
+		r := &GitHubCommitResolver{Client: g}
 
-		sha, err := r.Resolve(repo, tt.in)
+		sha, err := r.Resolve(context.Background(), repo, tt.in)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -45,3 +48,66 @@ func TestGitHubCommitResolver(t *testing.T) {
 		}
 	}
 }
+
+func TestGitHub_InvalidRepository(t *testing.T) {
+	g := github.NewClient(nil)
+	ctx := context.Background()
+
+	for _, repo := range []string{"foo", "foo/", "foo/bar/baz"} {
+		if err := (&GitHubStatusesRepository{Client: g}).Create(ctx, &Status{Repo: repo, Ref: "6607c19"}); err == nil {
+			t.Fatalf("Create(%s) => nil; want an error", repo)
+		}
+		if _, err := (&GitHubCommitResolver{Client: g}).Resolve(ctx, repo, "6607c19"); err == nil {
+			t.Fatalf("Resolve(%s) => nil; want an error", repo)
+		}
+	}
+}
+
+func TestParseRegistryAuth(t *testing.T) {
+	tests := []struct {
+		in       string
+		username string
+		password string
+		err      error
+	}{
+		{"user:pass", "user", "pass", nil},
+		{"user:pa:ss", "user", "pa:ss", nil},
+		{"", "", "", nil},
+		{"user", "user", "", ErrInvalidRegistryAuth},
+		{":pass", "", "", ErrInvalidRegistryAuth},
+	}
+
+	for _, tt := range tests {
+		username, password, err := ParseRegistryAuth(tt.in)
+		if err != tt.err {
+			t.Fatalf("ParseRegistryAuth(%q) err => %v; want %v", tt.in, err, tt.err)
+		}
+		if err != nil {
+			continue
+		}
+		if username != tt.username || password != tt.password {
+			t.Fatalf("ParseRegistryAuth(%q) => %s, %s; want %s, %s", tt.in, username, password, tt.username, tt.password)
+		}
+	}
+}
+
+func TestNew_InvalidRegistryAuth(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(l *Logger) { DefaultLogger = l }(DefaultLogger)
+	DefaultLogger = NewLogger(&buf, FormatLogfmt, LevelInfo)
+
+	// Malformed credentials used to panic.
+	q := New("1234", "user")
+
+	if !strings.Contains(buf.String(), ErrInvalidRegistryAuth.Error()) {
+		t.Fatalf("Log => %q; want the invalid registry auth to be reported", buf.String())
+	}
+
+	creds := q.Tagger.(*InstrumentedTagger).Tagger.(*DockerRegistryTagger).credentials
+	if got, want := creds.GitHubToken(), "1234"; got != want {
+		t.Fatalf("GitHubToken => %q; want %q", got, want)
+	}
+	if username, password := creds.Registry(); username != "" || password != "" {
+		t.Fatalf("Registry => %q, %q; want no credentials", username, password)
+	}
+}
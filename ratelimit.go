@@ -0,0 +1,272 @@
+package quayd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ejholmes/go-github/github"
+)
+
+// Defaults for a GitHubBudget.
+const (
+	DefaultRateLimitReserve = 100
+	DefaultStatusQueueSize  = 1000
+)
+
+// ErrRateLimited is returned instead of making a GitHub request when the rate
+// limit is exhausted.
+var ErrRateLimited = errors.New("github rate limit exhausted")
+
+// GitHubBudget tracks the rate limit of a GitHub host, as reported on every
+// response. Once fewer than Reserve requests remain, non-critical calls, such
+// as readiness checks, are skipped and commit status writes are queued until
+// the limit resets.
+type GitHubBudget struct {
+	// Host labels the budget's metrics.
+	Host string
+
+	// Reserve is the number of remaining requests below which the budget
+	// is low. Defaults to DefaultRateLimitReserve.
+	Reserve int
+
+	// QueueSize is the most status writes to queue. Defaults to
+	// DefaultStatusQueueSize.
+	QueueSize int
+
+	// Logger logs queued status writes that failed. Defaults to
+	// DefaultLogger.
+	Logger *Logger
+
+	mu    sync.Mutex
+	rate  github.Rate
+	known bool
+	queue []*queuedStatus
+	timer *time.Timer
+
+	// now returns the current time. It's replaced in tests.
+	now func() time.Time
+}
+
+// queuedStatus is a status write waiting for the rate limit to reset.
+type queuedStatus struct {
+	status *Status
+	write  func(context.Context, *Status) error
+}
+
+// RateLimitSnapshot is the state of a GitHubBudget.
+type RateLimitSnapshot struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	Low       bool      `json:"low"`
+	Queued    int       `json:"queued_statuses"`
+}
+
+// Update records the rate limit from a GitHub response. It's safe to call
+// with a nil budget or response.
+func (b *GitHubBudget) Update(resp *github.Response) {
+	if b == nil || resp == nil || resp.Header.Get("X-RateLimit-Limit") == "" {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rate, b.known = resp.Rate, true
+
+	githubRateLimit.Set(float64(b.rate.Limit), b.Host, "limit")
+	githubRateLimit.Set(float64(b.rate.Remaining), b.Host, "remaining")
+	githubRateLimit.Set(float64(b.rate.Reset.Unix()), b.Host, "reset")
+}
+
+// Low returns true if fewer than Reserve requests remain before the limit
+// resets.
+func (b *GitHubBudget) Low() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.below(b.reserve())
+}
+
+// Exhausted returns true if no requests remain before the limit resets.
+func (b *GitHubBudget) Exhausted() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.below(1)
+}
+
+// below returns true if fewer than n requests remain and the limit hasn't
+// reset yet. b.mu must be held.
+func (b *GitHubBudget) below(n int) bool {
+	return b.known && b.rate.Remaining < n && b.clock().Before(b.rate.Reset.Time)
+}
+
+// Snapshot returns the budget's current state.
+func (b *GitHubBudget) Snapshot() RateLimitSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return RateLimitSnapshot{
+		Limit:     b.rate.Limit,
+		Remaining: b.rate.Remaining,
+		Reset:     b.rate.Reset.Time,
+		Low:       b.below(b.reserve()),
+		Queued:    len(b.queue),
+	}
+}
+
+// enqueue queues a status write until the limit resets. A queued write for
+// the same commit and context is replaced, since only the latest state
+// matters.
+func (b *GitHubBudget) enqueue(status *Status, write func(context.Context, *Status) error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q := &queuedStatus{status: status, write: write}
+	replaced := false
+	for i, qs := range b.queue {
+		if sameCommitStatus(qs.status, status) {
+			b.queue[i], replaced = q, true
+		}
+	}
+	if !replaced {
+		size := b.QueueSize
+		if size == 0 {
+			size = DefaultStatusQueueSize
+		}
+		if len(b.queue) >= size {
+			return ErrRateLimited
+		}
+		b.queue = append(b.queue, q)
+	}
+	githubStatusesQueued.Set(float64(len(b.queue)), b.Host)
+
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.untilReset(), b.flush)
+	}
+	return nil
+}
+
+// flush writes the queued statuses, stopping to wait for the next reset if the
+// budget runs low again.
+func (b *GitHubBudget) flush() {
+	for {
+		b.mu.Lock()
+		if len(b.queue) == 0 {
+			b.timer = nil
+			b.mu.Unlock()
+			return
+		}
+		if b.below(b.reserve()) {
+			b.timer = time.AfterFunc(b.untilReset(), b.flush)
+			b.mu.Unlock()
+			return
+		}
+		q := b.queue[0]
+		b.queue = b.queue[1:]
+		githubStatusesQueued.Set(float64(len(b.queue)), b.Host)
+		b.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+		err := q.write(ctx, q.status)
+		cancel()
+		if err == ErrRateLimited || isRateLimited(err) {
+			// The limit ran out again, so the write waits for the
+			// next reset.
+			b.mu.Lock()
+			b.requeue(q)
+			b.timer = time.AfterFunc(b.untilReset(), b.flush)
+			b.mu.Unlock()
+			return
+		}
+		if err != nil {
+			b.logger().Error("writing queued commit status failed", "repo", q.status.Repo, "commit", q.status.Ref, "state", q.status.State, "error", err)
+		}
+	}
+}
+
+// requeue puts a status write back at the front of the queue, unless a newer
+// state for the same commit and context was queued while it was being
+// written. b.mu must be held.
+func (b *GitHubBudget) requeue(q *queuedStatus) {
+	for _, qs := range b.queue {
+		if sameCommitStatus(qs.status, q.status) {
+			return
+		}
+	}
+	b.queue = append([]*queuedStatus{q}, b.queue...)
+	githubStatusesQueued.Set(float64(len(b.queue)), b.Host)
+}
+
+// sameCommitStatus returns true if a and b are states of the same commit
+// status.
+func sameCommitStatus(a, b *Status) bool {
+	return a.Repo == b.Repo && a.Ref == b.Ref && a.Context == b.Context
+}
+
+// untilReset returns how long until the limit resets, plus a second for
+// clock skew. b.mu must be held.
+func (b *GitHubBudget) untilReset() time.Duration {
+	d := b.rate.Reset.Sub(b.clock())
+	if d < 0 {
+		d = 0
+	}
+	return d + time.Second
+}
+
+func (b *GitHubBudget) logger() *Logger {
+	if b.Logger == nil {
+		return DefaultLogger
+	}
+	return b.Logger
+}
+
+func (b *GitHubBudget) reserve() int {
+	if b.Reserve == 0 {
+		return DefaultRateLimitReserve
+	}
+	return b.Reserve
+}
+
+func (b *GitHubBudget) clock() time.Time {
+	if b.now == nil {
+		return time.Now()
+	}
+	return b.now()
+}
+
+// BudgetedStatusesRepository is a StatusesRepository that queues status writes
+// while Budget is low, or when GitHub rejects them for exceeding the rate
+// limit, and writes them once the limit resets.
+type BudgetedStatusesRepository struct {
+	StatusesRepository
+	Budget *GitHubBudget
+}
+
+// Create implements StatusesRepository Create. A queued status write returns
+// nil.
+func (r *BudgetedStatusesRepository) Create(ctx context.Context, status *Status) error {
+	if r.Budget.Low() {
+		return r.Budget.enqueue(status, r.StatusesRepository.Create)
+	}
+
+	err := r.StatusesRepository.Create(ctx, status)
+	if isRateLimited(err) {
+		return r.Budget.enqueue(status, r.StatusesRepository.Create)
+	}
+	return err
+}
+
+// isRateLimited returns true if err is GitHub rejecting a request because the
+// rate limit is exhausted.
+func isRateLimited(err error) bool {
+	r, ok := err.(*github.ErrorResponse)
+	return ok && r.Response.StatusCode == http.StatusForbidden &&
+		r.Response.Header.Get("X-RateLimit-Remaining") == "0"
+}
@@ -0,0 +1,156 @@
+package quayd
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ejholmes/go-github/github"
+)
+
+func rateResponse(remaining int, reset time.Time) *github.Response {
+	h := http.Header{}
+	h.Set("X-RateLimit-Limit", "5000")
+	return &github.Response{
+		Response: &http.Response{Header: h},
+		Rate:     github.Rate{Limit: 5000, Remaining: remaining, Reset: github.Timestamp{Time: reset}},
+	}
+}
+
+func TestGitHubBudget(t *testing.T) {
+	now := time.Now()
+	b := &GitHubBudget{Reserve: 10, now: func() time.Time { return now }}
+
+	tests := []struct {
+		remaining      int
+		reset          time.Time
+		low, exhausted bool
+	}{
+		{4999, now.Add(time.Hour), false, false},
+		{10, now.Add(time.Hour), false, false},
+		{9, now.Add(time.Hour), true, false},
+		{0, now.Add(time.Hour), true, true},
+
+		// Once the reset time passes, the budget is restored.
+		{0, now.Add(-time.Second), false, false},
+	}
+
+	for _, tt := range tests {
+		b.Update(rateResponse(tt.remaining, tt.reset))
+		if got, want := b.Low(), tt.low; got != want {
+			t.Fatalf("Low with %d remaining => %v; want %v", tt.remaining, got, want)
+		}
+		if got, want := b.Exhausted(), tt.exhausted; got != want {
+			t.Fatalf("Exhausted with %d remaining => %v; want %v", tt.remaining, got, want)
+		}
+	}
+
+	// Without a response, nothing is known about the limit.
+	if (&GitHubBudget{}).Low() {
+		t.Fatal("Expected a new budget not to be low")
+	}
+}
+
+// recordingStatusesRepository records the statuses created through it.
+type recordingStatusesRepository struct {
+	sync.Mutex
+	created []string
+}
+
+func (r *recordingStatusesRepository) Create(ctx context.Context, status *Status) error {
+	r.Lock()
+	defer r.Unlock()
+	r.created = append(r.created, status.Ref+":"+status.State)
+	return nil
+}
+
+func TestBudgetedStatusesRepository(t *testing.T) {
+	b := &GitHubBudget{Host: "api.github.com", Reserve: 10}
+	r := new(recordingStatusesRepository)
+	br := &BudgetedStatusesRepository{r, b}
+	ctx := context.Background()
+
+	br.Create(ctx, &Status{Repo: "remind101/r101-api", Ref: "a", State: "pending"})
+
+	b.Update(rateResponse(5, time.Now().Add(time.Hour)))
+	br.Create(ctx, &Status{Repo: "remind101/r101-api", Ref: "b", State: "pending"})
+	br.Create(ctx, &Status{Repo: "remind101/r101-api", Ref: "c", State: "pending"})
+	br.Create(ctx, &Status{Repo: "remind101/r101-api", Ref: "b", State: "success"})
+
+	if got, want := len(r.created), 1; got != want {
+		t.Fatalf("Created %d statuses while low; want %d", got, want)
+	}
+	if got, want := b.Snapshot().Queued, 2; got != want {
+		t.Fatalf("Queued => %d; want %d", got, want)
+	}
+
+	// The limit resets.
+	b.mu.Lock()
+	b.timer.Stop()
+	b.mu.Unlock()
+	b.Update(rateResponse(5000, time.Now().Add(time.Hour)))
+	b.flush()
+
+	want := []string{"a:pending", "b:success", "c:pending"}
+	if len(r.created) != len(want) {
+		t.Fatalf("Created => %v; want %v", r.created, want)
+	}
+	for i := range want {
+		if r.created[i] != want[i] {
+			t.Fatalf("Created => %v; want %v", r.created, want)
+		}
+	}
+	if got, want := b.Snapshot().Queued, 0; got != want {
+		t.Fatalf("Queued => %d; want %d", got, want)
+	}
+}
+
+func TestGitHubBudget_Requeue(t *testing.T) {
+	b := &GitHubBudget{Host: "api.github.com", Reserve: 10}
+	b.Update(rateResponse(5, time.Now().Add(time.Hour)))
+
+	var writes int
+	write := func(ctx context.Context, status *Status) error {
+		writes++
+		if writes == 1 {
+			return ErrRateLimited
+		}
+		return nil
+	}
+	b.enqueue(&Status{Repo: "remind101/r101-api", Ref: "a", State: "pending"}, write)
+
+	// The limit resets, but runs out again before the write.
+	b.mu.Lock()
+	b.timer.Stop()
+	b.mu.Unlock()
+	b.Update(rateResponse(5000, time.Now().Add(time.Hour)))
+	b.flush()
+
+	if got, want := b.Snapshot().Queued, 1; got != want {
+		t.Fatalf("Queued => %d; want %d", got, want)
+	}
+
+	b.mu.Lock()
+	b.timer.Stop()
+	b.mu.Unlock()
+	b.flush()
+
+	if got, want := writes, 2; got != want {
+		t.Fatalf("Writes => %d; want %d", got, want)
+	}
+	if got, want := b.Snapshot().Queued, 0; got != want {
+		t.Fatalf("Queued => %d; want %d", got, want)
+	}
+}
+
+func TestGitHubCommitResolver_RateLimited(t *testing.T) {
+	b := new(GitHubBudget)
+	b.Update(rateResponse(0, time.Now().Add(time.Hour)))
+
+	cr := &GitHubCommitResolver{Client: github.NewClient(nil), Budget: b}
+	if _, err := cr.Resolve(context.Background(), "remind101/r101-api", "abcd"); err != ErrRateLimited {
+		t.Fatalf("Err => %v; want %v", err, ErrRateLimited)
+	}
+}
@@ -0,0 +1,302 @@
+package quayd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Defaults for a Reaper.
+const (
+	DefaultPendingTimeout = time.Hour
+	DefaultReapInterval   = time.Minute
+	DefaultReaperSize     = 1000
+)
+
+// Descriptions of the error statuses created by a Reaper. GitHub limits
+// descriptions to 140 characters.
+const (
+	reapedDescription         = "quayd never heard back from Quay about this build"
+	reapedFinishedDescription = "Quay finished this build, but never told quayd"
+)
+
+// BuildStatuses represents something that can look up the status of a build
+// in Quay.
+type BuildStatuses interface {
+	// BuildStatus returns the build's status: pending, success or
+	// failure.
+	BuildStatus(ctx context.Context, repo, id string) (string, error)
+}
+
+// buildStatuses is a fake implementation of the BuildStatuses interface,
+// mapping build ids to statuses.
+type buildStatuses map[string]string
+
+func (s buildStatuses) BuildStatus(ctx context.Context, repo, id string) (string, error) {
+	if status, ok := s[id]; ok {
+		return status, nil
+	}
+	return "", fmt.Errorf("build %s not found", id)
+}
+
+// Reaper is a BuildHook that tracks the builds whose commits have a pending
+// status. If a build is still pending after Timeout, because Quay's success or
+// failure webhook never arrived, the Reaper asks Quay about the build and,
+// unless Quay says it's still running, sets the commit's status to error, so
+// that it doesn't block branch protection forever. The status isn't set to
+// the build's result, since the image was never tagged with its commit.
+type Reaper struct {
+	Statuses StatusesRepository
+
+	// Commits resolve short shas. It's only needed if Quay didn't send
+	// the full sha.
+	Commits CommitResolver
+
+	// Builds, if set, is asked whether a stale build is still running.
+	// Otherwise, stale builds are always reaped.
+	Builds BuildStatuses
+
+	// Timeout is how long a build can be pending before it's checked.
+	// Defaults to DefaultPendingTimeout.
+	Timeout time.Duration
+
+	// Interval is how often Run checks for stale builds. Defaults to
+	// DefaultReapInterval.
+	Interval time.Duration
+
+	// Size is the most pending builds to track. Defaults to
+	// DefaultReaperSize.
+	Size int
+
+	// Logger defaults to DefaultLogger.
+	Logger *Logger
+
+	mu      sync.Mutex
+	pending map[string]*pendingBuild
+	order   []string
+
+	// now returns the current time. It's replaced in tests.
+	now func() time.Time
+}
+
+// pendingBuild is a build with an open pending status.
+type pendingBuild struct {
+	build *Build
+	since time.Time
+
+	// checkAt is when the build is next checked.
+	checkAt time.Time
+}
+
+// BuildEvent implements BuildHook BuildEvent.
+func (r *Reaper) BuildEvent(ctx context.Context, b *Build) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b.Status != "pending" {
+		r.forget(b.ID)
+		return nil
+	}
+	if _, ok := r.pending[b.ID]; ok {
+		return nil
+	}
+
+	if r.pending == nil {
+		r.pending = make(map[string]*pendingBuild)
+	}
+	now := r.clock()
+	r.pending[b.ID] = &pendingBuild{build: b, since: now, checkAt: now.Add(r.timeout())}
+	r.order = append(r.order, b.ID)
+
+	size := r.Size
+	if size == 0 {
+		size = DefaultReaperSize
+	}
+	for len(r.order) > size {
+		delete(r.pending, r.order[0])
+		r.order = r.order[1:]
+	}
+	return nil
+}
+
+// Run reaps stale builds every Interval until ctx is done.
+func (r *Reaper) Run(ctx context.Context) {
+	interval := r.Interval
+	if interval == 0 {
+		interval = DefaultReapInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			r.Reap(ctx)
+		}
+	}
+}
+
+// Reap checks every build that has been pending for longer than Timeout, and
+// returns the builds whose status was flipped. Builds that Quay says
+// are still running are checked again after another Timeout.
+func (r *Reaper) Reap(ctx context.Context) []*Build {
+	var reaped []*Build
+	for _, p := range r.stale() {
+		bctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+		ok := r.reap(bctx, p)
+		cancel()
+		if ok {
+			reaped = append(reaped, p.build)
+		}
+	}
+	return reaped
+}
+
+// reap checks a stale build, and flips its status unless it's still running.
+// It returns true if the status was flipped.
+func (r *Reaper) reap(ctx context.Context, p *pendingBuild) bool {
+	b := p.build
+	l := r.logger().With("build_id", b.ID, "repo", b.Repository, "commit", b.Commit)
+
+	description := reapedDescription
+	if r.Builds != nil {
+		status, err := r.Builds.BuildStatus(ctx, b.Repository, b.ID)
+		if err != nil {
+			// Try again on the next pass, rather than guess.
+			reapedBuildsTotal.Inc("check_failed")
+			l.Error("checking stale build failed", "error", err)
+			return false
+		}
+		if status == "pending" {
+			reapedBuildsTotal.Inc("still_running")
+			l.Info("stale build is still running")
+			r.recheck(b.ID)
+			return false
+		}
+		description = reapedFinishedDescription
+	}
+
+	// The build's webhook may have arrived while Quay was asked about it.
+	if !r.tracked(b.ID) {
+		return false
+	}
+
+	if err := r.flip(ctx, b, "error", description); err != nil {
+		reapedBuildsTotal.Inc("error")
+		l.Error("reaping stale build failed", "error", err)
+		return false
+	}
+	reapedBuildsTotal.Inc("reaped")
+	l.Warn("reaped stale pending build", "pending_for", r.clock().Sub(p.since))
+
+	r.mu.Lock()
+	r.forget(b.ID)
+	r.mu.Unlock()
+	return true
+}
+
+// stale returns the builds that are due to be checked.
+func (r *Reaper) stale() []*pendingBuild {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock()
+	var stale []*pendingBuild
+	for _, id := range r.order {
+		if p := r.pending[id]; !now.Before(p.checkAt) {
+			stale = append(stale, p)
+		}
+	}
+	return stale
+}
+
+func (r *Reaper) tracked(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.pending[id]
+	return ok
+}
+
+// recheck checks the build again after another Timeout.
+func (r *Reaper) recheck(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.pending[id]; ok {
+		p.checkAt = r.clock().Add(r.timeout())
+	}
+}
+
+// flip sets the build's commit status to state, linking to the build.
+func (r *Reaper) flip(ctx context.Context, b *Build, state, description string) error {
+	sha := b.Commit
+	if !IsFullSHA(sha) {
+		var err error
+		if sha, err = r.Commits.Resolve(ctx, b.Repository, sha); err != nil {
+			return err
+		}
+	}
+
+	return r.Statuses.Create(ctx, &Status{
+		Repo:        b.Repository,
+		Ref:         sha,
+		State:       state,
+		Description: description,
+		TargetURL:   b.URL,
+		Context:     Context,
+	})
+}
+
+// Forget stops tracking a build, e.g. because Quay reported that it finished.
+func (r *Reaper) Forget(id string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.forget(id)
+}
+
+// forget stops tracking a build. r.mu must be held.
+func (r *Reaper) forget(id string) {
+	if _, ok := r.pending[id]; !ok {
+		return
+	}
+	delete(r.pending, id)
+	for i, o := range r.order {
+		if o == id {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Pending returns the number of builds being tracked.
+func (r *Reaper) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending)
+}
+
+func (r *Reaper) timeout() time.Duration {
+	if r.Timeout == 0 {
+		return DefaultPendingTimeout
+	}
+	return r.Timeout
+}
+
+func (r *Reaper) logger() *Logger {
+	if r.Logger == nil {
+		return DefaultLogger
+	}
+	return r.Logger
+}
+
+func (r *Reaper) clock() time.Time {
+	if r.now == nil {
+		return time.Now()
+	}
+	return r.now()
+}
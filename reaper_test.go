@@ -0,0 +1,251 @@
+package quayd
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// failingStatusesRepository is a StatusesRepository that can't reach GitHub.
+type failingStatusesRepository struct{}
+
+func (failingStatusesRepository) Create(ctx context.Context, status *Status) error {
+	return errors.New("github is down")
+}
+
+// failingBuildStatuses is a BuildStatuses that can't reach Quay.
+type failingBuildStatuses struct{}
+
+func (failingBuildStatuses) BuildStatus(ctx context.Context, repo, id string) (string, error) {
+	return "", errors.New("quay is down")
+}
+
+func newTestReaper(builds BuildStatuses) (*Reaper, *statusesRepository, *time.Time) {
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	statuses := new(statusesRepository)
+	r := &Reaper{
+		Statuses: statuses,
+		Commits:  new(commitResolver),
+		Builds:   builds,
+		Timeout:  time.Hour,
+		now:      func() time.Time { return now },
+	}
+	return r, statuses, &now
+}
+
+func TestReaper(t *testing.T) {
+	r, statuses, now := newTestReaper(nil)
+	ctx := context.Background()
+
+	r.BuildEvent(ctx, &Build{ID: "1", Status: "pending", Repository: "acme/api", Commit: "6607c19d3fd492ec53439f4104b39e4c62ece179", URL: "https://quay.io/build/1"})
+	r.BuildEvent(ctx, &Build{ID: "2", Status: "pending", Repository: "acme/api", Commit: "d2c3b4a"})
+	r.BuildEvent(ctx, &Build{ID: "3", Status: "pending", Repository: "acme/api", Commit: "a1b2c3d"})
+	r.BuildEvent(ctx, &Build{ID: "3", Status: "success", Repository: "acme/api", Commit: "a1b2c3d"})
+
+	if got, want := r.Pending(), 2; got != want {
+		t.Fatalf("Pending => %d; want %d", got, want)
+	}
+
+	*now = now.Add(59 * time.Minute)
+	if got := r.Reap(ctx); len(got) != 0 {
+		t.Fatalf("Expected nothing to be reaped before the timeout, got %d", len(got))
+	}
+
+	*now = now.Add(time.Minute)
+	if got, want := len(r.Reap(ctx)), 2; got != want {
+		t.Fatalf("Reaped => %d; want %d", got, want)
+	}
+	if got, want := r.Pending(), 0; got != want {
+		t.Fatalf("Pending => %d; want %d", got, want)
+	}
+
+	if got, want := len(statuses.statuses), 2; got != want {
+		t.Fatalf("Statuses => %d; want %d", got, want)
+	}
+	s := statuses.statuses[0]
+	if got, want := s.State, "error"; got != want {
+		t.Fatalf("State => %s; want %s", got, want)
+	}
+	if got, want := s.Description, reapedDescription; got != want {
+		t.Fatalf("Description => %s; want %s", got, want)
+	}
+	if got, want := s.TargetURL, "https://quay.io/build/1"; got != want {
+		t.Fatalf("TargetURL => %s; want %s", got, want)
+	}
+	if got, want := statuses.statuses[1].Ref, "long-d2c3b4a"; got != want {
+		t.Fatalf("Ref => %s; want %s", got, want)
+	}
+}
+
+func TestReaper_StillRunning(t *testing.T) {
+	r, statuses, now := newTestReaper(buildStatuses{"1": "pending"})
+	ctx := context.Background()
+
+	r.BuildEvent(ctx, &Build{ID: "1", Status: "pending", Repository: "acme/api", Commit: "6607c19d3fd492ec53439f4104b39e4c62ece179"})
+
+	*now = now.Add(time.Hour)
+	if got := r.Reap(ctx); len(got) != 0 {
+		t.Fatalf("Expected a running build not to be reaped, got %d", len(got))
+	}
+
+	// The build isn't checked again until another timeout has passed.
+	r.Builds = buildStatuses{"1": "failure"}
+	*now = now.Add(30 * time.Minute)
+	if got := r.Reap(ctx); len(got) != 0 {
+		t.Fatalf("Expected the build not to be rechecked yet, got %d", len(got))
+	}
+
+	*now = now.Add(30 * time.Minute)
+	if got, want := len(r.Reap(ctx)), 1; got != want {
+		t.Fatalf("Reaped => %d; want %d", got, want)
+	}
+	if got, want := statuses.statuses[0].Description, reapedFinishedDescription; got != want {
+		t.Fatalf("Description => %s; want %s", got, want)
+	}
+	if got, want := statuses.statuses[0].State, "error"; got != want {
+		t.Fatalf("State => %s; want %s", got, want)
+	}
+}
+
+func TestReaper_Finished(t *testing.T) {
+	// Even a successful build is an error, since its image was never tagged
+	// with the commit.
+	tests := []struct {
+		builds      BuildStatuses
+		description string
+	}{
+		{buildStatuses{"1": "success"}, reapedFinishedDescription},
+		{buildStatuses{"1": "failure"}, reapedFinishedDescription},
+		{nil, reapedDescription},
+	}
+
+	for _, tt := range tests {
+		r, statuses, now := newTestReaper(tt.builds)
+		ctx := context.Background()
+
+		r.BuildEvent(ctx, &Build{ID: "1", Status: "pending", Repository: "acme/api", Commit: "6607c19d3fd492ec53439f4104b39e4c62ece179"})
+		*now = now.Add(time.Hour)
+		r.Reap(ctx)
+
+		if got, want := len(statuses.statuses), 1; got != want {
+			t.Fatalf("Statuses => %d; want %d", got, want)
+		}
+		if got, want := statuses.statuses[0].State, "error"; got != want {
+			t.Fatalf("State => %s; want %s", got, want)
+		}
+		if got, want := statuses.statuses[0].Description, tt.description; got != want {
+			t.Fatalf("Description => %s; want %s", got, want)
+		}
+	}
+}
+
+func TestReaper_CheckFailed(t *testing.T) {
+	r, statuses, now := newTestReaper(failingBuildStatuses{})
+	ctx := context.Background()
+
+	r.BuildEvent(ctx, &Build{ID: "1", Status: "pending", Repository: "acme/api", Commit: "6607c19d3fd492ec53439f4104b39e4c62ece179"})
+
+	*now = now.Add(time.Hour)
+	if got := r.Reap(ctx); len(got) != 0 {
+		t.Fatalf("Expected nothing to be reaped, got %d", len(got))
+	}
+	if got, want := len(statuses.statuses), 0; got != want {
+		t.Fatalf("Statuses => %d; want %d", got, want)
+	}
+	if got, want := r.Pending(), 1; got != want {
+		t.Fatalf("Pending => %d; want %d", got, want)
+	}
+}
+
+func TestWebhook_Reaper(t *testing.T) {
+	r, statuses, now := newTestReaper(nil)
+	s := NewServer(&Quayd{
+		StatusesRepository: statuses,
+		CommitResolver:     new(commitResolver),
+		Reaper:             r,
+		Hooks:              []NamedBuildHook{{"reaper", r}},
+	})
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/quay/pending", loadFixture("pending_build", t))
+	s.ServeHTTP(resp, req)
+
+	*now = now.Add(time.Hour)
+	r.Reap(context.Background())
+
+	// The commit is marked pending by the webhook, then flipped by the
+	// Reaper.
+	if got, want := len(statuses.statuses), 2; got != want {
+		t.Fatalf("Statuses => %d; want %d", got, want)
+	}
+	for i, state := range []string{"pending", "error"} {
+		st := statuses.statuses[i]
+		if got, want := st.State, state; got != want {
+			t.Fatalf("State => %s; want %s", got, want)
+		}
+		if got, want := st.Repo, "ejholmes/docker-statsd"; got != want {
+			t.Fatalf("Repo => %s; want %s", got, want)
+		}
+		if got, want := st.Ref, "long-f1fb3b0"; got != want {
+			t.Fatalf("Ref => %s; want %s", got, want)
+		}
+	}
+}
+
+func TestWebhook_ReaperTaggingFailed(t *testing.T) {
+	r, statuses, _ := newTestReaper(nil)
+	s := NewServer(&Quayd{
+		StatusesRepository: statuses,
+		TagResolver:        failingTagResolver{},
+		Reaper:             r,
+		Hooks:              []NamedBuildHook{{"reaper", r}},
+	})
+
+	for _, status := range []string{"pending", "success"} {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/quay/"+status, loadFixture("success_build", t))
+		s.ServeHTTP(resp, req)
+	}
+
+	// Quay reported the build, so it isn't reaped even though its image
+	// couldn't be tagged.
+	if got, want := r.Pending(), 0; got != want {
+		t.Fatalf("Pending => %d; want %d", got, want)
+	}
+}
+
+func TestWebhook_ReaperStatusFailed(t *testing.T) {
+	r, _, _ := newTestReaper(nil)
+	var seen *Build
+	wh := &Webhook{Quayd: &Quayd{
+		StatusesRepository: failingStatusesRepository{},
+		Reaper:             r,
+		Hooks: []NamedBuildHook{
+			{"reaper", r},
+			{"seen", BuildHookFunc(func(ctx context.Context, b *Build) error {
+				seen = b
+				return nil
+			})},
+		},
+	}}
+
+	body, _ := ioutil.ReadAll(loadFixture("success_build", t))
+	ev := wh.Receive(context.Background(), "pending", body)
+
+	if got, want := ev.Outcome, OutcomeError; got != want {
+		t.Fatalf("Outcome => %s; want %s", got, want)
+	}
+
+	// The hooks still see the build, so that the commit is reaped once
+	// its status can be written.
+	if got, want := r.Pending(), 1; got != want {
+		t.Fatalf("Pending => %d; want %d", got, want)
+	}
+	if seen == nil || seen.StatusError == "" {
+		t.Fatalf("Build => %+v; want a status error", seen)
+	}
+}
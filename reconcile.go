@@ -0,0 +1,184 @@
+package quayd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Defaults for a Reconciler.
+const (
+	DefaultReconcileInterval = 15 * time.Minute
+	DefaultReconcileBuilds   = 20
+)
+
+// ReconcileReport describes a pass of a Reconciler.
+type ReconcileReport struct {
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration_ns"`
+
+	// Repositories is the number of repositories walked.
+	Repositories int `json:"repositories"`
+
+	// Checked is the number of commits whose tag was checked.
+	Checked int `json:"checked"`
+
+	// Fixed are the commits whose missing tag was applied again.
+	Fixed []*ReconciledTag `json:"fixed"`
+
+	// Failed are the commits that couldn't be checked or tagged, and
+	// repositories whose builds couldn't be listed.
+	Failed []*ReconciledTag `json:"failed"`
+}
+
+// ReconciledTag is a commit tag that a Reconciler fixed, or failed to.
+type ReconciledTag struct {
+	Repository string `json:"repository"`
+	Commit     string `json:"commit,omitempty"`
+	BuildID    string `json:"build_id,omitempty"`
+
+	// Tag is the build's tag that the commit tag was copied from.
+	Tag   string `json:"tag,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Reconciler finds successful builds whose image is missing its commit sha
+// tag, e.g. because tagging failed or quayd was down when Quay's webhook was
+// sent, and tags them again. The recent builds of each repository are listed
+// from the Quayd's Quay API.
+type Reconciler struct {
+	*Quayd
+
+	// Repositories are the repositories to reconcile.
+	Repositories []string
+
+	// Builds is the number of recent builds of each repository to check.
+	// Defaults to DefaultReconcileBuilds.
+	Builds int
+
+	// Interval is how often Run reconciles. Defaults to
+	// DefaultReconcileInterval.
+	Interval time.Duration
+
+	mu   sync.Mutex
+	last *ReconcileReport
+}
+
+// Run reconciles once, and then every Interval until ctx is done.
+func (r *Reconciler) Run(ctx context.Context) {
+	interval := r.Interval
+	if interval == 0 {
+		interval = DefaultReconcileInterval
+	}
+
+	r.Reconcile(ctx)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			r.Reconcile(ctx)
+		}
+	}
+}
+
+// Reconcile walks the recent successful builds of each repository, and tags
+// the image of any whose commit tag is missing. Manually started builds are
+// skipped, as they are by the webhook.
+func (r *Reconciler) Reconcile(ctx context.Context) *ReconcileReport {
+	report := &ReconcileReport{
+		StartedAt:    time.Now().UTC(),
+		Repositories: len(r.Repositories),
+		Fixed:        []*ReconciledTag{},
+		Failed:       []*ReconciledTag{},
+	}
+
+	for _, repo := range r.Repositories {
+		r.reconcile(ctx, repo, report)
+	}
+	report.Duration = time.Since(report.StartedAt)
+
+	r.logger().Info("reconciled commit tags",
+		"repositories", report.Repositories,
+		"checked", report.Checked,
+		"fixed", len(report.Fixed),
+		"failed", len(report.Failed),
+		"duration", report.Duration,
+	)
+
+	r.mu.Lock()
+	r.last = report
+	r.mu.Unlock()
+	return report
+}
+
+// reconcile checks the recent builds of a repository, adding to report.
+func (r *Reconciler) reconcile(ctx context.Context, repo string, report *ReconcileReport) {
+	l := r.logger().With("repo", repo)
+
+	size := r.Builds
+	if size == 0 {
+		size = DefaultReconcileBuilds
+	}
+	builds, err := r.Quay.ListBuilds(ctx, repo, size)
+	if err != nil {
+		reconciledTagsTotal.Inc("error")
+		l.Error("listing builds failed", "error", err)
+		report.Failed = append(report.Failed, &ReconciledTag{Repository: repo, Error: err.Error()})
+		return
+	}
+
+	// Builds are newest first, so each commit is checked against its most
+	// recent successful build.
+	seen := make(map[string]bool)
+	for _, b := range builds {
+		commit := b.Commit()
+		if b.Status() != "success" || b.ManualUser != "" || !IsFullSHA(commit) || len(b.Tags) == 0 || seen[commit] {
+			continue
+		}
+		seen[commit] = true
+		report.Checked++
+
+		t := &ReconciledTag{Repository: repo, Commit: commit, BuildID: b.ID, Tag: b.Tags[0]}
+		fixed, err := r.check(ctx, t)
+		switch {
+		case err != nil:
+			reconciledTagsTotal.Inc("error")
+			l.Error("reconciling commit tag failed", "commit", commit, "build_id", b.ID, "error", err)
+			t.Error = err.Error()
+			report.Failed = append(report.Failed, t)
+		case fixed:
+			reconciledTagsTotal.Inc("fixed")
+			l.Warn("applied missing commit tag", "commit", commit, "build_id", b.ID, "tag", t.Tag)
+			report.Fixed = append(report.Fixed, t)
+		default:
+			reconciledTagsTotal.Inc("ok")
+		}
+	}
+}
+
+// check tags the image of t's build with its commit, if it's missing. It
+// returns true if the tag was missing.
+func (r *Reconciler) check(ctx context.Context, t *ReconciledTag) (bool, error) {
+	_, err := r.ResolveTag(ctx, t.Repository, t.Commit)
+	if err == nil {
+		return false, nil
+	}
+	if err != ErrTagNotFound {
+		return false, err
+	}
+	return true, r.LoadImageTags(ctx, t.Commit, t.Tag, t.Repository, "")
+}
+
+// Last returns the report of the most recent pass, or nil if there hasn't
+// been one. It's nil safe.
+func (r *Reconciler) Last() *ReconcileReport {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
@@ -0,0 +1,140 @@
+package quayd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// registryTags is a Tagger and TagResolver backed by a map of repo:tag to
+// image id.
+type registryTags struct {
+	sync.Mutex
+	tags map[string]string
+}
+
+func (r *registryTags) Resolve(ctx context.Context, repo, tag string) (string, error) {
+	r.Lock()
+	defer r.Unlock()
+	imageID, ok := r.tags[repo+":"+tag]
+	if !ok {
+		return "", ErrTagNotFound
+	}
+	return imageID, nil
+}
+
+func (r *registryTags) Tag(ctx context.Context, repo, imageID, tag string) error {
+	r.Lock()
+	defer r.Unlock()
+	r.tags[repo+":"+tag] = imageID
+	return nil
+}
+
+// failingQuayAPI is a QuayAPI that can't reach Quay.
+type failingQuayAPI struct {
+	*quayAPI
+}
+
+func (failingQuayAPI) ListBuilds(ctx context.Context, repo string, limit int) ([]*QuayBuild, error) {
+	return nil, errors.New("quay is down")
+}
+
+func newTestReconciler() (*Reconciler, *registryTags) {
+	const (
+		tagged   = "6607c19d3fd492ec53439f4104b39e4c62ece179"
+		untagged = "f1fb3b0c5c0fbd31f8d0b6d4bd1c0f8c3ce4a0b2"
+		manual   = "a1b2c3d4e5f60718293a4b5c6d7e8f9012345678"
+	)
+	commit := func(sha string) map[string]interface{} {
+		return map[string]interface{}{"commit": sha}
+	}
+
+	quay := &quayAPI{builds: map[string][]*QuayBuild{
+		"acme/api": {
+			{ID: "b5", Phase: "building", Tags: []string{"master"}, TriggerMetadata: commit(untagged)},
+			{ID: "b4", Phase: "complete", Tags: []string{"master"}, TriggerMetadata: commit(untagged)},
+			{ID: "b3", Phase: "complete", Tags: []string{"master"}, TriggerMetadata: commit(tagged)},
+			{ID: "b2", Phase: "complete", Tags: []string{"master"}, TriggerMetadata: commit(manual), ManualUser: "ejholmes"},
+			{ID: "b1", Phase: "error", Tags: []string{"master"}, TriggerMetadata: commit("0000000000000000000000000000000000000000")},
+		},
+	}}
+	registry := &registryTags{tags: map[string]string{
+		"acme/api:master":    "1234",
+		"acme/api:" + tagged: "5678",
+	}}
+
+	r := &Reconciler{
+		Quayd: &Quayd{
+			Tagger:      registry,
+			TagResolver: registry,
+			Quay:        quay,
+		},
+		Repositories: []string{"acme/api"},
+	}
+	return r, registry
+}
+
+func TestReconciler(t *testing.T) {
+	r, registry := newTestReconciler()
+
+	report := r.Reconcile(context.Background())
+
+	if got, want := report.Checked, 2; got != want {
+		t.Fatalf("Checked => %d; want %d", got, want)
+	}
+	if got, want := len(report.Failed), 0; got != want {
+		t.Fatalf("Failed => %d; want %d", got, want)
+	}
+	if got, want := len(report.Fixed), 1; got != want {
+		t.Fatalf("Fixed => %d; want %d", got, want)
+	}
+	fixed := report.Fixed[0]
+	if got, want := fixed.Commit, "f1fb3b0c5c0fbd31f8d0b6d4bd1c0f8c3ce4a0b2"; got != want {
+		t.Fatalf("Commit => %s; want %s", got, want)
+	}
+	if got, want := fixed.BuildID, "b4"; got != want {
+		t.Fatalf("BuildID => %s; want %s", got, want)
+	}
+	if got, want := registry.tags["acme/api:"+fixed.Commit], "1234"; got != want {
+		t.Fatalf("Image => %s; want %s", got, want)
+	}
+	if got, want := r.Last(), report; got != want {
+		t.Fatalf("Last => %v; want %v", got, want)
+	}
+
+	// The next pass finds nothing to fix.
+	report = r.Reconcile(context.Background())
+	if got, want := len(report.Fixed), 0; got != want {
+		t.Fatalf("Fixed => %d; want %d", got, want)
+	}
+}
+
+func TestReconciler_ListFailed(t *testing.T) {
+	r, _ := newTestReconciler()
+	r.Quay = failingQuayAPI{}
+
+	report := r.Reconcile(context.Background())
+
+	if got, want := len(report.Failed), 1; got != want {
+		t.Fatalf("Failed => %d; want %d", got, want)
+	}
+	if got, want := report.Failed[0].Error, "quay is down"; got != want {
+		t.Fatalf("Error => %s; want %s", got, want)
+	}
+}
+
+func TestReconciler_Run(t *testing.T) {
+	r, _ := newTestReconciler()
+	r.Interval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.Run(ctx)
+
+	// The first pass doesn't wait for the interval.
+	if r.Last() == nil {
+		t.Fatal("Expected a reconcile pass")
+	}
+}
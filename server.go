@@ -1,12 +1,17 @@
 package quayd
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/codegangsta/negroni"
 	"github.com/gorilla/mux"
+	"io/ioutil"
 	"net/http"
+	"time"
 )
 
 var validStatuses = []string{"pending", "success", "error", "failure"}
@@ -15,16 +20,62 @@ type Server struct {
 	http.Handler
 }
 
+// ServerOptions configures a Server built by NewServerWithOptions.
+type ServerOptions struct {
+	// AdminToken is the bearer token required by the /admin API. The
+	// admin API is disabled if it's empty.
+	AdminToken string
+
+	// APIToken, if set, is the bearer token required by the /api. Without
+	// it, the /api only looks up images by full commit sha.
+	APIToken string
+
+	// Events records received webhooks. Defaults to a new EventLog of
+	// DefaultEventLogSize.
+	Events *EventLog
+
+	// WebhookSecret, if set, must be sent by Quay as the secret query
+	// parameter of each webhook.
+	WebhookSecret string
+
+	// Credentials, if set, holds the webhook secret instead of
+	// WebhookSecret, so that it can be rotated without a restart.
+	Credentials *Credentials
+}
+
 func NewServer(q *Quayd) *Server {
+	return NewServerWithOptions(q, ServerOptions{})
+}
+
+// NewServerWithOptions returns a Server for q configured by opts.
+func NewServerWithOptions(q *Quayd, opts ServerOptions) *Server {
 	if q == nil {
 		q = Default
 	}
 
+	events := opts.Events
+	if events == nil {
+		events = NewEventLog(DefaultEventLogSize)
+	}
+	wh := &Webhook{Quayd: q, Events: events, Secret: opts.WebhookSecret, Credentials: opts.Credentials}
+
 	m := mux.NewRouter()
 
-	m.Handle("/quay/{status}", &Webhook{q}).Methods("POST")
+	m.Handle("/quay/{status}", wh).Methods("POST")
+	m.Handle("/metrics", DefaultRegistry).Methods("GET")
+	m.Handle("/healthz", Liveness{}).Methods("GET")
+	m.Handle("/readyz", &Readiness{
+		Health:  &Health{Checkers: q.Checkers},
+		Backlog: backlog,
+	}).Methods("GET")
+
+	m.PathPrefix("/api/").Handler(NewAPI(q, opts.APIToken))
 
-	n := negroni.Classic()
+	if opts.AdminToken != "" {
+		m.PathPrefix("/admin/").Handler(NewAdmin(wh, opts.AdminToken))
+	}
+
+	n := negroni.New(negroni.NewRecovery(), &requestLogger{q.logger()}, requestTracer{})
 	n.UseHandler(m)
 
 	return &Server{n}
@@ -32,61 +83,226 @@ func NewServer(q *Quayd) *Server {
 
 type Webhook struct {
 	*Quayd
+
+	// Events records every webhook that's processed.
+	Events *EventLog
+
+	// Secret, if set, is required as the secret query parameter of each
+	// webhook.
+	Secret string
+
+	// Credentials, if set, holds the secret instead of Secret.
+	Credentials *Credentials
 }
 
 type WebhookForm struct {
+	BuildID         string                 `json:"build_id"`
 	Repository      string                 `json:"repository"`
 	TriggerKind     string                 `json:"trigger_kind"`
 	IsManual        bool                   `json:"is_manual"`
 	DockerTags      []string               `json:"docker_tags"`
+	DockerURL       string                 `json:"docker_url"`
 	BuildName       string                 `json:"build_name"`
 	BuildURL        string                 `json:"homepage"`
 	TriggerMetadata map[string]interface{} `json:"trigger_metadata"`
 }
 
+// Ref returns the most specific reference to the build's commit: the full sha
+// from the trigger metadata if Quay sent one, or the build name, which is a
+// short sha.
+func (f *WebhookForm) Ref() string {
+	if commit, _ := f.TriggerMetadata["commit"].(string); IsFullSHA(commit) {
+		return commit
+	}
+	return f.BuildName
+}
+
+// Outcomes of processing a webhook.
+const (
+	OutcomeProcessed = "processed"
+	OutcomeSkipped   = "skipped"
+	OutcomeError     = "error"
+)
+
 func (wh *Webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	status := vars["status"]
-	if !validStatus(status) {
+	if !ValidStatus(status) {
+		webhooksTotal.Inc("invalid", "rejected")
 		http.Error(w, "Invalid status: "+status, 400)
 		return
 	}
+	if !wh.authorized(r) {
+		webhooksTotal.Inc(status, "rejected")
+		http.Error(w, "Invalid secret", 401)
+		return
+	}
 
-	var form WebhookForm
-
-	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
-		errorResponse(w, err)
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		errorResponse(w, wh.logger(), err)
 		return
 	}
 
-	fmt.Println(form)
+	ev := wh.Receive(r.Context(), status, payload)
+	switch ev.Outcome {
+	case OutcomeSkipped:
+		w.WriteHeader(204)
+	case OutcomeError:
+		http.Error(w, ev.Error, 500)
+	}
+}
+
+// authorized returns true if the request has the webhook secret.
+func (wh *Webhook) authorized(r *http.Request) bool {
+	want := wh.Secret
+	if wh.Credentials != nil {
+		want = wh.Credentials.WebhookSecret()
+	}
+	if want == "" {
+		return true
+	}
+	secret := r.URL.Query().Get("secret")
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(want)) == 1
+}
+
+// Receive processes a Quay webhook payload for the given build status, and
+// records it in the event log.
+func (wh *Webhook) Receive(ctx context.Context, status string, payload []byte) *Event {
+	return wh.receive(ctx, status, payload, "")
+}
+
+// Replay processes the payload of a previously recorded event again.
+func (wh *Webhook) Replay(ctx context.Context, ev *Event) *Event {
+	return wh.receive(ctx, ev.Status, ev.Payload, ev.ID)
+}
+
+func (wh *Webhook) receive(ctx context.Context, status string, payload []byte, replayOf string) *Event {
+	webhooksInFlight.Add(1)
+	defer webhooksInFlight.Add(-1)
+
+	ev := &Event{
+		ID:         newRequestID(),
+		RequestID:  RequestID(ctx),
+		ReplayOf:   replayOf,
+		Status:     status,
+		ReceivedAt: time.Now().UTC(),
+	}
+	// An invalid payload would make the event log unencodable.
+	if json.Valid(payload) {
+		ev.Payload = payload
+	}
+
+	l := wh.logger().With("request_id", ev.RequestID, "event_id", ev.ID, "status", status)
+	if replayOf != "" {
+		l = l.With("replay_of", replayOf)
+	}
+	if span := SpanFromContext(ctx); span != nil {
+		l = l.With("trace_id", span.TraceIDString())
+	}
+
+	ev.Outcome = OutcomeProcessed
+	if err := wh.process(ctx, l, ev, payload); err != nil {
+		l.Error("request failed", "error", err)
+		ev.Outcome = OutcomeError
+		ev.Error = err.Error()
+	}
+	ev.Duration = time.Since(ev.ReceivedAt)
+
+	webhooksTotal.Inc(status, ev.Outcome)
+	wh.events().Add(ev)
+	return ev
+}
+
+func (wh *Webhook) process(ctx context.Context, l *Logger, ev *Event, payload []byte) error {
+	if err := json.Unmarshal(payload, &ev.Form); err != nil {
+		return err
+	}
+	form := ev.Form
+
+	commitID, _ := form.TriggerMetadata["commit"].(string)
+	l = l.With("build_id", form.BuildID, "repo", form.Repository, "commit", commitID)
+	l.Info("received webhook", "trigger_kind", form.TriggerKind, "is_manual", form.IsManual, "build_name", form.BuildName, "docker_tags", form.DockerTags)
+
 	// We don't want to process manually triggered builds.
 	if !(!form.IsManual && form.TriggerKind == "github") {
-		w.WriteHeader(204)
-		return
+		l.Info("skipping build not triggered by github")
+		ev.Outcome = OutcomeSkipped
+		return nil
 	}
 
-	if status == "success" {
-		commitID, ok := form.TriggerMetadata["commit"].(string)
-		if !ok {
-			errorResponse(w, errors.New("Missing commit"))
-			return
+	q := wh.Quayd.WithLogger(l)
+
+	b := newBuild(ev.Status, &form)
+
+	// The build finished when Quay said so, however long tagging takes or
+	// whether it fails, so it's timed and no longer reaped from here.
+	q.Timer.Track(b)
+	if b.Slow {
+		l.Warn("slow build", "duration", b.Duration)
+	}
+	if b.Status != "pending" {
+		q.Reaper.Forget(b.ID)
+	}
+
+	if ev.Status == "success" {
+		if commitID == "" {
+			return errors.New("Missing commit")
+		}
+		if len(form.DockerTags) == 0 {
+			return errors.New("Missing docker_tags")
 		}
-		fmt.Println("Commit: ", commitID)
-		if err := wh.Quayd.LoadImageTags(commitID, form.DockerTags[0], form.Repository, form.BuildName); err != nil {
-			errorResponse(w, err)
-			return
+		imageID, err := q.loadImageTags(ctx, commitID, form.DockerTags[0], form.Repository, form.BuildName)
+		if err != nil {
+			return err
 		}
+		b.ImageID = imageID
 	}
 
-	// if err := wh.Quayd.Handle(form.Repository, form.BuildName, form.BuildURL, status); err != nil {
-	// 	errorResponse(w, err)
-	// 	return
-	// }
+	// Hooks run even if the commit status couldn't be written, so that
+	// the build is still recorded, and a pending one is reaped.
+	err := q.Handle(ctx, form.Repository, form.Ref(), form.BuildURL, ev.Status)
+	if err != nil {
+		b.StatusError = err.Error()
+	}
+	q.runHooks(ctx, b)
+	if err != nil {
+		return err
+	}
 
+	if b.Status == "success" {
+		q.CloudEvents.Emit(EventImagePromoted, &CloudEventData{
+			Repository: b.Repository,
+			Commit:     b.Commit,
+			Tags:       []string{b.Commit, b.ImageID},
+			Digest:     b.ImageID,
+			Image:      b.Image,
+			Branch:     b.Branch,
+			BuildID:    b.ID,
+			URL:        b.URL,
+		})
+	}
+
+	return nil
 }
 
-func validStatus(a string) bool {
+func (wh *Webhook) events() *EventLog {
+	if wh.Events == nil {
+		wh.Events = NewEventLog(DefaultEventLogSize)
+	}
+
+	return wh.Events
+}
+
+// backlog reports the work quayd currently has in flight.
+func backlog() map[string]int {
+	return map[string]int{
+		"in_flight_webhooks": int(webhooksInFlight.Value()),
+	}
+}
+
+// ValidStatus reports whether a is a build status quayd handles.
+func ValidStatus(a string) bool {
 	for _, b := range validStatuses {
 		if b == a {
 			return true
@@ -95,7 +311,54 @@ func validStatus(a string) bool {
 	return false
 }
 
-func errorResponse(w http.ResponseWriter, err error) {
-	fmt.Println(err)
+func errorResponse(w http.ResponseWriter, l *Logger, err error) {
+	l.Error("request failed", "error", err)
 	http.Error(w, err.Error(), 500)
 }
+
+type contextKey int
+
+const requestIDKey contextKey = iota
+
+// RequestID returns the request id stored in ctx by the server, or an empty
+// string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// requestLogger is a negroni middleware that assigns every request an id and
+// logs a line once the request completes. An incoming X-Request-Id header is
+// reused so that ids can be correlated with upstream proxies.
+type requestLogger struct {
+	*Logger
+}
+
+func (rl *requestLogger) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	id := r.Header.Get("X-Request-Id")
+	if id == "" {
+		id = newRequestID()
+	}
+	w.Header().Set("X-Request-Id", id)
+
+	start := time.Now()
+	next(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+
+	code := w.(negroni.ResponseWriter).Status()
+	if code == 0 {
+		code = http.StatusOK
+	}
+	rl.Info("request completed",
+		"request_id", id,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"http_status", code,
+		"duration", time.Since(start),
+	)
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
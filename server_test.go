@@ -2,11 +2,13 @@ package quayd
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -30,7 +32,7 @@ func TestWebhook(t *testing.T) {
 		expected Status
 	}{
 		{"pending", "pending_build", Status{Repo: "ejholmes/docker-statsd", Ref: "long-f1fb3b0", State: "pending", Context: "Docker Image", TargetURL: "https://quay.io/repository/ejholmes/docker-statsd/build?current=077f3664-35d3-48e6-9da7-889f9be73070", Description: "The Docker image is building"}},
-		{"success", "pending_build", Status{Repo: "ejholmes/docker-statsd", Ref: "long-f1fb3b0", State: "success", Context: "Docker Image", TargetURL: "https://quay.io/repository/ejholmes/docker-statsd/build?current=077f3664-35d3-48e6-9da7-889f9be73070", Description: "The Docker image was built"}},
+		{"success", "success_build", Status{Repo: "ejholmes/docker-statsd", Ref: "6607c19d3fd492ec53439f4104b39e4c62ece179", State: "success", Context: "Docker Image", TargetURL: "https://quay.io/repository/ejholmes/docker-statsd/build?current=296ec063-5f86-4706-a469-f0a400bf9df2", Description: "The Docker image was built"}},
 	}
 
 	for _, tt := range tests {
@@ -54,6 +56,8 @@ func TestWebhook(t *testing.T) {
 func TestWebhook_InvalidStatus(t *testing.T) {
 	r := DefaultStatusesRepository
 	s := NewServer(nil)
+	r.Reset()
+	defer r.Reset()
 
 	resp := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/quay/foo", loadFixture("pending_build", t))
@@ -65,9 +69,63 @@ func TestWebhook_InvalidStatus(t *testing.T) {
 	}
 }
 
+func TestWebhook_Secret(t *testing.T) {
+	s := NewServerWithOptions(nil, ServerOptions{WebhookSecret: "s3cret"})
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/quay/pending", 401},
+		{"/quay/pending?secret=guess", 401},
+		{"/quay/pending?secret=s3cret", 200},
+	}
+
+	for _, tt := range tests {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", tt.path, loadFixture("pending_build", t))
+
+		s.ServeHTTP(resp, req)
+
+		if got, want := resp.Code, tt.code; got != want {
+			t.Fatalf("%s: Code => %d; want %d", tt.path, got, want)
+		}
+	}
+}
+
+func TestWebhook_RotatedSecret(t *testing.T) {
+	creds := &Credentials{}
+	creds.UpdateWebhookSecret("old")
+	s := NewServerWithOptions(nil, ServerOptions{Credentials: creds})
+
+	tests := []struct {
+		secret string
+		path   string
+		code   int
+	}{
+		{"old", "/quay/pending?secret=old", 204},
+		{"new", "/quay/pending?secret=old", 401},
+		{"new", "/quay/pending?secret=new", 204},
+	}
+
+	for _, tt := range tests {
+		creds.UpdateWebhookSecret(tt.secret)
+
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", tt.path, loadFixture("pending_build.manual", t))
+		s.ServeHTTP(resp, req)
+
+		if got, want := resp.Code, tt.code; got != want {
+			t.Fatalf("%s with %s: Code => %d; want %d", tt.path, tt.secret, got, want)
+		}
+	}
+}
+
 func TestWebhook_ManualTrigger(t *testing.T) {
 	r := DefaultStatusesRepository
 	s := NewServer(nil)
+	r.Reset()
+	defer r.Reset()
 
 	resp := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/quay/pending", loadFixture("pending_build.manual", t))
@@ -79,6 +137,20 @@ func TestWebhook_ManualTrigger(t *testing.T) {
 	}
 }
 
+func TestWebhook_MissingDockerTags(t *testing.T) {
+	wh := &Webhook{Quayd: &Quayd{}}
+	payload := []byte(`{"build_id": "1", "repository": "acme/api", "trigger_kind": "github", "trigger_metadata": {"commit": "6607c19d3fd492ec53439f4104b39e4c62ece179"}}`)
+
+	ev := wh.Receive(context.Background(), "success", payload)
+
+	if got, want := ev.Outcome, OutcomeError; got != want {
+		t.Fatalf("Outcome => %s; want %s", got, want)
+	}
+	if got, want := ev.Error, "Missing docker_tags"; got != want {
+		t.Fatalf("Error => %s; want %s", got, want)
+	}
+}
+
 func TestWebhook_TagsImageID(t *testing.T) {
 	s := NewServer(nil)
 
@@ -87,3 +159,52 @@ func TestWebhook_TagsImageID(t *testing.T) {
 
 	s.ServeHTTP(resp, req)
 }
+
+func TestServer_RequestID(t *testing.T) {
+	s := NewServer(nil)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/quay/pending", loadFixture("pending_build.manual", t))
+	req.Header.Set("X-Request-Id", "abc123")
+
+	s.ServeHTTP(resp, req)
+
+	if got, want := resp.Header().Get("X-Request-Id"), "abc123"; got != want {
+		t.Fatalf("X-Request-Id => %s; want %s", got, want)
+	}
+}
+
+func TestServer_Metrics(t *testing.T) {
+	s := NewServer(nil)
+	before := webhooksTotal.Value("pending", "skipped")
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/quay/pending", loadFixture("pending_build.manual", t))
+	s.ServeHTTP(resp, req)
+
+	if got, want := webhooksTotal.Value("pending", "skipped"), before+1; got != want {
+		t.Fatalf("Skipped webhooks => %v; want %v", got, want)
+	}
+
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	s.ServeHTTP(resp, req)
+
+	if !strings.Contains(resp.Body.String(), `quayd_webhooks_total{status="pending",outcome="skipped"}`) {
+		t.Fatalf("Body => %s; want webhook counter", resp.Body.String())
+	}
+}
+
+func TestServer_Healthz(t *testing.T) {
+	s := NewServer(nil)
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		s.ServeHTTP(resp, req)
+
+		if got, want := resp.Code, 200; got != want {
+			t.Fatalf("%s => %d; want %d", path, got, want)
+		}
+	}
+}
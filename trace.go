@@ -0,0 +1,390 @@
+package quayd
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTracer is the Tracer used for webhook requests, backend calls and
+// outbound HTTP requests. It has no exporter until one is configured, so spans
+// are propagated but not recorded.
+var DefaultTracer = &Tracer{}
+
+// Span kinds, as defined by OpenTelemetry.
+const (
+	SpanKindInternal = 1
+	SpanKindServer   = 2
+	SpanKindClient   = 3
+)
+
+// SpanExporter receives spans once they have ended.
+type SpanExporter interface {
+	ExportSpan(*Span) error
+}
+
+// Tracer creates spans and hands them to an Exporter when they end.
+type Tracer struct {
+	// Exporter receives finished spans. If nil, spans are not exported.
+	Exporter SpanExporter
+}
+
+type spanKey struct{}
+
+// SpanFromContext returns the current span in ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start starts a new span that is a child of the span in ctx, if any, and
+// returns a context containing it.
+func (t *Tracer) Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	s := &Span{
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: map[string]string{},
+		tracer:     t,
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.TraceID = parent.TraceID
+		s.ParentID = parent.SpanID
+	} else {
+		rand.Read(s.TraceID[:])
+	}
+	rand.Read(s.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Span is a single timed operation within a trace.
+type Span struct {
+	TraceID  [16]byte
+	SpanID   [8]byte
+	ParentID [8]byte
+	Name     string
+	Kind     int
+	Start    time.Time
+	End      time.Time
+
+	mu         sync.Mutex
+	Attributes map[string]string
+	Err        string
+
+	tracer *Tracer
+}
+
+// SetAttribute sets a key/value attribute on the span.
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attributes[key] = value
+}
+
+// SetError marks the span as failed if err is non-nil.
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Err = err.Error()
+}
+
+// Finish ends the span and exports it.
+func (s *Span) Finish() {
+	s.End = time.Now()
+	if s.tracer != nil && s.tracer.Exporter != nil {
+		s.tracer.Exporter.ExportSpan(s)
+	}
+}
+
+// TraceIDString returns the hex encoded trace id.
+func (s *Span) TraceIDString() string { return hex.EncodeToString(s.TraceID[:]) }
+
+// SpanIDString returns the hex encoded span id.
+func (s *Span) SpanIDString() string { return hex.EncodeToString(s.SpanID[:]) }
+
+// ParentIDString returns the hex encoded parent span id, or an empty string
+// for a root span.
+func (s *Span) ParentIDString() string {
+	if s.ParentID == ([8]byte{}) {
+		return ""
+	}
+	return hex.EncodeToString(s.ParentID[:])
+}
+
+// traceparent formats the span as a W3C traceparent header.
+func (s *Span) traceparent() string {
+	return "00-" + s.TraceIDString() + "-" + s.SpanIDString() + "-01"
+}
+
+// ContextWithRemoteParent returns a context whose span is the remote parent
+// described by a W3C traceparent header. Spans started from the returned
+// context join the caller's trace. Invalid headers are ignored.
+func ContextWithRemoteParent(ctx context.Context, traceparent string) context.Context {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return ctx
+	}
+
+	s := &Span{}
+	if _, err := hex.Decode(s.TraceID[:], []byte(parts[1])); err != nil {
+		return ctx
+	}
+	if _, err := hex.Decode(s.SpanID[:], []byte(parts[2])); err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// startSpan starts a span on the DefaultTracer.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	return DefaultTracer.Start(ctx, name, kind)
+}
+
+// tracingTransport is an http.RoundTripper that records a client span for
+// each request and propagates the trace with a traceparent header.
+type tracingTransport struct {
+	http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := startSpan(req.Context(), "HTTP "+req.Method, SpanKindClient)
+	defer span.Finish()
+
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Traceparent", span.traceparent())
+
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return resp, err
+	}
+	span.SetAttribute("http.status_code", strconv.Itoa(resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetError(fmt.Errorf("%s", resp.Status))
+	}
+	return resp, nil
+}
+
+// requestTracer is a negroni middleware that starts a server span for every
+// request, continuing the caller's trace if a traceparent header was sent.
+type requestTracer struct{}
+
+func (requestTracer) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	ctx := ContextWithRemoteParent(r.Context(), r.Header.Get("Traceparent"))
+	ctx, span := startSpan(ctx, r.Method+" "+r.URL.Path, SpanKindServer)
+	defer span.Finish()
+
+	span.SetAttribute("http.method", r.Method)
+	span.SetAttribute("http.target", r.URL.Path)
+	if id := RequestID(r.Context()); id != "" {
+		span.SetAttribute("request_id", id)
+	}
+
+	next(w, r.WithContext(ctx))
+}
+
+// spanJSON is the JSON representation of a span written by WriterExporter.
+type spanJSON struct {
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_id,omitempty"`
+	Name       string            `json:"name"`
+	Kind       int               `json:"kind"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Duration   string            `json:"duration"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// WriterExporter is a SpanExporter that writes each span as a line of JSON to
+// W. It's useful for local testing with stdout or a file.
+type WriterExporter struct {
+	mu sync.Mutex
+	W  io.Writer
+}
+
+// ExportSpan implements SpanExporter ExportSpan.
+func (e *WriterExporter) ExportSpan(s *Span) error {
+	s.mu.Lock()
+	raw, err := json.Marshal(&spanJSON{
+		TraceID:    s.TraceIDString(),
+		SpanID:     s.SpanIDString(),
+		ParentID:   s.ParentIDString(),
+		Name:       s.Name,
+		Kind:       s.Kind,
+		Start:      s.Start,
+		End:        s.End,
+		Duration:   s.End.Sub(s.Start).String(),
+		Attributes: s.Attributes,
+		Error:      s.Err,
+	})
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.W.Write(append(raw, '\n'))
+	return err
+}
+
+// OTLPExporter is a SpanExporter that sends spans to an OpenTelemetry
+// collector using OTLP/HTTP with JSON encoding. Spans are buffered and sent in
+// batches by Run.
+type OTLPExporter struct {
+	// Endpoint is the traces endpoint, e.g.
+	// http://localhost:4318/v1/traces.
+	Endpoint string
+
+	// ServiceName is reported as the service.name resource attribute.
+	ServiceName string
+
+	// Client is used to send requests. Defaults to http.DefaultClient.
+	Client *http.Client
+
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// ExportSpan implements SpanExporter ExportSpan.
+func (e *OTLPExporter) ExportSpan(s *Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, s)
+	return nil
+}
+
+// Run flushes buffered spans every interval until ctx is done, then flushes
+// one final time.
+func (e *OTLPExporter) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			e.Flush(ctx)
+		case <-ctx.Done():
+			e.Flush(context.Background())
+			return
+		}
+	}
+}
+
+// Flush sends all buffered spans to the collector.
+func (e *OTLPExporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.mu.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+
+	raw, err := json.Marshal(otlpRequest(e.serviceName(), spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", e.Endpoint, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	c := e.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("otlp: unexpected response: %s", resp.Status)
+	}
+	return nil
+}
+
+func (e *OTLPExporter) serviceName() string {
+	if e.ServiceName == "" {
+		return "quayd"
+	}
+	return e.ServiceName
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+func otlpAttributes(m map[string]string) []otlpAttribute {
+	attrs := make([]otlpAttribute, 0, len(m))
+	for k, v := range m {
+		a := otlpAttribute{Key: k}
+		a.Value.StringValue = v
+		attrs = append(attrs, a)
+	}
+	return attrs
+}
+
+// otlpRequest builds an ExportTraceServiceRequest in the OTLP JSON encoding.
+func otlpRequest(service string, spans []*Span) map[string]interface{} {
+	var out []map[string]interface{}
+	for _, s := range spans {
+		s.mu.Lock()
+		span := map[string]interface{}{
+			"traceId":           s.TraceIDString(),
+			"spanId":            s.SpanIDString(),
+			"name":              s.Name,
+			"kind":              s.Kind,
+			"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.Attributes),
+		}
+		if p := s.ParentIDString(); p != "" {
+			span["parentSpanId"] = p
+		}
+		if s.Err != "" {
+			span["status"] = map[string]interface{}{"code": 2, "message": s.Err}
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]string{"service.name": service}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "github.com/timchunght/quayd"},
+						"spans": out,
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,130 @@
+package quayd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type recordingExporter struct {
+	spans []*Span
+}
+
+func (e *recordingExporter) ExportSpan(s *Span) error {
+	e.spans = append(e.spans, s)
+	return nil
+}
+
+func TestTracer_Start(t *testing.T) {
+	tr := &Tracer{Exporter: &recordingExporter{}}
+
+	ctx, parent := tr.Start(context.Background(), "parent", SpanKindServer)
+	_, child := tr.Start(ctx, "child", SpanKindInternal)
+	child.Finish()
+	parent.Finish()
+
+	if got, want := child.TraceID, parent.TraceID; got != want {
+		t.Fatalf("TraceID => %x; want %x", got, want)
+	}
+	if got, want := child.ParentIDString(), parent.SpanIDString(); got != want {
+		t.Fatalf("ParentID => %s; want %s", got, want)
+	}
+	if got, want := len(tr.Exporter.(*recordingExporter).spans), 2; got != want {
+		t.Fatalf("Exported => %d; want %d", got, want)
+	}
+}
+
+func TestContextWithRemoteParent(t *testing.T) {
+	tests := []struct {
+		in      string
+		traceID string
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"garbage", ""},
+	}
+
+	for _, tt := range tests {
+		ctx := ContextWithRemoteParent(context.Background(), tt.in)
+		_, span := (&Tracer{}).Start(ctx, "test", SpanKindServer)
+
+		if tt.traceID == "" {
+			if span.ParentIDString() != "" {
+				t.Fatalf("Expected a root span for %q", tt.in)
+			}
+			continue
+		}
+		if got, want := span.TraceIDString(), tt.traceID; got != want {
+			t.Fatalf("TraceID => %s; want %s", got, want)
+		}
+		if got, want := span.ParentIDString(), "00f067aa0ba902b7"; got != want {
+			t.Fatalf("ParentID => %s; want %s", got, want)
+		}
+	}
+}
+
+func TestTracingTransport(t *testing.T) {
+	var traceparent string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+	}))
+	defer s.Close()
+
+	ctx, span := startSpan(context.Background(), "test", SpanKindInternal)
+	req, _ := http.NewRequest("GET", s.URL, nil)
+
+	c := &http.Client{Transport: &tracingTransport{http.DefaultTransport}}
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if !strings.HasPrefix(traceparent, "00-"+span.TraceIDString()+"-") {
+		t.Fatalf("Traceparent => %s; want trace %s", traceparent, span.TraceIDString())
+	}
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tr := &Tracer{Exporter: &WriterExporter{W: &buf}}
+
+	_, span := tr.Start(context.Background(), "Tagger.Tag", SpanKindInternal)
+	span.SetAttribute("repo", "ejholmes/docker-statsd")
+	span.Finish()
+
+	var got spanJSON
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Tagger.Tag" || got.Attributes["repo"] != "ejholmes/docker-statsd" {
+		t.Fatalf("Span => %+v", got)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body []byte
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer s.Close()
+
+	e := &OTLPExporter{Endpoint: s.URL}
+	tr := &Tracer{Exporter: e}
+	_, span := tr.Start(context.Background(), "CommitResolver.Resolve", SpanKindInternal)
+	span.Finish()
+
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{`"name":"CommitResolver.Resolve"`, `"traceId":"` + span.TraceIDString() + `"`, `"stringValue":"quayd"`} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("Body => %s; want it to contain %s", body, want)
+		}
+	}
+}